@@ -2,25 +2,48 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"fmt"
 	"github.com/RVodassa/url-shortener/internal/config"
 	grpchandler "github.com/RVodassa/url-shortener/internal/handler/grpc"
+	httphandler "github.com/RVodassa/url-shortener/internal/handler/http"
+	"github.com/RVodassa/url-shortener/internal/janitor"
+	"github.com/RVodassa/url-shortener/internal/lib/certs"
+	"github.com/RVodassa/url-shortener/internal/lib/geoip"
+	"github.com/RVodassa/url-shortener/internal/lib/preview"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
 	"github.com/RVodassa/url-shortener/internal/lib/random"
+	"github.com/RVodassa/url-shortener/internal/lib/scanner"
+	"github.com/RVodassa/url-shortener/internal/lib/tracker"
 	"github.com/RVodassa/url-shortener/internal/service"
 	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/RVodassa/url-shortener/internal/storage/inMemory/mapStorage"
 	"github.com/RVodassa/url-shortener/internal/storage/inMemory/redisStorage"
 	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
+	"github.com/RVodassa/url-shortener/internal/webhook"
 	"github.com/RVodassa/url-shortener/protos/genv1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// Доступные сканеры url
+const (
+	ScannerBlocklist = "blocklist"
+	ScannerWebhook   = "webhook"
+)
+
 // Доступные хранилища
 const (
 	Redis    = "redis"
@@ -52,18 +75,87 @@ func (a *App) Run() {
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// инициализация модулей
-	store, err := NewStorage(ctx) // хранилище
+	store, err := NewStorage(ctx, a.cfg) // хранилище
 	if err != nil {
 		log.Printf("%s: %v", op, err)
 		os.Exit(1)
 	}
 
+	var opts []service.Option
+	urlScanner, err := NewScanner(a.cfg.Scanner) // проверка url
+	if err != nil {
+		log.Printf("%s: %v", op, err)
+		os.Exit(1)
+	}
+	if urlScanner != nil {
+		opts = append(opts, service.WithScanner(urlScanner, a.cfg.Scanner.Timeout, a.cfg.Scanner.FailClosed))
+	}
+
+	// учет последнего обращения без записи на каждый GetUrl
+	accessTracker := tracker.New(store.TouchUrls, a.cfg.AccessFlushInterval)
+	trackerDone := make(chan struct{})
+	go func() {
+		accessTracker.Run(ctx)
+		close(trackerDone)
+	}()
+	opts = append(opts, service.WithAccessTracker(accessTracker))
+
+	// определение страны клиента для правил перехода
+	if a.cfg.GeoIPPath != "" {
+		geoDB, err := geoip.Open(a.cfg.GeoIPPath)
+		if err != nil {
+			log.Printf("%s: %v", op, err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := geoDB.Close(); err != nil {
+				log.Printf("%s: закрытие базы GeoIP. Ошибка: %v", op, err)
+			}
+		}()
+		opts = append(opts, service.WithGeoLocator(geoDB))
+	}
+
+	// сведения о странице для предпросмотра
+	if a.cfg.Preview.FetchPages {
+		fetcher := preview.NewFetcher(preview.SafeClient(a.cfg.Preview.FetchTimeout))
+		opts = append(opts, service.WithPageFetcher(fetcher, a.cfg.Preview.FetchTimeout))
+	}
+
+	// QR коды с полным адресом короткой ссылки
+	if a.cfg.PublicUrl != "" {
+		publicUrl, err := url.Parse(a.cfg.PublicUrl)
+		if err != nil || publicUrl.Scheme == "" || publicUrl.Host == "" {
+			log.Printf("%s: невалидный public_url='%s'", op, a.cfg.PublicUrl)
+			os.Exit(1)
+		}
+		opts = append(opts, service.WithQrCodes(qrcode.NewCache(qrcode.NewEncoder(), a.cfg.QrCacheSize), publicUrl))
+	}
+
+	if len(a.cfg.Domains) > 0 {
+		opts = append(opts, service.WithDomains(NewDomains(a.cfg.Domains)))
+	}
+
+	// подписки на события ссылок, если хранилище держит outbox
+	webhookStore, _ := store.(storage.WebhookStore)
+	if webhookStore != nil {
+		opts = append(opts, service.WithWebhooks(webhookStore))
+	}
+
+	// журнал изменений ссылок для WatchUrls
+	if feed, ok := store.(storage.ChangeFeed); ok {
+		opts = append(opts, service.WithChangeFeed(feed, a.cfg.WatchInterval))
+	}
+
 	rand := random.New()
-	newService := service.New(store, rand)    // сервис
-	newHandler := grpchandler.New(newService) // handler
+	newService := service.New(store, rand, opts...) // сервис
+	newHandler := grpchandler.New(newService)       // handler
 
-	// Слушатель на порту
-	lis, err := net.Listen(a.cfg.Network, a.cfg.Port)
+	// Слушатель на Host:Port
+	if a.cfg.Network == "" || a.cfg.Port == "" {
+		log.Fatalf("%s: пустой port='%s' или network='%s'", op, a.cfg.Port, a.cfg.Network)
+	}
+	grpcAddr := GRPCAddr(a.cfg.GRPCServer)
+	lis, err := net.Listen(a.cfg.Network, grpcAddr)
 	if err != nil {
 		log.Fatalf("%s: установка слушателя. Ошибка: %v", op, err)
 	}
@@ -75,16 +167,60 @@ func (a *App) Run() {
 		}
 	}(lis)
 
-	// запуск gRPC сервера
-	if a.cfg.Network == "" || a.cfg.Port == "" {
-		log.Fatalf("%s: пустой port='%s' или network='%s'", op, a.cfg.Network, a.cfg.Port)
+	// очистка истекших, неиспользуемых и мягко удаленных ссылок.
+	// Хранилище с общей блокировкой не дает нескольким репликам чистить одновременно.
+	locker, _ := store.(storage.Locker)
+	linkJanitor := janitor.New(newService, locker, janitor.Config{
+		Interval:         a.cfg.Janitor.Interval,
+		BatchSize:        a.cfg.Janitor.BatchSize,
+		DryRun:           a.cfg.Janitor.DryRun,
+		StaleAfter:       time.Duration(a.cfg.Janitor.StaleDays) * 24 * time.Hour,
+		DeletedRetention: a.cfg.Retention.Deleted,
+		ChangeRetention:  a.cfg.Retention.Changes,
+	})
+	janitorDone := make(chan struct{})
+	go func() {
+		linkJanitor.Run(ctx)
+		close(janitorDone)
+	}()
+
+	// отправка событий подписчикам: доставки строятся по журналу изменений ссылок
+	webhooksDone := make(chan struct{})
+	if webhookStore != nil && newService.Changes != nil && a.cfg.Webhooks.Interval > 0 {
+		dispatcher := webhook.New(webhookStore, newService, nil, webhook.Config{
+			Interval:    a.cfg.Webhooks.Interval,
+			BatchSize:   a.cfg.Webhooks.BatchSize,
+			Workers:     a.cfg.Webhooks.Workers,
+			MaxAttempts: a.cfg.Webhooks.MaxAttempts,
+			BaseBackoff: a.cfg.Webhooks.BaseBackoff,
+			MaxBackoff:  a.cfg.Webhooks.MaxBackoff,
+			Timeout:     a.cfg.Webhooks.Timeout,
+		})
+		go func() {
+			dispatcher.Run(ctx)
+			close(webhooksDone)
+		}()
+	} else {
+		close(webhooksDone)
+	}
+
+	metricsServer := a.serveMetrics()
+	redirectHandler := httphandler.New(newService)
+	redirectHandler.TrustForwarded = a.cfg.HTTPServer.TrustForwarded
+	httpServer, err := a.serveHTTP(ctx, redirectHandler)
+	if err != nil {
+		log.Fatalf("%s: %v", op, err)
 	}
 
-	newGrpcServer := grpc.NewServer()
+	grpcTLS, err := NewTLSConfig(ctx, a.cfg.GRPCServer.TLS)
+	if err != nil {
+		log.Fatalf("%s: TLS gRPC сервера. %v", op, err)
+	}
+	newGrpcServer := grpc.NewServer(NewGRPCServerOptions(a.cfg.GRPCServer, grpcTLS)...)
 	genv1.RegisterUrlShortenerServer(newGrpcServer, newHandler)
 
 	go func() {
-		log.Printf("%s: gRPC server runnig... Port='%s' Network='%s'", op, a.cfg.Port, a.cfg.Network)
+		log.Printf("%s: gRPC server runnig... Addr='%s' Network='%s' TLS=%t", op, grpcAddr, a.cfg.Network, grpcTLS != nil)
 		if err = newGrpcServer.Serve(lis); err != nil {
 			log.Printf("%s: gRPC server runnig... Ошибка: %v", op, err)
 			signalChan <- syscall.SIGTERM
@@ -95,9 +231,38 @@ func (a *App) Run() {
 	<-signalChan
 	log.Printf("%s: завершение работы...", op)
 
+	// потоки WatchUrls сами не завершаются, поэтому после ожидания соединения закрываются
+	grpcStopped := make(chan struct{})
+	go func() {
+		newGrpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-time.After(5 * time.Second):
+		newGrpcServer.Stop()
+		<-grpcStopped
+	}
+
+	// остановка фоновых задач и последний сброс обращений до отключения хранилища
+	cancel()
+	<-trackerDone
+	<-janitorDone
+	<-webhooksDone
+
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	newGrpcServer.GracefulStop()
+
+	if httpServer != nil {
+		if err = httpServer.Shutdown(ctx); err != nil {
+			log.Printf("%s: остановка HTTP сервера. Ошибка: %v", op, err)
+		}
+	}
+	if metricsServer != nil {
+		if err = metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("%s: остановка сервера метрик. Ошибка: %v", op, err)
+		}
+	}
 
 	err = store.Disconnect(ctx)
 	if err != nil {
@@ -107,7 +272,67 @@ func (a *App) Run() {
 	// TODO: мягкое завершение работы остальных частей приложения
 }
 
-func NewStorage(ctx context.Context) (storage.Storage, error) {
+// serveHTTP запускает сервер переходов. Возвращает nil, если адрес не задан.
+func (a *App) serveHTTP(ctx context.Context, handler *httphandler.HttpHandler) (*http.Server, error) {
+	const op = "app.serveHTTP"
+
+	cfg := a.cfg.HTTPServer
+	if cfg.Addr == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := NewTLSConfig(ctx, cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	server := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      handler.Routes(),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+		TLSConfig:    tlsConfig,
+	}
+
+	go func() {
+		log.Printf("%s: HTTP server running... Addr='%s' TLS=%t", op, cfg.Addr, tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			// сертификат берется из TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s: %v", op, err)
+		}
+	}()
+	return server, nil
+}
+
+// serveMetrics публикует expvar на MetricsAddr. Возвращает nil, если адрес не задан.
+func (a *App) serveMetrics() *http.Server {
+	const op = "app.serveMetrics"
+
+	if a.cfg.MetricsAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: a.cfg.MetricsAddr, Handler: mux}
+
+	go func() {
+		log.Printf("%s: metrics server running... Addr='%s'", op, a.cfg.MetricsAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s: %v", op, err)
+		}
+	}()
+	return server
+}
+
+func NewStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
 	const op = "app.NewStorage"
 
 	storageType := os.Getenv("STORAGE_TYPE")
@@ -119,7 +344,7 @@ func NewStorage(ctx context.Context) (storage.Storage, error) {
 	switch storageType {
 
 	case Redis:
-		store, err = redisStorage.Connect(ctx)
+		store, err = redisStorage.Connect(ctx, NewRedisConfig(cfg.Redis))
 		if err != nil {
 			return nil, err
 		}
@@ -128,14 +353,161 @@ func NewStorage(ctx context.Context) (storage.Storage, error) {
 		store = mapStorage.New()
 		return store, nil
 	case Postgres:
-		conn, errConn := postgres.ConnectDB(ctx)
-		if errConn != nil {
-			return nil, fmt.Errorf("%s: storageType='%s'. Ошибка: %v", op, storageType, errConn)
+		store, err = postgres.Connect(ctx, NewPostgresConfig(cfg.Postgres))
+		if err != nil {
+			return nil, fmt.Errorf("%s: storageType='%s'. Ошибка: %v", op, storageType, err)
 		}
-		store = postgres.New(conn)
 		return store, nil
 
 	default:
 		return nil, fmt.Errorf("%s: storageType='%s'. Ошибка: неизвестный тип: %s", op, storageType, err)
 	}
 }
+
+// GRPCAddr возвращает адрес слушателя gRPC. Port можно указать и в старом виде ":8083".
+func GRPCAddr(cfg config.GRPCServer) string {
+	return net.JoinHostPort(cfg.Host, strings.TrimPrefix(cfg.Port, ":"))
+}
+
+// NewTLSConfig загружает сертификат сервера и следит за его файлами до отмены ctx.
+// Возвращает nil, если TLS выключен.
+func NewTLSConfig(ctx context.Context, cfg config.TLS) (*tls.Config, error) {
+	const op = "app.NewTLSConfig"
+
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	reloader, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	go func() {
+		if err := reloader.Watch(ctx); err != nil {
+			log.Printf("%s: сертификат не будет перечитываться. %v", op, err)
+		}
+	}()
+	return reloader.TLSConfig(), nil
+}
+
+// NewGRPCServerOptions переводит настройки сервера gRPC из конфига в параметры сервера.
+// Нулевые значения оставляют значения gRPC по умолчанию. tlsConfig nil - без TLS.
+func NewGRPCServerOptions(cfg config.GRPCServer, tlsConfig *tls.Config) []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			grpchandler.PrincipalInterceptor,
+			grpchandler.DeadlineInterceptor(grpchandler.Deadlines{
+				Default: cfg.ReqTimeout,
+				Methods: cfg.MethodTimeouts,
+			}),
+		),
+		grpc.StreamInterceptor(grpchandler.PrincipalStreamInterceptor),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     cfg.IdleTimeout,
+			MaxConnectionAge:      cfg.MaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.MaxConnectionAgeGrace,
+			Time:                  cfg.Keepalive.Time,
+			Timeout:               cfg.Keepalive.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Keepalive.MinTime,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	return opts
+}
+
+// NewRedisConfig переводит настройки Redis из конфига в настройки хранилища.
+func NewRedisConfig(cfg config.Redis) redisStorage.Config {
+	return redisStorage.Config{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Cluster:          cfg.Cluster,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		KeyPrefix:        cfg.KeyPrefix,
+		PoolSize:         cfg.PoolSize,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		TLS:              cfg.TLS.Enabled,
+		CAFile:           cfg.TLS.CAFile,
+		CertFile:         cfg.TLS.CertFile,
+		KeyFile:          cfg.TLS.KeyFile,
+		ServerName:       cfg.TLS.ServerName,
+	}
+}
+
+// NewPostgresConfig переводит настройки Postgres из конфига в настройки хранилища.
+func NewPostgresConfig(cfg config.Postgres) postgres.Config {
+	return postgres.Config{
+		MaxConns:         cfg.MaxConns,
+		MinConns:         cfg.MinConns,
+		MaxConnLifetime:  cfg.MaxConnLifetime,
+		MaxConnIdleTime:  cfg.MaxConnIdleTime,
+		StatementTimeout: cfg.StatementTimeout,
+		SSLMode:          cfg.TLS.Mode,
+		SSLRootCert:      cfg.TLS.CAFile,
+		SSLCert:          cfg.TLS.CertFile,
+		SSLKey:           cfg.TLS.KeyFile,
+		Replicas:         cfg.Replicas,
+	}
+}
+
+// NewDomains переводит домены из конфига в правила сервиса. Первый домен - по умолчанию.
+func NewDomains(domains []config.Domain) (string, map[string]service.DomainRules) {
+	rules := make(map[string]service.DomainRules, len(domains))
+	for _, d := range domains {
+		rules[strings.ToLower(d.Name)] = service.DomainRules{
+			AliasLength: d.AliasLength,
+			Reserved:    d.Reserved,
+		}
+	}
+	return strings.ToLower(domains[0].Name), rules
+}
+
+// NewScanner создает сканер url по конфигу. Возвращает nil, если проверка выключена.
+func NewScanner(cfg config.Scanner) (service.URLScanner, error) {
+	const op = "app.NewScanner"
+
+	var next scanner.Scanner
+
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case ScannerBlocklist:
+		blocklist, err := scanner.NewBlocklist(cfg.BlocklistPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		next = blocklist
+	case ScannerWebhook:
+		if cfg.WebhookUrl == "" {
+			return nil, fmt.Errorf("%s: пустой webhook_url", op)
+		}
+		next = scanner.NewWebhook(cfg.WebhookUrl, nil)
+	default:
+		return nil, fmt.Errorf("%s: неизвестный тип сканера: %s", op, cfg.Type)
+	}
+
+	log.Printf("%s: scannerType='%s'", op, cfg.Type)
+
+	if cfg.CacheTTL > 0 {
+		return scanner.NewCache(next, cfg.CacheTTL), nil
+	}
+	return next, nil
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/config"
+	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
+	"github.com/golang-migrate/migrate/v4"
+	"io"
+)
+
+// RunMigrate выполняет команду migrate (up, down N, version, force V)
+// над базой из переменных окружения DB_* с настройками TLS из cfg.
+func RunMigrate(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	const op = "app.RunMigrate"
+
+	cmd, err := postgres.ParseMigrateCommand(args)
+	if err != nil {
+		return err
+	}
+	dsn, err := postgres.DSN()
+	if err == nil {
+		dsn, err = NewPostgresConfig(cfg.Postgres).WithTLS(dsn)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = postgres.Migrate(ctx, dsn, func(m *migrate.Migrate) error {
+		return cmd.Run(m, out)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %s. %w", op, cmd.Name, err)
+	}
+	return nil
+}
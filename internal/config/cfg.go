@@ -10,14 +10,183 @@ import (
 type Config struct {
 	Env        string `yaml:"env" env-required:"true"`
 	GRPCServer `yaml:"grpc_server"`
+	Scanner    Scanner   `yaml:"scanner"`
+	Retention  Retention `yaml:"retention"`
+	Janitor    Janitor   `yaml:"janitor"`
+	Preview    Preview   `yaml:"preview"`
+	Webhooks   Webhooks  `yaml:"webhooks"`
+	Postgres   Postgres  `yaml:"postgres"`
+	Redis      Redis     `yaml:"redis"`
+
+	// сервер переходов по коротким ссылкам
+	HTTPServer HTTPServer `yaml:"http_server"`
+	// домены со своими пространствами alias, первый - домен по умолчанию.
+	// Пусто - один домен, Host при переходах не учитывается.
+	Domains []Domain `yaml:"domains"`
+
+	// период сброса времени последнего обращения в хранилище
+	AccessFlushInterval time.Duration `yaml:"access_flush_interval" env-default:"10s"`
+	// период опроса журнала изменений для WatchUrls, когда новых записей нет
+	WatchInterval time.Duration `yaml:"watch_interval" env-default:"1s"`
+	// адрес HTTP для /debug/vars, пусто - метрики не публикуются
+	MetricsAddr string `yaml:"metrics_addr"`
+	// база MaxMind для правил перехода по стране, пусто - страна не определяется
+	GeoIPPath string `yaml:"geoip_path"`
+	// адрес коротких ссылок в QR кодах, например https://sho.rt; пусто - QR коды выключены
+	PublicUrl string `yaml:"public_url"`
+	// число QR кодов в кэше
+	QrCacheSize int `yaml:"qr_cache_size" env-default:"1000"`
 }
 
 type GRPCServer struct {
-	Host        string        `yaml:"host" env-required:"true"`
-	Port        string        `yaml:"port" env-required:"true"`
+	Host        string        `yaml:"host" env-required:"true"` // 0.0.0.0 - все интерфейсы
+	Port        string        `yaml:"port" env-required:"true"` // "8083" или ":8083"
 	Network     string        `yaml:"network" env-required:"true"`
-	ReqTimeout  time.Duration `yaml:"request_timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	ReqTimeout  time.Duration `yaml:"request_timeout" env-default:"4s"` // срок обработки запроса, 0 - без ограничения
+	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`   // закрывать соединения без запросов, 0 - не закрывать
+	// сроки отдельных методов вместо request_timeout, ключ - имя метода, например SaveUrl
+	MethodTimeouts map[string]time.Duration `yaml:"method_timeouts"`
+
+	// время жизни соединения и время на завершение его запросов; 0 - не ограничено
+	MaxConnectionAge      time.Duration `yaml:"max_connection_age" env-default:"0"`
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace" env-default:"0"`
+
+	MaxRecvMsgSize       int    `yaml:"max_recv_msg_size" env-default:"4194304"` // байт
+	MaxSendMsgSize       int    `yaml:"max_send_msg_size" env-default:"4194304"`
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams" env-default:"0"` // на соединение, 0 - без ограничения
+
+	Keepalive GRPCKeepalive `yaml:"keepalive"`
+	TLS       TLS           `yaml:"tls"`
+}
+
+// GRPCKeepalive проверка соединений ping и ограничения на ping клиентов.
+type GRPCKeepalive struct {
+	Time    time.Duration `yaml:"time" env-default:"2h"`     // ping после стольких секунд тишины
+	Timeout time.Duration `yaml:"timeout" env-default:"20s"` // ожидание ответа на ping
+	// клиенты, присылающие ping чаще MinTime или без открытых запросов
+	// при PermitWithoutStream=false, отключаются
+	MinTime             time.Duration `yaml:"min_time" env-default:"5m"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream" env-default:"false"`
+}
+
+// HTTPServer настройки сервера переходов по коротким ссылкам.
+type HTTPServer struct {
+	Addr         string        `yaml:"addr"` // пусто - выключен
+	ReadTimeout  time.Duration `yaml:"read_timeout" env-default:"4s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"4s"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// брать IP клиента из X-Forwarded-For, только за доверенным прокси
+	TrustForwarded bool `yaml:"trust_forwarded" env-default:"false"`
+	TLS            TLS  `yaml:"tls"`
+}
+
+// TLS файлы сертификата сервера. Пустой cert_file - без TLS. Файлы перечитываются
+// при изменении, новые соединения получают обновленный сертификат без перезапуска.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CA сертификатов клиентов: задан - mTLS, клиенты без сертификата отклоняются
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// Domain короткий домен со своими правилами alias.
+type Domain struct {
+	Name        string   `yaml:"name"`
+	AliasLength int      `yaml:"alias_length"` // 0 - длина по умолчанию
+	Reserved    []string `yaml:"reserved"`     // alias, которые не выдаются
+}
+
+// Scanner настройки проверки Url по сервису репутации.
+type Scanner struct {
+	Type          string        `yaml:"type"` // пусто - выключено, blocklist, webhook
+	BlocklistPath string        `yaml:"blocklist_path"`
+	WebhookUrl    string        `yaml:"webhook_url"`
+	Timeout       time.Duration `yaml:"timeout" env-default:"2s"`
+	FailClosed    bool          `yaml:"fail_closed" env-default:"false"`
+	CacheTTL      time.Duration `yaml:"cache_ttl" env-default:"10m"`
+}
+
+// Retention настройки хранения мягко удаленных ссылок и журнала изменений.
+type Retention struct {
+	Deleted time.Duration `yaml:"deleted" env-default:"720h"`
+	Changes time.Duration `yaml:"changes" env-default:"168h"` // 0 - журнал не очищается
+}
+
+// Janitor настройки фоновой очистки истекших и неиспользуемых ссылок.
+type Janitor struct {
+	Interval  time.Duration `yaml:"interval" env-default:"1h"` // 0 - выключено
+	BatchSize int           `yaml:"batch_size" env-default:"500"`
+	DryRun    bool          `yaml:"dry_run" env-default:"false"`
+	StaleDays int           `yaml:"stale_days" env-default:"0"` // 0 - не удалять по давности обращения
+}
+
+// Preview настройки чтения сведений о странице для предпросмотра.
+type Preview struct {
+	FetchPages   bool          `yaml:"fetch_pages" env-default:"false"` // читать <title> и OpenGraph при сохранении
+	FetchTimeout time.Duration `yaml:"fetch_timeout" env-default:"3s"`
+}
+
+// Postgres настройки пула соединений и реплик. Адрес и учетные данные основной базы - в DB_*.
+type Postgres struct {
+	MaxConns         int32         `yaml:"max_conns" env-default:"10"`
+	MinConns         int32         `yaml:"min_conns" env-default:"0"`
+	MaxConnLifetime  time.Duration `yaml:"max_conn_lifetime" env-default:"1h"`
+	MaxConnIdleTime  time.Duration `yaml:"max_conn_idle_time" env-default:"30m"`
+	StatementTimeout time.Duration `yaml:"statement_timeout" env-default:"5s"` // 0 - без ограничения
+	TLS              PostgresTLS   `yaml:"tls"`
+	// адреса реплик для чтения ссылок при переходах; пусто - все запросы к основной базе
+	Replicas []string `yaml:"replicas" env:"DB_REPLICAS" env-separator:","`
+}
+
+// PostgresTLS режим и файлы TLS соединений с основной базой и репликами.
+type PostgresTLS struct {
+	Mode     string `yaml:"mode"` // sslmode, например verify-full; пусто - из DB_SSL
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"` // сертификат клиента
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Redis настройки подключения к Redis. master_name - Sentinel, несколько адресов
+// или cluster - Redis Cluster, иначе один сервер.
+type Redis struct {
+	Addrs      []string `yaml:"addrs" env:"REDIS_ADDR" env-separator:","`
+	MasterName string   `yaml:"master_name"` // имя master в Sentinel, addrs - адреса sentinel
+	Cluster    bool     `yaml:"cluster" env-default:"false"`
+
+	Username         string `yaml:"username" env:"REDIS_USERNAME"`
+	Password         string `yaml:"password" env:"REDIS_PASSWORD"`
+	SentinelPassword string `yaml:"sentinel_password" env:"REDIS_SENTINEL_PASSWORD"`
+	DB               int    `yaml:"db" env-default:"0"` // не поддерживается Cluster
+
+	// пространство имен ключей; в Cluster по умолчанию url-shortener
+	KeyPrefix string `yaml:"key_prefix"`
+
+	PoolSize     int           `yaml:"pool_size" env-default:"0"` // 0 - 10 на CPU
+	DialTimeout  time.Duration `yaml:"dial_timeout" env-default:"5s"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env-default:"3s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"3s"`
+
+	TLS RedisTLS `yaml:"tls"`
+}
+
+// RedisTLS настройки TLS соединений с Redis.
+type RedisTLS struct {
+	Enabled    bool   `yaml:"enabled" env-default:"false"`
+	CAFile     string `yaml:"ca_file"`   // пусто - системные CA
+	CertFile   string `yaml:"cert_file"` // сертификат клиента
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"` // пусто - хост первого адреса
+}
+
+// Webhooks настройки отправки событий ссылок подписчикам.
+type Webhooks struct {
+	Interval    time.Duration `yaml:"interval" env-default:"5s"` // 0 - события не ставятся в outbox и не отправляются
+	BatchSize   int           `yaml:"batch_size" env-default:"100"`
+	Workers     int           `yaml:"workers" env-default:"8"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"10"`
+	BaseBackoff time.Duration `yaml:"base_backoff" env-default:"10s"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" env-default:"1h"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
 }
 
 func MustLoad(configPath string) *Config {
@@ -0,0 +1,39 @@
+package grpchandler
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"path"
+	"time"
+)
+
+// Deadlines сроки обработки запросов: Default для всех методов и Methods для отдельных,
+// ключ - имя метода без сервиса, например "SaveUrl". 0 - срок не ограничивается.
+type Deadlines struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+// timeout возвращает срок для полного имени метода вида "/пакет.Сервис/Метод".
+func (d Deadlines) timeout(fullMethod string) time.Duration {
+	if timeout, ok := d.Methods[path.Base(fullMethod)]; ok {
+		return timeout
+	}
+	return d.Default
+}
+
+// DeadlineInterceptor ограничивает срок обработки unary запросов. Более ранний срок
+// клиента сохраняется. Потоки вроде WatchUrls живут, пока подключен клиент, поэтому
+// срок на них не ставится.
+func DeadlineInterceptor(d Deadlines) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		timeout := d.timeout(info.FullMethod)
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
@@ -3,26 +3,70 @@ package grpchandler
 import (
 	"context"
 	"errors"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
 	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/RVodassa/url-shortener/protos/genv1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
+	"net/netip"
+	"net/url"
+	"time"
 )
 
 //go:generate mockgen -source=grpcHandler.go -destination=./../../service/mock/service_mock.go
 type ServiceProvider interface {
-	SaveUrl(ctx context.Context, UrlStr string) (string, error)
-	GetUrl(ctx context.Context, alias string) (string, error)
-	DeleteUrl(ctx context.Context, alias string) error
+	SaveUrl(ctx context.Context, link storage.Link) (string, error)
+	GetUrl(ctx context.Context, domain, alias string, rc service.RequestContext) (storage.Link, error)
+	GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error)
+	ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error)
+	DeleteUrl(ctx context.Context, domain, alias string) error
+	DisableUrl(ctx context.Context, domain, alias string) error
+	EnableUrl(ctx context.Context, domain, alias string) error
+	RestoreUrl(ctx context.Context, domain, alias string) error
+	GetQrCode(ctx context.Context, domain, alias string, opts qrcode.Options) ([]byte, error)
+	CreateWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]storage.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	WatchUrls(ctx context.Context, offset string, send func(storage.Change) error) error
 }
 
 var (
 	ErrUrlEmpty   = errors.New("ошибка: пустой url")
 	ErrBadUrl     = errors.New("ошибка: невалидный url")
+	ErrBadMeta    = errors.New("ошибка: невалидные метаданные")
+	ErrBadExpiry  = errors.New("ошибка: срок действия уже истек")
 	ErrAliasEmpty = errors.New("ошибка: пустой alias")
 	ErrNotFound   = errors.New("ошибка: url не найден")
+	ErrDisabled   = errors.New("ошибка: url отключен")
 	ErrInternal   = errors.New("ошибка: внутренняя ошибка")
+	ErrTimeout    = errors.New("ошибка: истек срок запроса")
+	ErrCanceled   = errors.New("ошибка: запрос отменен")
+	ErrMalicious  = errors.New("ошибка: url заблокирован проверкой безопасности")
+	ErrScanFailed = errors.New("ошибка: проверка безопасности недоступна")
+	ErrBadDomain  = errors.New("ошибка: неизвестный домен")
+	ErrBadRules   = errors.New("ошибка: невалидные правила перехода")
+	ErrBadDests   = errors.New("ошибка: невалидные варианты перехода")
+	ErrBadPass    = errors.New("ошибка: невалидный пароль")
+	ErrBadUses    = errors.New("ошибка: невалидное число использований")
+	ErrNeedPass   = errors.New("ошибка: ссылка защищена паролем")
+	ErrWrongPass  = errors.New("ошибка: неверный пароль")
+	ErrExhausted  = errors.New("ошибка: использования ссылки исчерпаны")
+	ErrBadQr      = errors.New("ошибка: невалидные параметры QR кода")
+	ErrQrOff      = errors.New("ошибка: QR коды не настроены")
+	ErrBadForward = errors.New("ошибка: невалидный режим переноса параметров")
+	ErrBadPath    = errors.New("ошибка: невалидный путь перехода")
+	ErrBadTmpl    = errors.New("ошибка: невалидный шаблон ссылки")
+	ErrBadValue   = errors.New("ошибка: невалидное значение шаблона")
+	ErrBadHook    = errors.New("ошибка: невалидная подписка")
+	ErrHooksOff   = errors.New("ошибка: подписки не поддерживаются хранилищем")
+	ErrIdEmpty    = errors.New("ошибка: пустой id")
+	ErrHookAbsent = errors.New("ошибка: подписка не найдена")
+	ErrBadOffset  = errors.New("ошибка: невалидная позиция журнала изменений")
+	ErrFeedOff    = errors.New("ошибка: журнал изменений не поддерживается хранилищем")
 )
 
 type GrpcHandler struct {
@@ -40,20 +84,69 @@ func (g *GrpcHandler) SaveUrl(ctx context.Context, req *genv1.SaveUrlRequest) (*
 	const op = "grpchandler.SaveUrl"
 
 	// Первичная валидация входных данных
-	if req.Url == "" {
+	if req.Url == "" && len(req.Destinations) == 0 {
 		log.Printf("%s: url='%s'. %v", op, req.Url, ErrUrlEmpty.Error())
 		return nil, status.Error(codes.InvalidArgument, ErrUrlEmpty.Error())
 	}
 
 	// Вызов сервиса для сохранения Url
-	alias, err := g.Service.SaveUrl(ctx, req.Url)
+	alias, err := g.Service.SaveUrl(ctx, storage.Link{
+		Url:          req.Url,
+		Title:        req.Title,
+		Description:  req.Description,
+		Tags:         req.Tags,
+		Notes:        req.Notes,
+		ExpiresAt:    timeFromProto(req.ExpiresAt),
+		Domain:       req.Domain,
+		Rules:        rulesFromProto(req.Rules),
+		Destinations: destinationsFromProto(req.Destinations),
+		Password:     req.Password,
+		MaxUses:      req.MaxUses,
+		Preview:      req.Preview,
+		ForwardQuery: storage.QueryForward(req.ForwardQuery),
+		ForwardPath:  req.ForwardPath,
+		Template:     req.Template,
+	})
 	if err != nil {
 		log.Printf("%s: url='%s'. %v", op, req.Url, err)
 
 		if errors.Is(err, service.ErrBadUrl) {
 			return nil, status.Error(codes.InvalidArgument, ErrBadUrl.Error())
 		}
-		return nil, status.Error(codes.Internal, ErrInternal.Error())
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		if errors.Is(err, service.ErrBadMetadata) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadMeta.Error())
+		}
+		if errors.Is(err, service.ErrBadExpiry) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadExpiry.Error())
+		}
+		if errors.Is(err, service.ErrBadRules) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadRules.Error())
+		}
+		if errors.Is(err, service.ErrBadDestinations) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDests.Error())
+		}
+		if errors.Is(err, service.ErrBadPassword) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadPass.Error())
+		}
+		if errors.Is(err, service.ErrBadMaxUses) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadUses.Error())
+		}
+		if errors.Is(err, service.ErrBadForward) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadForward.Error())
+		}
+		if errors.Is(err, service.ErrBadTemplate) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadTmpl.Error())
+		}
+		if errors.Is(err, service.ErrMaliciousUrl) {
+			return nil, status.Error(codes.PermissionDenied, ErrMalicious.Error())
+		}
+		if errors.Is(err, service.ErrScanUnavailable) {
+			return nil, status.Error(codes.Unavailable, ErrScanFailed.Error())
+		}
+		return nil, internalError(ctx, err)
 	}
 
 	// Успешный ответ
@@ -73,17 +166,103 @@ func (g *GrpcHandler) GetUrl(ctx context.Context, req *genv1.GetUrlRequest) (*ge
 		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
 	}
 
-	Url, err := g.Service.GetUrl(ctx, req.Alias)
+	rc := requestContext(ctx, req.Client)
+	rc.Password = req.Password
+	// клиент API сам решает, показывать ли предпросмотр: в ответе есть флаг ссылки
+	rc.Preview = req.Preview
+	rc.Confirmed = true
+
+	link, err := g.Service.GetUrl(ctx, req.Domain, req.Alias, rc)
 	if err != nil {
 		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
 		if errors.Is(err, service.ErrNotFound) {
 			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
 		}
-		return nil, status.Error(codes.Internal, ErrInternal.Error())
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		if errors.Is(err, service.ErrDisabled) {
+			return nil, status.Error(codes.FailedPrecondition, ErrDisabled.Error())
+		}
+		if errors.Is(err, service.ErrPasswordNeeded) {
+			return nil, status.Error(codes.Unauthenticated, ErrNeedPass.Error())
+		}
+		if errors.Is(err, service.ErrWrongPassword) {
+			return nil, status.Error(codes.PermissionDenied, ErrWrongPass.Error())
+		}
+		if errors.Is(err, service.ErrExhausted) {
+			return nil, status.Error(codes.ResourceExhausted, ErrExhausted.Error())
+		}
+		if errors.Is(err, service.ErrBadPath) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadPath.Error())
+		}
+		if errors.Is(err, service.ErrBadTemplateValue) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadValue.Error())
+		}
+		if errors.Is(err, service.ErrMaliciousUrl) {
+			return nil, status.Error(codes.PermissionDenied, ErrMalicious.Error())
+		}
+		return nil, internalError(ctx, err)
 	}
 
 	log.Printf("%s: alias='%s'. получен Url", op, req.Alias)
-	return &genv1.GetUrlResponse{Url: Url}, nil
+	return &genv1.GetUrlResponse{
+		Url:         link.Url,
+		Title:       link.Title,
+		Description: link.Description,
+		Tags:        link.Tags,
+		Notes:       link.Notes,
+		Preview:     link.Preview,
+		Page:        pageToProto(link.Page),
+	}, nil
+}
+
+func (g *GrpcHandler) GetUrlInfo(ctx context.Context, req *genv1.GetUrlInfoRequest) (*genv1.GetUrlInfoResponse, error) {
+	const op = "grpchandler.GetUrlInfo"
+
+	if req.Alias == "" {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, ErrAliasEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
+	}
+
+	link, err := g.Service.GetUrlInfo(ctx, req.Domain, req.Alias)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: alias='%s'. получена информация", op, req.Alias)
+	return &genv1.GetUrlInfoResponse{Link: linkToProto(link)}, nil
+}
+
+func (g *GrpcHandler) ListUrls(ctx context.Context, req *genv1.ListUrlsRequest) (*genv1.ListUrlsResponse, error) {
+	const op = "grpchandler.ListUrls"
+
+	links, err := g.Service.ListUrls(ctx, storage.ListFilter{
+		Tag:    req.Tag,
+		Limit:  int(req.Limit),
+		Offset: int(req.Offset),
+	})
+	if err != nil {
+		log.Printf("%s: tag='%s'. %v", op, req.Tag, err)
+		return nil, internalError(ctx, err)
+	}
+
+	response := &genv1.ListUrlsResponse{
+		Links: make([]*genv1.Link, 0, len(links)),
+	}
+	for _, link := range links {
+		response.Links = append(response.Links, linkToProto(link))
+	}
+
+	log.Printf("%s: tag='%s'. получено ссылок: %d", op, req.Tag, len(links))
+	return response, nil
 }
 
 func (g *GrpcHandler) DeleteUrl(ctx context.Context, req *genv1.DeleteUrlRequest) (*genv1.DeleteUrlResponse, error) {
@@ -94,13 +273,16 @@ func (g *GrpcHandler) DeleteUrl(ctx context.Context, req *genv1.DeleteUrlRequest
 		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
 	}
 
-	err := g.Service.DeleteUrl(ctx, req.Alias)
+	err := g.Service.DeleteUrl(ctx, req.Domain, req.Alias)
 	if err != nil {
 		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
 		if errors.Is(err, service.ErrNotFound) {
 			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
 		}
-		return nil, status.Error(codes.Internal, ErrInternal.Error())
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		return nil, internalError(ctx, err)
 	}
 
 	response := &genv1.DeleteUrlResponse{
@@ -110,3 +292,447 @@ func (g *GrpcHandler) DeleteUrl(ctx context.Context, req *genv1.DeleteUrlRequest
 	log.Printf("%s: alias='%s'. удален Url", op, req.Alias)
 	return response, nil
 }
+
+func (g *GrpcHandler) DisableUrl(ctx context.Context, req *genv1.DisableUrlRequest) (*genv1.DisableUrlResponse, error) {
+	const op = "grpchandler.DisableUrl"
+
+	if req.Alias == "" {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, ErrAliasEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
+	}
+
+	err := g.Service.DisableUrl(ctx, req.Domain, req.Alias)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: alias='%s'. отключен Url", op, req.Alias)
+	return &genv1.DisableUrlResponse{Status: "OK"}, nil
+}
+
+func (g *GrpcHandler) EnableUrl(ctx context.Context, req *genv1.EnableUrlRequest) (*genv1.EnableUrlResponse, error) {
+	const op = "grpchandler.EnableUrl"
+
+	if req.Alias == "" {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, ErrAliasEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
+	}
+
+	err := g.Service.EnableUrl(ctx, req.Domain, req.Alias)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: alias='%s'. включен Url", op, req.Alias)
+	return &genv1.EnableUrlResponse{Status: "OK"}, nil
+}
+
+func (g *GrpcHandler) RestoreUrl(ctx context.Context, req *genv1.RestoreUrlRequest) (*genv1.RestoreUrlResponse, error) {
+	const op = "grpchandler.RestoreUrl"
+
+	if req.Alias == "" {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, ErrAliasEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
+	}
+
+	err := g.Service.RestoreUrl(ctx, req.Domain, req.Alias)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: alias='%s'. восстановлен Url", op, req.Alias)
+	return &genv1.RestoreUrlResponse{Status: "OK"}, nil
+}
+
+func (g *GrpcHandler) GetQrCode(ctx context.Context, req *genv1.GetQrCodeRequest) (*genv1.GetQrCodeResponse, error) {
+	const op = "grpchandler.GetQrCode"
+
+	if req.Alias == "" {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, ErrAliasEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrAliasEmpty.Error())
+	}
+
+	opts, err := qrOptionsFromProto(req)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		return nil, status.Error(codes.InvalidArgument, ErrBadQr.Error())
+	}
+
+	image, err := g.Service.GetQrCode(ctx, req.Domain, req.Alias, opts)
+	if err != nil {
+		log.Printf("%s: alias='%s'. %v", op, req.Alias, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrNotFound.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		if errors.Is(err, service.ErrDisabled) {
+			return nil, status.Error(codes.FailedPrecondition, ErrDisabled.Error())
+		}
+		if errors.Is(err, service.ErrBadQrOptions) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadQr.Error())
+		}
+		if errors.Is(err, service.ErrQrUnavailable) {
+			return nil, status.Error(codes.Unimplemented, ErrQrOff.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: alias='%s'. получен QR код", op, req.Alias)
+	return &genv1.GetQrCodeResponse{Image: image, ContentType: opts.Format.ContentType()}, nil
+}
+
+func (g *GrpcHandler) CreateWebhook(ctx context.Context, req *genv1.CreateWebhookRequest) (*genv1.CreateWebhookResponse, error) {
+	const op = "grpchandler.CreateWebhook"
+
+	if req.Url == "" {
+		log.Printf("%s: url='%s'. %v", op, req.Url, ErrUrlEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrUrlEmpty.Error())
+	}
+
+	webhook, err := g.Service.CreateWebhook(ctx, storage.Webhook{
+		Url:     req.Url,
+		Secret:  req.Secret,
+		Events:  req.Events,
+		Domains: req.Domains,
+	})
+	if err != nil {
+		log.Printf("%s: url='%s'. %v", op, req.Url, err)
+		if errors.Is(err, service.ErrBadWebhook) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadHook.Error())
+		}
+		if errors.Is(err, service.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, ErrBadDomain.Error())
+		}
+		if errors.Is(err, service.ErrWebhooksUnavailable) {
+			return nil, status.Error(codes.Unimplemented, ErrHooksOff.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: id='%s' url='%s'. создана подписка", op, webhook.ID, webhook.Url)
+	return &genv1.CreateWebhookResponse{Webhook: webhookToProto(webhook)}, nil
+}
+
+func (g *GrpcHandler) ListWebhooks(ctx context.Context, _ *genv1.ListWebhooksRequest) (*genv1.ListWebhooksResponse, error) {
+	const op = "grpchandler.ListWebhooks"
+
+	webhooks, err := g.Service.ListWebhooks(ctx)
+	if err != nil {
+		log.Printf("%s: %v", op, err)
+		if errors.Is(err, service.ErrWebhooksUnavailable) {
+			return nil, status.Error(codes.Unimplemented, ErrHooksOff.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	response := &genv1.ListWebhooksResponse{
+		Webhooks: make([]*genv1.Webhook, 0, len(webhooks)),
+	}
+	for _, webhook := range webhooks {
+		response.Webhooks = append(response.Webhooks, webhookToProto(webhook))
+	}
+
+	log.Printf("%s: получено подписок: %d", op, len(webhooks))
+	return response, nil
+}
+
+func (g *GrpcHandler) DeleteWebhook(ctx context.Context, req *genv1.DeleteWebhookRequest) (*genv1.DeleteWebhookResponse, error) {
+	const op = "grpchandler.DeleteWebhook"
+
+	if req.Id == "" {
+		log.Printf("%s: id='%s'. %v", op, req.Id, ErrIdEmpty)
+		return nil, status.Error(codes.InvalidArgument, ErrIdEmpty.Error())
+	}
+
+	err := g.Service.DeleteWebhook(ctx, req.Id)
+	if err != nil {
+		log.Printf("%s: id='%s'. %v", op, req.Id, err)
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, ErrHookAbsent.Error())
+		}
+		if errors.Is(err, service.ErrWebhooksUnavailable) {
+			return nil, status.Error(codes.Unimplemented, ErrHooksOff.Error())
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	log.Printf("%s: id='%s'. удалена подписка", op, req.Id)
+	return &genv1.DeleteWebhookResponse{Status: "OK"}, nil
+}
+
+// WatchUrls передает изменения ссылок, пока клиент не отключится.
+func (g *GrpcHandler) WatchUrls(req *genv1.WatchUrlsRequest, stream genv1.UrlShortener_WatchUrlsServer) error {
+	const op = "grpchandler.WatchUrls"
+
+	log.Printf("%s: offset='%s'. подключен клиент", op, req.Offset)
+
+	err := g.Service.WatchUrls(stream.Context(), req.Offset, func(change storage.Change) error {
+		return stream.Send(changeToProto(change))
+	})
+	if err != nil {
+		if stream.Context().Err() != nil {
+			log.Printf("%s: offset='%s'. клиент отключен", op, req.Offset)
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		log.Printf("%s: offset='%s'. %v", op, req.Offset, err)
+		if errors.Is(err, service.ErrBadOffset) {
+			return status.Error(codes.InvalidArgument, ErrBadOffset.Error())
+		}
+		if errors.Is(err, service.ErrChangesUnavailable) {
+			return status.Error(codes.Unimplemented, ErrFeedOff.Error())
+		}
+		if _, ok := status.FromError(err); ok {
+			// ошибка отправки уже несет код gRPC
+			return err
+		}
+		return status.Error(codes.Internal, ErrInternal.Error())
+	}
+	return nil
+}
+
+// internalError возвращает ошибку без своего кода gRPC. Если запрос отменен или истек
+// его срок, код берется из контекста: хранилище может вернуть вместо ошибки контекста
+// ошибку сети, когда срок истек во время запроса.
+func internalError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, ErrTimeout.Error())
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, ErrCanceled.Error())
+	}
+	return status.Error(codes.Internal, ErrInternal.Error())
+}
+
+// qrOptionsFromProto переводит параметры запроса в параметры QR кода.
+// Нулевые значения остаются нулевыми и заменяются значениями по умолчанию при рисовании.
+func qrOptionsFromProto(req *genv1.GetQrCodeRequest) (qrcode.Options, error) {
+	opts := qrcode.Options{
+		Format: qrcode.Format(req.Format),
+		Size:   int(req.Size),
+		Level:  qrcode.Level(req.Level),
+	}
+	if opts.Format == "" {
+		opts.Format = qrcode.FormatPNG
+	}
+	// в proto3 нельзя отличить 0 от пустого поля, поэтому 0 - поле по умолчанию,
+	// а отрицательное значение - код без поля
+	if req.Margin != 0 {
+		margin := max(int(req.Margin), 0)
+		opts.Margin = &margin
+	}
+
+	var err error
+	if req.Foreground != "" {
+		if opts.Foreground, err = qrcode.ParseColor(req.Foreground); err != nil {
+			return opts, err
+		}
+	}
+	if req.Background != "" {
+		if opts.Background, err = qrcode.ParseColor(req.Background); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// linkToProto переводит ссылку в сообщение API.
+func linkToProto(link storage.Link) *genv1.Link {
+	return &genv1.Link{
+		Domain:         link.Domain,
+		Alias:          link.Alias,
+		Url:            link.Url,
+		Title:          link.Title,
+		Description:    link.Description,
+		Tags:           link.Tags,
+		Notes:          link.Notes,
+		Status:         string(link.Status),
+		CreatedAt:      timeToProto(link.CreatedAt),
+		UpdatedAt:      timeToProto(link.UpdatedAt),
+		LastAccessedAt: timeToProto(link.LastAccessedAt),
+		ExpiresAt:      timeToProto(link.ExpiresAt),
+		Rules:          rulesToProto(link.Rules),
+		Destinations:   destinationsToProto(link.Destinations),
+		HasPassword:    link.PasswordHash != "",
+		MaxUses:        link.MaxUses,
+		UsesLeft:       link.UsesLeft,
+		Preview:        link.Preview,
+		Page:           pageToProto(link.Page),
+		ForwardQuery:   string(link.ForwardQuery),
+		ForwardPath:    link.ForwardPath,
+		Template:       link.Template,
+	}
+}
+
+func changeToProto(change storage.Change) *genv1.UrlChange {
+	return &genv1.UrlChange{
+		Offset: change.Offset,
+		Op:     string(change.Op),
+		Domain: change.Domain,
+		Alias:  change.Alias,
+		Status: string(change.Status),
+		Url:    change.Url,
+		At:     timeToProto(change.At),
+	}
+}
+
+func webhookToProto(webhook storage.Webhook) *genv1.Webhook {
+	return &genv1.Webhook{
+		Id:        webhook.ID,
+		Url:       webhook.Url,
+		Secret:    webhook.Secret,
+		Events:    webhook.Events,
+		Domains:   webhook.Domains,
+		CreatedAt: timeToProto(webhook.CreatedAt),
+	}
+}
+
+// pageToProto переводит сведения о странице в сообщение API, пустые - в nil.
+func pageToProto(page storage.Page) *genv1.Page {
+	if page == (storage.Page{}) {
+		return nil
+	}
+	return &genv1.Page{
+		Title:       page.Title,
+		Description: page.Description,
+		Image:       page.Image,
+		SiteName:    page.SiteName,
+	}
+}
+
+// requestContext собирает сведения о клиенте для правил перехода.
+// Если IP не передан, используется адрес соединения.
+func requestContext(ctx context.Context, client *genv1.ClientContext) service.RequestContext {
+	rc := service.RequestContext{
+		UserAgent:      client.GetUserAgent(),
+		AcceptLanguage: client.GetAcceptLanguage(),
+		VisitorID:      client.GetVisitorId(),
+		Path:           client.GetPath(),
+	}
+
+	if ip, err := netip.ParseAddr(client.GetIp()); err == nil {
+		rc.ClientIP = ip.Unmap()
+	} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if addrPort, err := netip.ParseAddrPort(p.Addr.String()); err == nil {
+			rc.ClientIP = addrPort.Addr().Unmap()
+		}
+	}
+
+	if len(client.GetQuery()) > 0 {
+		rc.Query = make(url.Values, len(client.GetQuery()))
+		for key, value := range client.GetQuery() {
+			rc.Query.Set(key, value)
+		}
+	}
+
+	return rc
+}
+
+// rulesFromProto переводит правила из сообщения API.
+func rulesFromProto(rules []*genv1.Rule) []storage.Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	result := make([]storage.Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, storage.Rule{
+			UserAgent: rule.UserAgent,
+			Language:  rule.Language,
+			Country:   rule.Country,
+			Query:     rule.Query,
+			Url:       rule.Url,
+		})
+	}
+	return result
+}
+
+// rulesToProto переводит правила в сообщение API.
+func rulesToProto(rules []storage.Rule) []*genv1.Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	result := make([]*genv1.Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, &genv1.Rule{
+			UserAgent: rule.UserAgent,
+			Language:  rule.Language,
+			Country:   rule.Country,
+			Query:     rule.Query,
+			Url:       rule.Url,
+		})
+	}
+	return result
+}
+
+// timeToProto возвращает nil для нулевого времени.
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timeFromProto возвращает нулевое время для пустого значения.
+func timeFromProto(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
+
+// destinationsFromProto переводит варианты из сообщения API. Счетчики переходов не принимаются.
+func destinationsFromProto(destinations []*genv1.Destination) []storage.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	result := make([]storage.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		result = append(result, storage.Destination{
+			Url:    destination.Url,
+			Weight: int(destination.Weight),
+		})
+	}
+	return result
+}
+
+// destinationsToProto переводит варианты в сообщение API.
+func destinationsToProto(destinations []storage.Destination) []*genv1.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	result := make([]*genv1.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		result = append(result, &genv1.Destination{
+			Url:    destination.Url,
+			Weight: int32(destination.Weight),
+			Clicks: destination.Clicks,
+		})
+	}
+	return result
+}
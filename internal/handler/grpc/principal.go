@@ -0,0 +1,45 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/lib/principal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// withPrincipal добавляет в контекст вызывающего по проверенному сертификату клиента mTLS.
+func withPrincipal(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	caller, ok := principal.FromConnectionState(tlsInfo.State)
+	if !ok {
+		return ctx
+	}
+	return principal.NewContext(ctx, caller)
+}
+
+// PrincipalInterceptor делает вызывающего mTLS доступным через principal.FromContext.
+func PrincipalInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withPrincipal(ctx), req)
+}
+
+// PrincipalStreamInterceptor то же для потоков.
+func PrincipalStreamInterceptor(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &principalStream{ServerStream: stream, ctx: withPrincipal(stream.Context())})
+}
+
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *principalStream) Context() context.Context {
+	return s.ctx
+}
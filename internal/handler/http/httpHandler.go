@@ -0,0 +1,360 @@
+package httphandler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/lib/principal"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// visitorCookie закрепляет за посетителем вариант A/B разделения.
+const (
+	visitorCookie       = "vid"
+	visitorCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// previewSuffix после alias запрашивает страницу предпросмотра вместо перехода
+const previewSuffix = "+"
+
+// maxFormSize предел тела формы пароля
+const maxFormSize = 4096
+
+// qrMaxAge время кэширования QR кода клиентом, в секундах.
+// Код зависит только от адреса ссылки и параметров, поэтому кэшируется надолго.
+const qrMaxAge = 24 * 60 * 60
+
+// ServiceProvider операции сервиса, нужные для переходов по коротким ссылкам.
+type ServiceProvider interface {
+	GetUrl(ctx context.Context, domain, alias string, rc service.RequestContext) (storage.Link, error)
+	GetQrCode(ctx context.Context, domain, alias string, opts qrcode.Options) ([]byte, error)
+}
+
+type HttpHandler struct {
+	Service ServiceProvider
+
+	// TrustForwarded брать IP клиента из X-Forwarded-For.
+	// Включается только за доверенным прокси, иначе заголовок подделывается.
+	TrustForwarded bool
+}
+
+func New(service ServiceProvider) *HttpHandler {
+	return &HttpHandler{
+		Service: service,
+	}
+}
+
+// Routes возвращает маршруты HTTP сервера.
+func (h *HttpHandler) Routes() http.Handler {
+	mux := http.NewServeMux()
+	// /{alias}+ - страница предпросмотра
+	mux.HandleFunc("GET /{alias}", h.Redirect)
+	// отправка формы пароля и подтверждение перехода со страницы предпросмотра
+	mux.HandleFunc("POST /{alias}", h.Redirect)
+	// путь после alias переносится в адрес у ссылок с ForwardPath
+	// или заполняет подстановки у шаблонов: /docs/{version}
+	mux.HandleFunc("GET /{alias}/{path...}", h.Redirect)
+	mux.HandleFunc("POST /{alias}/{path...}", h.Redirect)
+	// точный маршрут важнее маршрута с путем, поэтому путь /qr не переносится
+	mux.HandleFunc("GET /{alias}/qr", h.QrCode)
+	return withPrincipal(mux)
+}
+
+// withPrincipal делает вызывающего mTLS доступным через principal.FromContext.
+func withPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			if caller, ok := principal.FromConnectionState(*r.TLS); ok {
+				r = r.WithContext(principal.NewContext(r.Context(), caller))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Redirect перенаправляет на Url ссылки. Домен определяется по заголовку Host.
+// Для /{alias}+ и ссылок с предпросмотром вместо перехода показывается страница с Url.
+func (h *HttpHandler) Redirect(w http.ResponseWriter, r *http.Request) {
+	const op = "httphandler.Redirect"
+
+	alias := r.PathValue("alias")
+	domain := hostDomain(r.Host)
+
+	rc, newVisitor := h.requestContext(r)
+	alias, rc.Preview = strings.CutSuffix(alias, previewSuffix)
+	if alias == "" {
+		http.NotFound(w, r)
+		return
+	}
+	rc.Path = pathSuffix(r)
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		rc.Password = r.PostFormValue("password")
+		rc.Confirmed = r.PostFormValue("confirm") != ""
+	}
+
+	link, err := h.Service.GetUrl(r.Context(), domain, alias, rc)
+	if err != nil {
+		log.Printf("%s: domain='%s', alias='%s'. %v", op, domain, alias, err)
+		switch {
+		case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrUnknownDomain):
+			http.NotFound(w, r)
+		case errors.Is(err, service.ErrPasswordNeeded):
+			renderPasswordForm(w, "")
+		case errors.Is(err, service.ErrWrongPassword):
+			renderPasswordForm(w, "Неверный пароль")
+		case errors.Is(err, service.ErrExhausted):
+			http.Error(w, "Ссылка больше недоступна: использования исчерпаны", http.StatusGone)
+		case errors.Is(err, service.ErrBadPath), errors.Is(err, service.ErrBadTemplateValue):
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		case errors.Is(err, service.ErrDisabled):
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+		case errors.Is(err, service.ErrMaliciousUrl):
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// cookie нужна только ссылкам с вариантами, остальным посетителям не выдается
+	if newVisitor && len(link.Destinations) > 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     visitorCookie,
+			Value:    rc.VisitorID,
+			Path:     "/",
+			MaxAge:   visitorCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	if service.NeedsPreview(link, rc) {
+		// подтверждение уходит на тот же путь и query, но без "+"
+		action := "/" + url.PathEscape(alias) + rc.Path
+		if r.URL.RawQuery != "" {
+			action += "?" + r.URL.RawQuery
+		}
+		renderPreview(w, action, link)
+		return
+	}
+
+	// 302, чтобы браузер не кэшировал переход и каждое обращение доходило до сервиса.
+	// После формы пароля 303, чтобы переход шел GET запросом.
+	code := http.StatusFound
+	if r.Method == http.MethodPost {
+		code = http.StatusSeeOther
+	}
+	http.Redirect(w, r, link.Url, code)
+}
+
+// QrCode отдает QR код короткой ссылки.
+// Параметры изображения берутся из query: format, size, level, margin, fg, bg.
+func (h *HttpHandler) QrCode(w http.ResponseWriter, r *http.Request) {
+	const op = "httphandler.QrCode"
+
+	alias := r.PathValue("alias")
+	domain := hostDomain(r.Host)
+
+	opts, err := qrOptions(r)
+	if err != nil {
+		log.Printf("%s: domain='%s', alias='%s'. %v", op, domain, alias, err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	image, err := h.Service.GetQrCode(r.Context(), domain, alias, opts)
+	if err != nil {
+		log.Printf("%s: domain='%s', alias='%s'. %v", op, domain, alias, err)
+		switch {
+		case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrUnknownDomain):
+			http.NotFound(w, r)
+		case errors.Is(err, service.ErrDisabled):
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+		case errors.Is(err, service.ErrBadQrOptions):
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		case errors.Is(err, service.ErrQrUnavailable):
+			http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		default:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(qrMaxAge))
+	_, _ = w.Write(image)
+}
+
+// qrOptions разбирает параметры QR кода из query. Пустые параметры - значения по умолчанию.
+func qrOptions(r *http.Request) (qrcode.Options, error) {
+	q := r.URL.Query()
+	opts := qrcode.Options{
+		Format: qrcode.Format(q.Get("format")),
+		Level:  qrcode.Level(q.Get("level")),
+	}
+	if opts.Format == "" {
+		opts.Format = qrcode.FormatPNG
+	}
+
+	var err error
+	if v := q.Get("size"); v != "" {
+		if opts.Size, err = strconv.Atoi(v); err != nil {
+			return opts, qrcode.ErrBadOptions
+		}
+	}
+	if v := q.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, qrcode.ErrBadOptions
+		}
+		opts.Margin = &margin
+	}
+	if v := q.Get("fg"); v != "" {
+		if opts.Foreground, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := q.Get("bg"); v != "" {
+		if opts.Background, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Ссылка защищена паролем</title></head>
+<body>
+<form method="post">
+<p>Ссылка защищена паролем</p>
+{{if .}}<p>{{.}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Перейти</button>
+</form>
+</body>
+</html>
+`))
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Переход по ссылке</title></head>
+<body>
+{{if .Url}}<p>Ссылка ведет на</p>{{else}}<p>Адрес откроется после перехода: число переходов по ссылке ограничено</p>{{end}}
+{{with .Page.SiteName}}<p>{{.}}</p>{{end}}
+{{with .Title}}<h1>{{.}}</h1>{{end}}
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{with .Url}}<p><code>{{.}}</code></p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="confirm" value="1">
+{{if .Protected}}<input type="password" name="password" placeholder="Пароль" autocomplete="off" required>{{end}}
+<button type="submit">Продолжить</button>
+</form>
+</body>
+</html>
+`))
+
+// renderPreview отвечает страницей предпросмотра. Переход подтверждается
+// отправкой формы на action. Пароль защищенной ссылки вводится в форме повторно:
+// страница не содержит введенный ранее пароль, чтобы он не оставался в кэше и истории.
+// Картинка страницы не показывается, чтобы предпросмотр не обращался к ее сайту.
+func renderPreview(w http.ResponseWriter, action string, link storage.Link) {
+	title, description := link.Page.Title, link.Page.Description
+	if link.Title != "" {
+		title, description = link.Title, link.Description
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = previewPage.Execute(w, struct {
+		Action, Url, Title, Description string
+		Protected                       bool
+		Page                            storage.Page
+	}{
+		Action:      action,
+		Url:         link.Url,
+		Title:       title,
+		Description: description,
+		Protected:   link.PasswordHash != "",
+		Page:        link.Page,
+	})
+}
+
+// renderPasswordForm отвечает 401 с формой ввода пароля.
+func renderPasswordForm(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = passwordForm.Execute(w, message)
+}
+
+// requestContext собирает сведения о клиенте для правил перехода.
+// newVisitor - идентификатор посетителя создан и его нужно выдать в cookie.
+func (h *HttpHandler) requestContext(r *http.Request) (rc service.RequestContext, newVisitor bool) {
+	rc = service.RequestContext{
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.Query(),
+	}
+
+	if cookie, err := r.Cookie(visitorCookie); err == nil && cookie.Value != "" {
+		rc.VisitorID = cookie.Value
+	} else if id, err := newVisitorID(); err == nil {
+		// без идентификатора посетитель определяется по IP и User-Agent
+		rc.VisitorID, newVisitor = id, true
+	}
+
+	if h.TrustForwarded {
+		// первый адрес в цепочке - исходный клиент
+		first, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ",")
+		if ip, err := netip.ParseAddr(strings.TrimSpace(first)); err == nil {
+			rc.ClientIP = ip.Unmap()
+			return rc, newVisitor
+		}
+	}
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		rc.ClientIP = addrPort.Addr().Unmap()
+	}
+
+	return rc, newVisitor
+}
+
+// newVisitorID возвращает случайный идентификатор посетителя.
+func newVisitorID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// pathSuffix возвращает экранированный путь запроса после alias, например "/a/b".
+// Одиночный "/" не считается путем.
+func pathSuffix(r *http.Request) string {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	_, suffix, found := strings.Cut(escaped, "/")
+	if !found || suffix == "" {
+		return ""
+	}
+	return "/" + suffix
+}
+
+// hostDomain возвращает имя домена из заголовка Host без порта.
+func hostDomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
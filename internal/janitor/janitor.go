@@ -0,0 +1,206 @@
+package janitor
+
+import (
+	"context"
+	"expvar"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"log"
+	"time"
+)
+
+// lockName имя блокировки, по которой проход выполняет только одна реплика.
+const lockName = "url-shortener:janitor"
+
+// metrics счетчики уборщика, публикуются через expvar (/debug/vars).
+var (
+	metrics = expvar.NewMap("janitor")
+	lastRun expvar.Int // unix время последнего выполненного прохода
+)
+
+func init() {
+	metrics.Set("last_run_unix", &lastRun)
+}
+
+// Purger операции очистки, которые выполняет уборщик.
+type Purger interface {
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error)
+}
+
+// ChangePurger реализуется, если сервис ведет журнал изменений ссылок.
+type ChangePurger interface {
+	PurgeChanges(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// Config параметры очистки.
+type Config struct {
+	Interval  time.Duration // период проходов, 0 - уборщик выключен
+	BatchSize int           // сколько ссылок удаляется за один запрос
+	DryRun    bool          // только считать подходящие ссылки
+	// StaleAfter срок без обращений, после которого ссылка удаляется. 0 - не удалять.
+	StaleAfter time.Duration
+	// DeletedRetention срок хранения мягко удаленных ссылок. 0 - не очищать.
+	DeletedRetention time.Duration
+	// ChangeRetention срок хранения журнала изменений ссылок. 0 - не очищать.
+	ChangeRetention time.Duration
+}
+
+// Report итог одного прохода.
+type Report struct {
+	Expired int64 // истекшие ссылки
+	Stale   int64 // ссылки без обращений дольше StaleAfter
+	Deleted int64 // мягко удаленные ссылки старше DeletedRetention
+	Changes int64 // записи журнала изменений старше ChangeRetention
+	Skipped bool  // проход выполняет другая реплика
+}
+
+// Janitor периодически удаляет истекшие, давно не использованные
+// и мягко удаленные ссылки.
+type Janitor struct {
+	purger Purger
+	locker storage.Locker
+	cfg    Config
+	now    func() time.Time
+}
+
+// New создает уборщика. locker может быть nil, если реплика одна.
+func New(purger Purger, locker storage.Locker, cfg Config) *Janitor {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	return &Janitor{
+		purger: purger,
+		locker: locker,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Run выполняет проходы каждые Interval до отмены ctx.
+// Прерванный отменой проход не продолжается.
+func (j *Janitor) Run(ctx context.Context) {
+	const op = "janitor.Run"
+
+	if j.cfg.Interval <= 0 {
+		return
+	}
+
+	log.Printf("%s: interval='%s' batch=%d dryRun=%t", op, j.cfg.Interval, j.cfg.BatchSize, j.cfg.DryRun)
+
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := j.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("%s: %v", op, err)
+			}
+			if report.Expired+report.Stale+report.Deleted+report.Changes > 0 {
+				verb := "удалено"
+				if j.cfg.DryRun {
+					verb = "к удалению"
+				}
+				log.Printf("%s: %s истекших: %d, неиспользуемых: %d, удаленных: %d, записей журнала: %d",
+					op, verb, report.Expired, report.Stale, report.Deleted, report.Changes)
+			}
+		}
+	}
+}
+
+// RunOnce выполняет один проход. Если блокировку держит другая реплика, проход пропускается.
+func (j *Janitor) RunOnce(ctx context.Context) (Report, error) {
+	var report Report
+
+	if j.locker != nil {
+		unlock, ok, err := j.locker.TryLock(ctx, lockName)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return report, err
+		}
+		if !ok {
+			metrics.Add("skipped", 1)
+			report.Skipped = true
+			return report, nil
+		}
+		defer unlock()
+	}
+
+	metrics.Add("runs", 1)
+	defer func() {
+		lastRun.Set(j.now().Unix())
+	}()
+
+	now := j.now()
+	var err error
+
+	report.Expired, err = j.purgeStale(ctx, storage.PurgeFilter{ExpiredBefore: now})
+	metrics.Add(j.metric("expired"), report.Expired)
+	if err != nil {
+		metrics.Add("errors", 1)
+		return report, err
+	}
+
+	if j.cfg.StaleAfter > 0 {
+		report.Stale, err = j.purgeStale(ctx, storage.PurgeFilter{NotAccessedSince: now.Add(-j.cfg.StaleAfter)})
+		metrics.Add(j.metric("stale"), report.Stale)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return report, err
+		}
+	}
+
+	// у PurgeDeleted нет пробного режима
+	if j.cfg.DeletedRetention > 0 && !j.cfg.DryRun {
+		report.Deleted, err = j.purger.PurgeDeleted(ctx, j.cfg.DeletedRetention)
+		metrics.Add(j.metric("deleted"), report.Deleted)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return report, err
+		}
+	}
+
+	if changes, ok := j.purger.(ChangePurger); ok && j.cfg.ChangeRetention > 0 && !j.cfg.DryRun {
+		report.Changes, err = changes.PurgeChanges(ctx, j.cfg.ChangeRetention)
+		metrics.Add("purged_changes", report.Changes)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// purgeStale удаляет подходящие ссылки пачками по BatchSize, пока пачка заполнена.
+// В пробном режиме ничего не удаляется, поэтому пачки читаются со сдвигом на уже подсчитанные.
+func (j *Janitor) purgeStale(ctx context.Context, filter storage.PurgeFilter) (int64, error) {
+	filter.Limit = j.cfg.BatchSize
+	filter.DryRun = j.cfg.DryRun
+
+	var total int64
+	for {
+		keys, err := j.purger.PurgeStale(ctx, filter)
+		total += int64(len(keys))
+		if err != nil {
+			return total, err
+		}
+		if len(keys) < filter.Limit || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		if filter.DryRun {
+			filter.Offset += len(keys)
+		}
+	}
+}
+
+// metric имя счетчика с учетом пробного режима.
+func (j *Janitor) metric(name string) string {
+	if j.cfg.DryRun {
+		return "dry_run_" + name
+	}
+	return "purged_" + name
+}
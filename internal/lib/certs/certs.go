@@ -0,0 +1,136 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// reloadDelay пауза после последнего изменения файлов перед перечитыванием:
+// сертификат и ключ обычно записываются друг за другом.
+const reloadDelay = 200 * time.Millisecond
+
+// Reloader держит сертификат сервера и CA клиентов и перечитывает их при изменении
+// файлов, поэтому новые соединения получают обновленный сертификат без перезапуска.
+// Если файлы не читаются, остается прежний сертификат.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string // пусто - без mTLS
+
+	config atomic.Pointer[tls.Config]
+}
+
+// NewReloader читает файлы; ошибка, если сертификат или CA клиентов не загружаются.
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает файлы и заменяет настройки для новых соединений.
+func (r *Reloader) Reload() error {
+	const op = "certs.Reload"
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%s: сертификат. %w", op, err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("%s: CA клиентов. %w", op, err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: CA клиентов '%s' без сертификатов", op, r.clientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.config.Store(config)
+	return nil
+}
+
+// TLSConfig возвращает настройки сервера, которые на каждое соединение берут
+// последние загруженные сертификат и CA клиентов.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load(), nil
+		},
+	}
+}
+
+// Watch перечитывает файлы при их изменении до отмены ctx. Следит за каталогами,
+// а не за файлами: при замене файла переименованием или обновлении секрета Kubernetes
+// через симлинк наблюдение за самим файлом теряется.
+func (r *Reloader) Watch(ctx context.Context) error {
+	const op = "certs.Watch"
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer watcher.Close()
+
+	dirs := make(map[string]bool)
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		if err = watcher.Add(dir); err != nil {
+			return fmt.Errorf("%s: каталог '%s'. %w", op, dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("%s: %v", op, err)
+		case <-timer.C:
+			if err = r.Reload(); err != nil {
+				log.Printf("%s: остается прежний сертификат. %v", op, err)
+				continue
+			}
+			log.Printf("%s: сертификат перечитан, cert='%s'", op, r.certFile)
+		}
+	}
+}
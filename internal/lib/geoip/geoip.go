@@ -0,0 +1,46 @@
+package geoip
+
+import (
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// DB определяет страну клиента по локальной базе MaxMind (GeoLite2-Country или GeoIP2-Country).
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// record поля записи базы, нужные для определения страны.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func Open(path string) (*DB, error) {
+	const op = "geoip.Open"
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: path='%s'. %w", op, path, err)
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Country возвращает ISO код страны в верхнем регистре. Пусто, если адрес не найден в базе.
+func (d *DB) Country(ip netip.Addr) (string, error) {
+	const op = "geoip.Country"
+
+	var rec record
+	if err := d.reader.Lookup(net.IP(ip.Unmap().AsSlice()), &rec); err != nil {
+		return "", fmt.Errorf("%s: ip='%s'. %w", op, ip, err)
+	}
+	return strings.ToUpper(rec.Country.ISOCode), nil
+}
+
+func (d *DB) Close() error {
+	return d.reader.Close()
+}
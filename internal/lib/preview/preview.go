@@ -0,0 +1,188 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBadResponse = errors.New("ошибка: страница недоступна")
+	ErrNotHTML     = errors.New("ошибка: страница не является HTML")
+	ErrPrivateAddr = errors.New("ошибка: адрес во внутренней сети")
+)
+
+// maxBodySize сколько читается от страницы: сведения берутся только из <head>.
+const maxBodySize = 512 << 10
+
+// Fetcher читает заголовок и OpenGraph теги страницы.
+type Fetcher struct {
+	client *http.Client
+}
+
+// NewFetcher возвращает Fetcher с клиентом client.
+// nil - клиент, который не обращается к адресам внутренней сети, см. SafeClient.
+func NewFetcher(client *http.Client) *Fetcher {
+	if client == nil {
+		client = SafeClient(5 * time.Second)
+	}
+	return &Fetcher{client: client}
+}
+
+// SafeClient возвращает HTTP клиент, который отказывается соединяться с loopback,
+// частными и link-local адресами: Url ссылок задают пользователи, и сервер
+// не должен ходить по их просьбе во внутреннюю сеть. Адрес проверяется после
+// разрешения имени, поэтому переадресации и DNS записи проверку не обходят.
+func SafeClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return fmt.Errorf("%s: %w", address, ErrPrivateAddr)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// Fetch загружает страницу urlStr и возвращает сведения из ее <head>.
+// OpenGraph теги имеют приоритет над <title> и <meta name="description">.
+func (f *Fetcher) Fetch(ctx context.Context, urlStr string) (storage.Page, error) {
+	const op = "preview.Fetch"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return storage.Page{}, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "url-shortener-preview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return storage.Page{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return storage.Page{}, fmt.Errorf("%s: status=%d. %w", op, resp.StatusCode, ErrBadResponse)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return storage.Page{}, fmt.Errorf("%s: content-type='%s'. %w", op, mediaType, ErrNotHTML)
+	}
+
+	// относительные адреса картинок считаются от страницы после переадресаций
+	return parseHead(io.LimitReader(resp.Body, maxBodySize), resp.Request.URL), nil
+}
+
+// parseHead читает теги до конца <head> или начала <body>.
+func parseHead(r io.Reader, base *url.URL) storage.Page {
+	var page, og storage.Page
+	z := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return mergePage(og, page, base)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Head:
+				return mergePage(og, page, base)
+			case atom.Title:
+				inTitle = false
+			}
+		case html.TextToken:
+			if inTitle && page.Title == "" {
+				page.Title = strings.TrimSpace(string(z.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				return mergePage(og, page, base)
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			case atom.Meta:
+				if !hasAttr {
+					continue
+				}
+				attrs := make(map[string]string)
+				for {
+					key, val, more := z.TagAttr()
+					attrs[string(key)] = string(val)
+					if !more {
+						break
+					}
+				}
+				content := strings.TrimSpace(attrs["content"])
+				switch strings.ToLower(attrs["property"]) {
+				case "og:title":
+					og.Title = content
+				case "og:description":
+					og.Description = content
+				case "og:image":
+					og.Image = content
+				case "og:site_name":
+					og.SiteName = content
+				}
+				if strings.EqualFold(attrs["name"], "description") {
+					page.Description = content
+				}
+			}
+		}
+	}
+}
+
+// mergePage дополняет OpenGraph сведения обычными тегами страницы.
+func mergePage(og, page storage.Page, base *url.URL) storage.Page {
+	if og.Title == "" {
+		og.Title = page.Title
+	}
+	if og.Description == "" {
+		og.Description = page.Description
+	}
+	og.Image = absoluteUrl(og.Image, base)
+	return og
+}
+
+// absoluteUrl возвращает абсолютный http(s) адрес или пусто.
+func absoluteUrl(ref string, base *url.URL) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
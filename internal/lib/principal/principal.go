@@ -0,0 +1,61 @@
+package principal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// Principal вызывающий, подтвержденный сертификатом клиента mTLS.
+// Проверки доступа берут его из контекста запроса через FromContext.
+type Principal struct {
+	CommonName string   // CN субъекта сертификата
+	DNSNames   []string // SAN
+	URIs       []string // SAN, например SPIFFE ID
+	Emails     []string // SAN
+	Serial     string   // серийный номер сертификата в десятичном виде
+}
+
+// ID возвращает основное имя вызывающего: первый URI SAN, иначе CN.
+func (p Principal) ID() string {
+	if len(p.URIs) > 0 {
+		return p.URIs[0]
+	}
+	return p.CommonName
+}
+
+// FromCertificate собирает вызывающего из сертификата клиента.
+func FromCertificate(cert *x509.Certificate) Principal {
+	p := Principal{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+		Serial:     cert.SerialNumber.String(),
+	}
+	for _, uri := range cert.URIs {
+		p.URIs = append(p.URIs, uri.String())
+	}
+	return p
+}
+
+// FromConnectionState возвращает вызывающего по TLS соединению. ok=false, если
+// сертификат клиента не передан или не проверен по CA клиентов.
+func FromConnectionState(state tls.ConnectionState) (Principal, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Principal{}, false
+	}
+	return FromCertificate(state.VerifiedChains[0][0]), true
+}
+
+type contextKey struct{}
+
+// NewContext возвращает контекст с вызывающим p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext возвращает вызывающего запроса. ok=false - запрос без сертификата клиента.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,68 @@
+package qrcode
+
+import (
+	"container/list"
+	"sync"
+)
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+// Cache хранит последние size изображений вложенного Renderer.
+// Ключ - содержимое кода и параметры, поэтому у каждой ссылки и набора параметров своя запись.
+// Ошибки не кэшируются.
+type Cache struct {
+	next Renderer
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // в начале - недавно использованные
+	entries map[string]*list.Element
+}
+
+func NewCache(next Renderer, size int) *Cache {
+	return &Cache{
+		next:    next,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *Cache) Render(content string, opts Options) ([]byte, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	key := content + "|" + opts.Key()
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		data := el.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return data, nil
+	}
+	c.mu.Unlock()
+
+	data, err := c.next.Render(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && c.size > 0 {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, data: data})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,261 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+var ErrBadOptions = errors.New("ошибка: невалидные параметры QR кода")
+
+// Format формат изображения.
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+// ContentType возвращает MIME тип формата.
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Level уровень коррекции ошибок: доля кода, которую можно повредить без потери данных.
+type Level string
+
+const (
+	LevelLow     Level = "L" // 7%
+	LevelMedium  Level = "M" // 15%
+	LevelQuarter Level = "Q" // 25%
+	LevelHigh    Level = "H" // 30%
+)
+
+var recoveryLevels = map[Level]qrcode.RecoveryLevel{
+	LevelLow:     qrcode.Low,
+	LevelMedium:  qrcode.Medium,
+	LevelQuarter: qrcode.High,
+	LevelHigh:    qrcode.Highest,
+}
+
+// Ограничения и значения по умолчанию
+const (
+	DefaultSize   = 256
+	DefaultMargin = 4 // рекомендованная стандартом тихая зона
+	minSize       = 64
+	maxSize       = 2048
+	maxMargin     = 16
+)
+
+// Options параметры изображения. Нулевые значения заменяются значениями по умолчанию.
+type Options struct {
+	Format     Format
+	Size       int // сторона изображения в пикселях
+	Level      Level
+	Margin     *int // поле в модулях, nil - DefaultMargin
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// Renderer рисует QR код с content.
+type Renderer interface {
+	Render(content string, opts Options) ([]byte, error)
+}
+
+// Encoder рисует QR коды локально, без внешних сервисов.
+type Encoder struct{}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Normalize проверяет параметры и заполняет значения по умолчанию.
+func (o Options) Normalize() (Options, error) {
+	if o.Format == "" {
+		o.Format = FormatPNG
+	}
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return o, ErrBadOptions
+	}
+
+	if o.Size == 0 {
+		o.Size = DefaultSize
+	}
+	if o.Size < minSize || o.Size > maxSize {
+		return o, ErrBadOptions
+	}
+
+	if o.Level == "" {
+		o.Level = LevelMedium
+	}
+	o.Level = Level(strings.ToUpper(string(o.Level)))
+	if _, ok := recoveryLevels[o.Level]; !ok {
+		return o, ErrBadOptions
+	}
+
+	margin := DefaultMargin
+	if o.Margin != nil {
+		margin = *o.Margin
+	}
+	if margin < 0 || margin > maxMargin {
+		return o, ErrBadOptions
+	}
+	o.Margin = &margin
+
+	if o.Foreground == (color.RGBA{}) {
+		o.Foreground = color.RGBA{A: 0xff}
+	}
+	if o.Background == (color.RGBA{}) {
+		o.Background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+	if o.Foreground == o.Background {
+		return o, ErrBadOptions
+	}
+
+	return o, nil
+}
+
+// Key возвращает строку, однозначно описывающую параметры, для ключа кэша.
+func (o Options) Key() string {
+	margin := DefaultMargin
+	if o.Margin != nil {
+		margin = *o.Margin
+	}
+	return fmt.Sprintf("%s|%d|%s|%d|%s|%s", o.Format, o.Size, o.Level, margin, hexColor(o.Foreground), hexColor(o.Background))
+}
+
+func (e *Encoder) Render(content string, opts Options) ([]byte, error) {
+	const op = "qrcode.Render"
+
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, recoveryLevels[opts.Level])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// тихая зона рисуется сама, чтобы поле задавалось в модулях
+	code.DisableBorder = true
+
+	modules := withMargin(code.Bitmap(), *opts.Margin)
+	if opts.Format == FormatSVG {
+		return renderSVG(modules, opts), nil
+	}
+
+	data, err := renderPNG(modules, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// withMargin окружает матрицу модулей полем шириной margin.
+func withMargin(bitmap [][]bool, margin int) [][]bool {
+	n := len(bitmap) + 2*margin
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+margin][margin:], row)
+	}
+	return modules
+}
+
+// renderPNG рисует модули целым числом пикселей и центрирует код,
+// чтобы края модулей не размывались при масштабировании.
+func renderPNG(modules [][]bool, opts Options) ([]byte, error) {
+	n := len(modules)
+	scale := max(opts.Size/n, 1)
+	size := max(opts.Size, n*scale)
+	offset := (size - n*scale) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				start := img.PixOffset(offset+x*scale, offset+y*scale+dy)
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[start+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG рисует модули одним path в координатах модулей.
+func renderSVG(modules [][]bool, opts Options) []byte {
+	n := len(modules)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"%s/>`, n, n, hexColor(opts.Background), opacity(opts.Background))
+
+	fmt.Fprintf(&buf, `<path fill="%s"%s d="`, hexColor(opts.Foreground), opacity(opts.Foreground))
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// соседние темные модули строки склеиваются в один прямоугольник
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
+
+// ParseColor разбирает цвет в виде RRGGBB или RRGGBBAA, с # или без.
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.RGBA{}, ErrBadOptions
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrBadOptions
+	}
+	if len(s) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// opacity возвращает атрибут прозрачности для SVG, если цвет не непрозрачный.
+func opacity(c color.RGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+}
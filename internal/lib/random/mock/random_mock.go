@@ -5,8 +5,10 @@
 package mock_service
 
 import (
+	context "context"
 	reflect "reflect"
 
+	scanner "github.com/RVodassa/url-shortener/internal/lib/scanner"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -47,3 +49,76 @@ func (mr *MockRandomProviderMockRecorder) RandomString(arg0 interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RandomString", reflect.TypeOf((*MockRandomProvider)(nil).RandomString), arg0)
 }
+
+// MockURLScanner is a mock of URLScanner interface.
+type MockURLScanner struct {
+	ctrl     *gomock.Controller
+	recorder *MockURLScannerMockRecorder
+}
+
+// MockURLScannerMockRecorder is the mock recorder for MockURLScanner.
+type MockURLScannerMockRecorder struct {
+	mock *MockURLScanner
+}
+
+// NewMockURLScanner creates a new mock instance.
+func NewMockURLScanner(ctrl *gomock.Controller) *MockURLScanner {
+	mock := &MockURLScanner{ctrl: ctrl}
+	mock.recorder = &MockURLScannerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockURLScanner) EXPECT() *MockURLScannerMockRecorder {
+	return m.recorder
+}
+
+// Scan mocks base method.
+func (m *MockURLScanner) Scan(ctx context.Context, urlStr string) (scanner.Verdict, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scan", ctx, urlStr)
+	ret0, _ := ret[0].(scanner.Verdict)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Scan indicates an expected call of Scan.
+func (mr *MockURLScannerMockRecorder) Scan(ctx, urlStr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockURLScanner)(nil).Scan), ctx, urlStr)
+}
+
+// MockAccessTracker is a mock of AccessTracker interface.
+type MockAccessTracker struct {
+	ctrl     *gomock.Controller
+	recorder *MockAccessTrackerMockRecorder
+}
+
+// MockAccessTrackerMockRecorder is the mock recorder for MockAccessTracker.
+type MockAccessTrackerMockRecorder struct {
+	mock *MockAccessTracker
+}
+
+// NewMockAccessTracker creates a new mock instance.
+func NewMockAccessTracker(ctrl *gomock.Controller) *MockAccessTracker {
+	mock := &MockAccessTracker{ctrl: ctrl}
+	mock.recorder = &MockAccessTrackerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAccessTracker) EXPECT() *MockAccessTrackerMockRecorder {
+	return m.recorder
+}
+
+// Track mocks base method.
+func (m *MockAccessTracker) Track(alias string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Track", alias)
+}
+
+// Track indicates an expected call of Track.
+func (mr *MockAccessTrackerMockRecorder) Track(alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Track", reflect.TypeOf((*MockAccessTracker)(nil).Track), alias)
+}
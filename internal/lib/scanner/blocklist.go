@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blocklist проверяет Url по локальному файлу.
+// Каждая строка файла — домен (блокируется вместе с поддоменами) или префикс Url со схемой.
+// Пустые строки и строки, начинающиеся с '#', пропускаются.
+// Файл перечитывается при изменении, поэтому новые записи применяются без перезапуска.
+type Blocklist struct {
+	path string
+
+	mu       sync.RWMutex
+	modTime  time.Time
+	hosts    map[string]struct{}
+	prefixes []string
+}
+
+func NewBlocklist(path string) (*Blocklist, error) {
+	const op = "scanner.NewBlocklist"
+
+	b := &Blocklist{path: path}
+	if err := b.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return b, nil
+}
+
+// Scan проверяет Url по списку блокировки.
+func (b *Blocklist) Scan(ctx context.Context, urlStr string) (Verdict, error) {
+	const op = "scanner.Blocklist.Scan"
+
+	if err := b.reload(); err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	parsedUrl, err := url.Parse(urlStr)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: url='%s'. %w", op, urlStr, err)
+	}
+	host := strings.ToLower(parsedUrl.Hostname())
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for h := host; h != ""; {
+		if _, ok := b.hosts[h]; ok {
+			return Verdict{Malicious: true, Reason: "blocklist: " + h}, nil
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			break
+		}
+		h = h[i+1:]
+	}
+
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(urlStr, prefix) {
+			return Verdict{Malicious: true, Reason: "blocklist: " + prefix}, nil
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+// reload перечитывает файл, если он изменился с последней загрузки.
+func (b *Blocklist) reload() error {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	actual := info.ModTime().Equal(b.modTime) && b.hosts != nil
+	b.mu.RUnlock()
+	if actual {
+		return nil
+	}
+
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hosts := make(map[string]struct{})
+	var prefixes []string
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			prefixes = append(prefixes, line)
+			continue
+		}
+		hosts[strings.ToLower(line)] = struct{}{}
+	}
+	if err = sc.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.hosts = hosts
+	b.prefixes = prefixes
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+
+	return nil
+}
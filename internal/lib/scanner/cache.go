@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries предел записей кэша; при переполнении вытесняются давно использованные.
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	url       string
+	verdict   Verdict
+	expiresAt time.Time
+}
+
+// Cache кэширует вердикты вложенного сканера на ttl, храня не больше maxCacheEntries
+// последних использованных Url. Ошибки не кэшируются.
+type Cache struct {
+	next Scanner
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // в начале - недавно использованные
+	entries map[string]*list.Element
+}
+
+func NewCache(next Scanner, ttl time.Duration) *Cache {
+	return &Cache{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *Cache) Scan(ctx context.Context, urlStr string) (Verdict, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	if el, ok := c.entries[urlStr]; ok {
+		entry := el.Value.(*cacheEntry)
+		if now.Before(entry.expiresAt) {
+			c.order.MoveToFront(el)
+			verdict := entry.verdict
+			c.mu.Unlock()
+			return verdict, nil
+		}
+		c.order.Remove(el)
+		delete(c.entries, urlStr)
+	}
+	c.mu.Unlock()
+
+	verdict, err := c.next.Scan(ctx, urlStr)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{url: urlStr, verdict: verdict, expiresAt: now.Add(c.ttl)}
+	if el, ok := c.entries[urlStr]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return verdict, nil
+	}
+	c.entries[urlStr] = c.order.PushFront(entry)
+	if c.order.Len() > maxCacheEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).url)
+	}
+
+	return verdict, nil
+}
@@ -0,0 +1,19 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrBadResponse = errors.New("ошибка: некорректный ответ сервиса проверки")
+
+// Verdict результат проверки Url.
+type Verdict struct {
+	Malicious bool   `json:"malicious"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Scanner проверяет Url по сервису репутации.
+type Scanner interface {
+	Scan(ctx context.Context, urlStr string) (Verdict, error)
+}
@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Webhook проверяет Url через внешний HTTP сервис репутации.
+// Запрос: POST {"url": "..."}, ожидаемый ответ: 200 {"malicious": bool, "reason": "..."}.
+type Webhook struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewWebhook(endpoint string, client *http.Client) *Webhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Webhook{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+type webhookRequest struct {
+	Url string `json:"url"`
+}
+
+// Scan отправляет Url на проверку.
+func (w *Webhook) Scan(ctx context.Context, urlStr string) (Verdict, error) {
+	const op = "scanner.Webhook.Scan"
+
+	body, err := json.Marshal(webhookRequest{Url: urlStr})
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("%s: status=%d. %w", op, resp.StatusCode, ErrBadResponse)
+	}
+
+	var verdict Verdict
+	if err = json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w: %v", op, ErrBadResponse, err)
+	}
+
+	return verdict, nil
+}
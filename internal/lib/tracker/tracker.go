@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// FlushFunc сохраняет накопленные обращения.
+type FlushFunc func(ctx context.Context, accessed map[storage.Key]storage.Access) error
+
+// syncFlushTimeout срок сохранения обращения, если сброс не накапливается (interval <= 0),
+// и последнего сброса в этом режиме.
+const syncFlushTimeout = 5 * time.Second
+
+// Tracker копит обращения к ссылкам в памяти и периодически сбрасывает их одной пачкой,
+// чтобы GetUrl не делал запись в хранилище на каждый переход.
+// Повторные обращения к одной ссылке между сбросами схлопываются в одно,
+// переходы по вариантам суммируются. interval <= 0 - каждое обращение сохраняется сразу.
+type Tracker struct {
+	flush    FlushFunc
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[storage.Key]storage.Access
+}
+
+func New(flush FlushFunc, interval time.Duration) *Tracker {
+	return &Tracker{
+		flush:    flush,
+		interval: interval,
+		now:      time.Now,
+		pending:  make(map[storage.Key]storage.Access),
+	}
+}
+
+// Track отмечает обращение к ссылке и переход на вариант variant.
+// variant < 0 - ссылка без вариантов. Не блокируется на хранилище, если interval > 0.
+func (t *Tracker) Track(key storage.Key, variant int) {
+	t.add(key, variant)
+
+	if t.interval <= 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), syncFlushTimeout)
+		defer cancel()
+		t.Flush(ctx)
+	}
+}
+
+// add добавляет обращение в очередь сброса.
+func (t *Tracker) add(key storage.Key, variant int) {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	access := t.pending[key]
+	access.At = now
+	if variant >= 0 {
+		if access.Clicks == nil {
+			access.Clicks = make(map[int]int64)
+		}
+		access.Clicks[variant]++
+	}
+	t.pending[key] = access
+}
+
+// Run сбрасывает накопленные обращения каждые interval до отмены ctx,
+// после чего делает последний сброс. При interval <= 0 обращения сохраняет Track,
+// а Run только повторяет на выходе неудавшиеся сбросы.
+func (t *Tracker) Run(ctx context.Context) {
+	timeout := syncFlushTimeout
+	var tick <-chan time.Time
+	if t.interval > 0 {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		tick, timeout = ticker.C, t.interval
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// последний сброс не должен зависеть от отмененного контекста
+			flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			t.Flush(flushCtx)
+			cancel()
+			return
+		case <-tick:
+			t.Flush(ctx)
+		}
+	}
+}
+
+// Flush сохраняет накопленные обращения. При ошибке они возвращаются в очередь.
+func (t *Tracker) Flush(ctx context.Context) {
+	const op = "tracker.Flush"
+
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	batch := t.pending
+	t.pending = make(map[storage.Key]storage.Access, len(batch))
+	t.mu.Unlock()
+
+	if err := t.flush(ctx, batch); err != nil {
+		log.Printf("%s: обращений: %d. %v", op, len(batch), err)
+
+		t.mu.Lock()
+		for key, failed := range batch {
+			access := t.pending[key]
+			if access.At.Before(failed.At) {
+				access.At = failed.At
+			}
+			for variant, clicks := range failed.Clicks {
+				if access.Clicks == nil {
+					access.Clicks = make(map[int]int64)
+				}
+				access.Clicks[variant] += clicks
+			}
+			t.pending[key] = access
+		}
+		t.mu.Unlock()
+	}
+}
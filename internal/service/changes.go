@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"time"
+)
+
+var (
+	ErrBadOffset          = errors.New("ошибка: невалидная позиция журнала изменений")
+	ErrChangesUnavailable = errors.New("ошибка: журнал изменений не поддерживается хранилищем")
+)
+
+const (
+	defaultWatchInterval = time.Second
+	watchBatch           = 100
+)
+
+// WithChangeFeed подключает журнал изменений ссылок. interval - период опроса
+// журнала, когда новых записей нет.
+func WithChangeFeed(feed storage.ChangeFeed, interval time.Duration) Option {
+	return func(s *Service) {
+		s.Changes = feed
+		s.WatchInterval = interval
+	}
+}
+
+// WatchUrls передает send изменения после offset, пока ctx не отменен или send не вернет ошибку.
+// Каждое изменение несет свою позицию, с которой клиент продолжит после переподключения.
+func (s *Service) WatchUrls(ctx context.Context, offset string, send func(storage.Change) error) error {
+	const op = "service.WatchUrls"
+
+	if s.Changes == nil {
+		return ErrChangesUnavailable
+	}
+
+	interval := s.WatchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		changes, err := s.Changes.ReadChanges(ctx, offset, watchBatch)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, storage.ErrBadOffset) {
+				return ErrBadOffset
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, change := range changes {
+			change.Domain = s.domainName(change.Domain)
+			if err = send(change); err != nil {
+				return err
+			}
+			offset = change.Offset
+		}
+
+		// полная пачка - в журнале, вероятно, есть еще записи
+		if len(changes) == watchBatch {
+			continue
+		}
+
+		timer.Reset(interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// PurgeChanges удаляет записи журнала изменений старше retention.
+// Без журнала ничего не делает.
+func (s *Service) PurgeChanges(ctx context.Context, retention time.Duration) (int64, error) {
+	const op = "service.PurgeChanges"
+
+	if s.Changes == nil {
+		return 0, nil
+	}
+
+	purged, err := s.Changes.PurgeChanges(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return purged, fmt.Errorf("%s: %w", op, err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"hash/fnv"
+)
+
+// Ограничения вариантов A/B разделения
+const (
+	minDestinations = 2
+	maxDestinations = 10
+	maxWeight       = 10000
+)
+
+// normalizeDestinations проверяет варианты и сбрасывает счетчики переходов.
+func normalizeDestinations(destinations []storage.Destination) ([]storage.Destination, error) {
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+	if len(destinations) < minDestinations || len(destinations) > maxDestinations {
+		return nil, ErrBadDestinations
+	}
+
+	normalized := make([]storage.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		if !validUrl(destination.Url) || destination.Weight <= 0 || destination.Weight > maxWeight {
+			return nil, ErrBadDestinations
+		}
+		normalized = append(normalized, storage.Destination{Url: destination.Url, Weight: destination.Weight})
+	}
+
+	return normalized, nil
+}
+
+// pickDestination выбирает вариант по весам. Выбор зависит только от посетителя и ссылки,
+// поэтому посетитель всегда попадает на один и тот же вариант, пока варианты не меняются.
+func pickDestination(link storage.Link, rc RequestContext) int {
+	total := 0
+	for _, destination := range link.Destinations {
+		total += destination.Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(visitorKey(rc)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(link.Domain + "/" + link.Alias))
+	point := int(h.Sum64() % uint64(total))
+
+	for i, destination := range link.Destinations {
+		if point < destination.Weight {
+			return i
+		}
+		point -= destination.Weight
+	}
+	return len(link.Destinations) - 1
+}
+
+// visitorKey идентифицирует посетителя: по VisitorID, а без него по IP и User-Agent.
+func visitorKey(rc RequestContext) string {
+	if rc.VisitorID != "" {
+		return rc.VisitorID
+	}
+
+	ip := ""
+	if rc.ClientIP.IsValid() {
+		ip = rc.ClientIP.String()
+	}
+	return ip + "|" + rc.UserAgent
+}
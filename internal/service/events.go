@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType тип события жизненного цикла ссылки.
+type EventType string
+
+const (
+	EventCreated EventType = "link.created"
+	EventUpdated EventType = "link.updated" // отключение, включение, восстановление
+	EventDeleted EventType = "link.deleted" // удаление, в том числе очистка неиспользуемых
+	EventExpired EventType = "link.expired" // очистка истекшей ссылки
+)
+
+// EventTypes все типы событий.
+var EventTypes = []EventType{EventCreated, EventUpdated, EventDeleted, EventExpired}
+
+// Event событие ссылки. Публикуется после успешной операции хранилища
+// и выводится из журнала изменений, см. ReadEvents.
+type Event struct {
+	ID     string         `json:"id"`
+	Type   EventType      `json:"type"`
+	At     time.Time      `json:"at"`
+	Domain string         `json:"domain,omitempty"` // имя домена, пусто - доменов нет
+	Alias  string         `json:"alias"`
+	Url    string         `json:"url,omitempty"` // только для link.created
+	Status storage.Status `json:"status,omitempty"`
+}
+
+// EventHandler получает события шины.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, event Event) error
+}
+
+// EventBus рассылает события подписчикам синхронно, в порядке подписки.
+// Ошибка подписчика записывается в лог и не влияет на операцию.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe добавляет подписчика.
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish передает событие всем подписчикам.
+func (b *EventBus) Publish(ctx context.Context, event Event) {
+	const op = "service.EventBus.Publish"
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			log.Printf("%s: type='%s' alias='%s'. %v", op, event.Type, event.Alias, err)
+		}
+	}
+}
+
+// emit публикует событие ссылки домена domain в виде, в котором он хранится.
+// Операция уже выполнена, поэтому отмена ctx клиентом событие не теряет.
+func (s *Service) emit(ctx context.Context, eventType EventType, domain, alias string, fill func(*Event)) {
+	if s.Events == nil {
+		return
+	}
+
+	event := Event{
+		ID:     randomHex(16),
+		Type:   eventType,
+		At:     time.Now().UTC(),
+		Domain: s.domainName(domain),
+		Alias:  alias,
+	}
+	if fill != nil {
+		fill(&event)
+	}
+	s.Events.Publish(context.WithoutCancel(ctx), event)
+}
+
+// ReadEvents читает до limit записей журнала изменений после offset и возвращает события,
+// которые они означают, и позицию последней прочитанной записи. Записи без события
+// (исчерпание использований, очистка удаленных ссылок) пропускаются, но позицию сдвигают.
+// Id события выводится из позиции записи, поэтому повторное чтение дает те же id.
+func (s *Service) ReadEvents(ctx context.Context, offset string, limit int) ([]Event, string, error) {
+	const op = "service.ReadEvents"
+
+	if s.Changes == nil {
+		return nil, offset, ErrChangesUnavailable
+	}
+
+	changes, err := s.Changes.ReadChanges(ctx, offset, limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrBadOffset) {
+			return nil, offset, ErrBadOffset
+		}
+		return nil, offset, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var events []Event
+	for _, change := range changes {
+		offset = change.Offset
+		if event, ok := s.changeEvent(change); ok {
+			events = append(events, event)
+		}
+	}
+	return events, offset, nil
+}
+
+// changeEvent переводит запись журнала в событие; ok=false - записи события не соответствует.
+func (s *Service) changeEvent(change storage.Change) (Event, bool) {
+	sum := sha256.Sum256([]byte(change.Offset))
+	event := Event{
+		ID:     hex.EncodeToString(sum[:16]),
+		At:     change.At.UTC(),
+		Domain: s.domainName(change.Domain),
+		Alias:  change.Alias,
+		Status: change.Status,
+	}
+
+	switch change.Op {
+	case storage.ChangeInsert:
+		event.Type = EventCreated
+		event.Url = change.Url
+	case storage.ChangeUpdate:
+		if change.Reason == storage.ReasonExhausted {
+			return Event{}, false
+		}
+		event.Type = EventUpdated
+		if change.Status == storage.StatusDeleted {
+			event.Type = EventDeleted
+		}
+	case storage.ChangeDelete:
+		switch change.Reason {
+		case storage.ReasonPurged:
+			return Event{}, false
+		case storage.ReasonExpired:
+			event.Type = EventExpired
+		default:
+			event.Type = EventDeleted
+		}
+	default:
+		return Event{}, false
+	}
+	return event, true
+}
+
+// randomHex возвращает n случайных байт в hex. Random сервиса выдает alias
+// из своего алфавита, поэтому для id и ключей используется crypto/rand.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxForwardPathLength предел пути, дописываемого к адресу назначения
+const maxForwardPathLength = 1024
+
+// validQueryForward проверяет режим переноса query параметров.
+func validQueryForward(mode storage.QueryForward) bool {
+	switch mode {
+	case storage.QueryForwardOff, storage.QueryForwardMerge, storage.QueryForwardOverride:
+		return true
+	}
+	return false
+}
+
+// forwardUrl переносит путь и query параметры перехода в адрес назначения urlStr
+// по настройкам ссылки. Путь дописывается к пути адреса, фрагмент адреса сохраняется.
+// При совпадении имен параметров ForwardQuery решает, чье значение остается:
+// merge - адреса назначения, override - перехода. Порядок параметров адреса не меняется,
+// новые параметры добавляются в конец по алфавиту.
+func forwardUrl(urlStr string, link storage.Link, rc RequestContext) (string, error) {
+	forwardPath := link.ForwardPath && rc.Path != ""
+	forwardQuery := link.ForwardQuery != storage.QueryForwardOff && len(rc.Query) > 0
+	if !forwardPath && !forwardQuery {
+		return urlStr, nil
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", ErrBadUrl
+	}
+
+	if forwardPath {
+		if err = appendPath(u, rc.Path); err != nil {
+			return "", err
+		}
+	}
+	if forwardQuery {
+		u.RawQuery = mergeQuery(u.RawQuery, rc.Query, link.ForwardQuery == storage.QueryForwardOverride)
+	}
+	return u.String(), nil
+}
+
+// appendPath дописывает экранированный путь suffix к пути u.
+// Сегменты . и .. отклоняются, чтобы путь не выходил за пределы адреса назначения.
+func appendPath(u *url.URL, suffix string) error {
+	if len(suffix) > maxForwardPathLength || !strings.HasPrefix(suffix, "/") {
+		return ErrBadPath
+	}
+	decoded, err := url.PathUnescape(suffix)
+	if err != nil {
+		return ErrBadPath
+	}
+	for _, segment := range strings.Split(decoded, "/") {
+		if segment == "." || segment == ".." {
+			return ErrBadPath
+		}
+	}
+
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + suffix
+	u.Path = strings.TrimSuffix(u.Path, "/") + decoded
+	return nil
+}
+
+// mergeQuery добавляет параметры query к строке запроса rawQuery.
+// override - параметры query заменяют одноименные параметры rawQuery.
+func mergeQuery(rawQuery string, query url.Values, override bool) string {
+	var pairs []string
+	existing := make(map[string]bool)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if override && query.Has(key) {
+			continue
+		}
+		existing[key] = true
+		pairs = append(pairs, pair)
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if !existing[key] {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
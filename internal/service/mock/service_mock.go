@@ -8,6 +8,9 @@ import (
 	context "context"
 	reflect "reflect"
 
+	qrcode "github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	service "github.com/RVodassa/url-shortener/internal/service"
+	storage "github.com/RVodassa/url-shortener/internal/storage"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,46 +37,191 @@ func (m *MockServiceProvider) EXPECT() *MockServiceProviderMockRecorder {
 	return m.recorder
 }
 
+// CreateWebhook mocks base method.
+func (m *MockServiceProvider) CreateWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, webhook)
+	ret0, _ := ret[0].(storage.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockServiceProviderMockRecorder) CreateWebhook(ctx, webhook interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockServiceProvider)(nil).CreateWebhook), ctx, webhook)
+}
+
 // DeleteUrl mocks base method.
-func (m *MockServiceProvider) DeleteUrl(ctx context.Context, alias string) error {
+func (m *MockServiceProvider) DeleteUrl(ctx context.Context, domain, alias string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUrl", ctx, alias)
+	ret := m.ctrl.Call(m, "DeleteUrl", ctx, domain, alias)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUrl indicates an expected call of DeleteUrl.
-func (mr *MockServiceProviderMockRecorder) DeleteUrl(ctx, alias interface{}) *gomock.Call {
+func (mr *MockServiceProviderMockRecorder) DeleteUrl(ctx, domain, alias interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockServiceProvider)(nil).DeleteUrl), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockServiceProvider)(nil).DeleteUrl), ctx, domain, alias)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockServiceProvider) DeleteWebhook(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockServiceProviderMockRecorder) DeleteWebhook(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockServiceProvider)(nil).DeleteWebhook), ctx, id)
+}
+
+// DisableUrl mocks base method.
+func (m *MockServiceProvider) DisableUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableUrl indicates an expected call of DisableUrl.
+func (mr *MockServiceProviderMockRecorder) DisableUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableUrl", reflect.TypeOf((*MockServiceProvider)(nil).DisableUrl), ctx, domain, alias)
+}
+
+// EnableUrl mocks base method.
+func (m *MockServiceProvider) EnableUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableUrl indicates an expected call of EnableUrl.
+func (mr *MockServiceProviderMockRecorder) EnableUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableUrl", reflect.TypeOf((*MockServiceProvider)(nil).EnableUrl), ctx, domain, alias)
+}
+
+// GetQrCode mocks base method.
+func (m *MockServiceProvider) GetQrCode(ctx context.Context, domain, alias string, opts qrcode.Options) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQrCode", ctx, domain, alias, opts)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQrCode indicates an expected call of GetQrCode.
+func (mr *MockServiceProviderMockRecorder) GetQrCode(ctx, domain, alias, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQrCode", reflect.TypeOf((*MockServiceProvider)(nil).GetQrCode), ctx, domain, alias, opts)
 }
 
 // GetUrl mocks base method.
-func (m *MockServiceProvider) GetUrl(ctx context.Context, alias string) (string, error) {
+func (m *MockServiceProvider) GetUrl(ctx context.Context, domain, alias string, rc service.RequestContext) (storage.Link, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUrl", ctx, alias)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "GetUrl", ctx, domain, alias, rc)
+	ret0, _ := ret[0].(storage.Link)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUrl indicates an expected call of GetUrl.
-func (mr *MockServiceProviderMockRecorder) GetUrl(ctx, alias interface{}) *gomock.Call {
+func (mr *MockServiceProviderMockRecorder) GetUrl(ctx, domain, alias, rc interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrl", reflect.TypeOf((*MockServiceProvider)(nil).GetUrl), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrl", reflect.TypeOf((*MockServiceProvider)(nil).GetUrl), ctx, domain, alias, rc)
+}
+
+// GetUrlInfo mocks base method.
+func (m *MockServiceProvider) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUrlInfo", ctx, domain, alias)
+	ret0, _ := ret[0].(storage.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUrlInfo indicates an expected call of GetUrlInfo.
+func (mr *MockServiceProviderMockRecorder) GetUrlInfo(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrlInfo", reflect.TypeOf((*MockServiceProvider)(nil).GetUrlInfo), ctx, domain, alias)
+}
+
+// ListUrls mocks base method.
+func (m *MockServiceProvider) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUrls", ctx, filter)
+	ret0, _ := ret[0].([]storage.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUrls indicates an expected call of ListUrls.
+func (mr *MockServiceProviderMockRecorder) ListUrls(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUrls", reflect.TypeOf((*MockServiceProvider)(nil).ListUrls), ctx, filter)
+}
+
+// ListWebhooks mocks base method.
+func (m *MockServiceProvider) ListWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhooks", ctx)
+	ret0, _ := ret[0].([]storage.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhooks indicates an expected call of ListWebhooks.
+func (mr *MockServiceProviderMockRecorder) ListWebhooks(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhooks", reflect.TypeOf((*MockServiceProvider)(nil).ListWebhooks), ctx)
+}
+
+// RestoreUrl mocks base method.
+func (m *MockServiceProvider) RestoreUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUrl indicates an expected call of RestoreUrl.
+func (mr *MockServiceProviderMockRecorder) RestoreUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUrl", reflect.TypeOf((*MockServiceProvider)(nil).RestoreUrl), ctx, domain, alias)
 }
 
 // SaveUrl mocks base method.
-func (m *MockServiceProvider) SaveUrl(ctx context.Context, UrlStr string) (string, error) {
+func (m *MockServiceProvider) SaveUrl(ctx context.Context, link storage.Link) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveUrl", ctx, UrlStr)
+	ret := m.ctrl.Call(m, "SaveUrl", ctx, link)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SaveUrl indicates an expected call of SaveUrl.
-func (mr *MockServiceProviderMockRecorder) SaveUrl(ctx, UrlStr interface{}) *gomock.Call {
+func (mr *MockServiceProviderMockRecorder) SaveUrl(ctx, link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUrl", reflect.TypeOf((*MockServiceProvider)(nil).SaveUrl), ctx, link)
+}
+
+// WatchUrls mocks base method.
+func (m *MockServiceProvider) WatchUrls(ctx context.Context, offset string, send func(storage.Change) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WatchUrls", ctx, offset, send)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WatchUrls indicates an expected call of WatchUrls.
+func (mr *MockServiceProviderMockRecorder) WatchUrls(ctx, offset, send interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUrl", reflect.TypeOf((*MockServiceProvider)(nil).SaveUrl), ctx, UrlStr)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchUrls", reflect.TypeOf((*MockServiceProvider)(nil).WatchUrls), ctx, offset, send)
 }
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"log"
+	"unicode/utf8"
+)
+
+// maxImageUrlLength предел адреса картинки страницы
+const maxImageUrlLength = 2048
+
+// NeedsPreview сообщает, что вместо перехода нужно показать страницу предпросмотра:
+// посетитель запросил предпросмотр или ссылка требует его и переход еще не подтвержден.
+func NeedsPreview(link storage.Link, rc RequestContext) bool {
+	return rc.Preview || (link.Preview && !rc.Confirmed)
+}
+
+// fetchPage читает сведения о странице urlStr, если чтение подключено.
+// Ошибка не мешает сохранению ссылки: предпросмотр покажет только Url.
+func (s *Service) fetchPage(ctx context.Context, urlStr string) storage.Page {
+	const op = "service.fetchPage"
+
+	if s.Pages == nil {
+		return storage.Page{}
+	}
+
+	timeout := s.PageTimeout
+	if timeout <= 0 {
+		timeout = defaultPageTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	page, err := s.Pages.Fetch(fetchCtx, urlStr)
+	if err != nil {
+		log.Printf("%s: url='%s'. %v", op, urlStr, err)
+		return storage.Page{}
+	}
+
+	// страница чужая, поэтому слишком длинные значения обрезаются, а не отклоняются
+	page.Title = truncate(page.Title, maxTitleLength)
+	page.Description = truncate(page.Description, maxDescriptionLength)
+	page.SiteName = truncate(page.SiteName, maxTitleLength)
+	if len(page.Image) > maxImageUrlLength {
+		page.Image = ""
+	}
+	return page
+}
+
+// truncate обрезает s до limit символов.
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit])
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"strings"
+)
+
+// GetQrCode возвращает QR код с полным адресом короткой ссылки.
+// Код рисуется только для доступной ссылки, но не считается переходом.
+func (s *Service) GetQrCode(ctx context.Context, domain, alias string, opts qrcode.Options) ([]byte, error) {
+	const op = "service.GetQrCode"
+
+	if s.QrCodes == nil || s.PublicUrl == nil {
+		return nil, ErrQrUnavailable
+	}
+
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.Storage.GetUrl(ctx, domain, alias); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		if errors.Is(err, storage.ErrDisabled) {
+			return nil, ErrDisabled
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := s.QrCodes.Render(s.shortUrl(domain, alias), opts)
+	if err != nil {
+		if errors.Is(err, qrcode.ErrBadOptions) {
+			return nil, ErrBadQrOptions
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// shortUrl возвращает полный адрес короткой ссылки.
+// domain - домен в хранилище, пусто - домен по умолчанию.
+func (s *Service) shortUrl(domain, alias string) string {
+	u := *s.PublicUrl
+	if domain != "" {
+		u.Host = domain
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + alias
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
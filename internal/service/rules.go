@@ -0,0 +1,255 @@
+package service
+
+import (
+	"container/list"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"log"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ограничения правил перехода
+const (
+	maxRules            = 20
+	maxUserAgentPattern = 256
+	// maxCachedPatterns предел скомпилированных шаблонов User-Agent в памяти
+	maxCachedPatterns = 1024
+)
+
+// RequestContext сведения о запросе перехода, которые передает транспорт.
+// Пустые поля означают, что признак неизвестен, и правила по нему не совпадают.
+type RequestContext struct {
+	UserAgent      string
+	AcceptLanguage string
+	ClientIP       netip.Addr
+	Query          url.Values
+	// VisitorID постоянный идентификатор посетителя, например из cookie.
+	// Пусто - посетитель определяется по IP и User-Agent.
+	VisitorID string
+	// Password пароль, введенный посетителем для защищенной ссылки.
+	Password string
+	// Preview посетитель запросил только предпросмотр, переход не выполняется.
+	Preview bool
+	// Confirmed посетитель подтвердил переход на странице предпросмотра.
+	Confirmed bool
+	// Path экранированный путь после alias, например "/extra/path". Пусто - без пути.
+	Path string
+}
+
+// normalizeRules проверяет правила и приводит язык и страну к одному регистру.
+func normalizeRules(rules []storage.Rule) ([]storage.Rule, error) {
+	if len(rules) > maxRules {
+		return nil, ErrBadRules
+	}
+
+	var normalized []storage.Rule
+	for _, rule := range rules {
+		if !validUrl(rule.Url) {
+			return nil, ErrBadRules
+		}
+
+		rule.Language = strings.ToLower(strings.TrimSpace(rule.Language))
+		rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+
+		// правило без условий перекрыло бы все следующие и Url ссылки
+		if rule.UserAgent == "" && rule.Language == "" && rule.Country == "" && len(rule.Query) == 0 {
+			return nil, ErrBadRules
+		}
+		if rule.UserAgent != "" {
+			if len(rule.UserAgent) > maxUserAgentPattern {
+				return nil, ErrBadRules
+			}
+			if _, err := compileUserAgent(rule.UserAgent); err != nil {
+				return nil, ErrBadRules
+			}
+		}
+		if rule.Country != "" && len(rule.Country) != 2 {
+			return nil, ErrBadRules
+		}
+
+		normalized = append(normalized, rule)
+	}
+
+	return normalized, nil
+}
+
+// resolveUrl возвращает Url первого совпавшего правила, иначе вариант A/B разделения
+// или Url ссылки. variant - индекс выбранного варианта, -1 если вариант не выбирался.
+func (s *Service) resolveUrl(link storage.Link, rc RequestContext) (urlStr string, variant int) {
+	if len(link.Rules) > 0 {
+		m := &ruleMatcher{rc: rc, geo: s.Geo, patterns: s.patterns}
+		for _, rule := range link.Rules {
+			if m.match(rule) {
+				return rule.Url, -1
+			}
+		}
+	}
+
+	if len(link.Destinations) > 0 {
+		variant = pickDestination(link, rc)
+		return link.Destinations[variant].Url, variant
+	}
+	return link.Url, -1
+}
+
+// ruleMatcher сверяет правила с запросом. Язык и страна вычисляются
+// не больше одного раза и только если их проверяет какое-то правило.
+type ruleMatcher struct {
+	rc       RequestContext
+	geo      GeoLocator
+	patterns *patternCache
+
+	language *string
+	country  *string
+}
+
+func (m *ruleMatcher) match(rule storage.Rule) bool {
+	if rule.UserAgent != "" {
+		re, err := m.patterns.compile(rule.UserAgent)
+		if err != nil || !re.MatchString(m.rc.UserAgent) {
+			return false
+		}
+	}
+
+	if rule.Language != "" {
+		lang := m.preferredLanguage()
+		if lang != rule.Language && !strings.HasPrefix(lang, rule.Language+"-") {
+			return false
+		}
+	}
+
+	if rule.Country != "" && m.clientCountry() != rule.Country {
+		return false
+	}
+
+	for key, value := range rule.Query {
+		if !slices.Contains(m.rc.Query[key], value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preferredLanguage возвращает язык Accept-Language с наибольшим весом в нижнем регистре.
+func (m *ruleMatcher) preferredLanguage() string {
+	if m.language != nil {
+		return *m.language
+	}
+
+	var best string
+	bestQ := 0.0
+	for _, part := range strings.Split(m.rc.AcceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// при равном весе остается язык, указанный раньше
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+
+	m.language = &best
+	return best
+}
+
+// clientCountry возвращает страну клиента по IP. Пусто, если IP или база неизвестны.
+func (m *ruleMatcher) clientCountry() string {
+	const op = "service.clientCountry"
+
+	if m.country != nil {
+		return *m.country
+	}
+
+	var country string
+	if m.geo != nil && m.rc.ClientIP.IsValid() {
+		var err error
+		country, err = m.geo.Country(m.rc.ClientIP)
+		if err != nil {
+			log.Printf("%s: ip='%s'. %v", op, m.rc.ClientIP, err)
+		}
+	}
+
+	m.country = &country
+	return country
+}
+
+// compileUserAgent компилирует шаблон User-Agent правила без учета регистра.
+func compileUserAgent(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+type patternEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// patternCache хранит последние size скомпилированных шаблонов User-Agent,
+// чтобы правила не компилировались заново при каждом переходе.
+// Шаблоны с ошибкой не кэшируются: при сохранении они отклоняются.
+type patternCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // в начале - недавно использованные
+	entries map[string]*list.Element
+}
+
+func newPatternCache(size int) *patternCache {
+	return &patternCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// compile возвращает скомпилированный шаблон. nil кэш компилирует каждый раз.
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, error) {
+	if c == nil {
+		return compileUserAgent(pattern)
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[pattern]; ok {
+		c.order.MoveToFront(el)
+		re := el.Value.(*patternEntry).re
+		c.mu.Unlock()
+		return re, nil
+	}
+	c.mu.Unlock()
+
+	re, err := compileUserAgent(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[pattern]; !ok && c.size > 0 {
+		c.entries[pattern] = c.order.PushFront(&patternEntry{pattern: pattern, re: re})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*patternEntry).pattern)
+		}
+	}
+
+	return re, nil
+}
@@ -4,8 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	"github.com/RVodassa/url-shortener/internal/lib/scanner"
 	"github.com/RVodassa/url-shortener/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/netip"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 //go:generate mockgen -source=service.go -destination=.././lib/random/mock/random_mock.go
@@ -13,78 +22,673 @@ type RandomProvider interface {
 	RandomString(int) (string, error)
 }
 
+// URLScanner проверяет Url по сервису репутации.
+type URLScanner interface {
+	Scan(ctx context.Context, urlStr string) (scanner.Verdict, error)
+}
+
+// AccessTracker отмечает обращения к ссылкам без синхронной записи в хранилище.
+type AccessTracker interface {
+	Track(key storage.Key, variant int)
+}
+
+// GeoLocator определяет страну клиента по IP для правил перехода.
+type GeoLocator interface {
+	Country(ip netip.Addr) (string, error)
+}
+
+// QrRenderer рисует QR код короткой ссылки.
+type QrRenderer interface {
+	Render(content string, opts qrcode.Options) ([]byte, error)
+}
+
+// PageFetcher читает сведения о странице назначения для предпросмотра.
+type PageFetcher interface {
+	Fetch(ctx context.Context, urlStr string) (storage.Page, error)
+}
+
+// DomainRules правила выдачи alias в домене.
+type DomainRules struct {
+	AliasLength int      // 0 - длина по умолчанию
+	Reserved    []string // alias, которые не выдаются, например служебные пути
+}
+
 var (
-	ErrNotFound = errors.New("ошибка: url не найден")
-	ErrBadUrl   = errors.New("ошибка: невалидный url")
+	ErrNotFound         = errors.New("ошибка: url не найден")
+	ErrBadUrl           = errors.New("ошибка: невалидный url")
+	ErrDisabled         = errors.New("ошибка: url отключен")
+	ErrBadMetadata      = errors.New("ошибка: невалидные метаданные")
+	ErrBadExpiry        = errors.New("ошибка: срок действия уже истек")
+	ErrMaliciousUrl     = errors.New("ошибка: url заблокирован проверкой безопасности")
+	ErrScanUnavailable  = errors.New("ошибка: проверка безопасности недоступна")
+	ErrUnknownDomain    = errors.New("ошибка: неизвестный домен")
+	ErrBadRules         = errors.New("ошибка: невалидные правила перехода")
+	ErrBadDestinations  = errors.New("ошибка: невалидные варианты перехода")
+	ErrBadPassword      = errors.New("ошибка: невалидный пароль")
+	ErrBadMaxUses       = errors.New("ошибка: невалидное число использований")
+	ErrPasswordNeeded   = errors.New("ошибка: ссылка защищена паролем")
+	ErrWrongPassword    = errors.New("ошибка: неверный пароль")
+	ErrExhausted        = errors.New("ошибка: использования ссылки исчерпаны")
+	ErrBadQrOptions     = errors.New("ошибка: невалидные параметры QR кода")
+	ErrQrUnavailable    = errors.New("ошибка: QR коды не настроены")
+	ErrBadForward       = errors.New("ошибка: невалидный режим переноса параметров")
+	ErrBadPath          = errors.New("ошибка: невалидный путь перехода")
+	ErrBadTemplate      = errors.New("ошибка: невалидный шаблон ссылки")
+	ErrBadTemplateValue = errors.New("ошибка: невалидное значение шаблона")
 )
 
-// TODO: в конфиг
+// aliasLength длина alias, если домен не задает свою
 const aliasLength = 10
 
+const defaultScanTimeout = 2 * time.Second
+
+const defaultPageTimeout = 3 * time.Second
+
+// Ограничения метаданных ссылки
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 1024
+	maxNotesLength       = 4096
+	maxTags              = 20
+	maxTagLength         = 50
+	maxListLimit         = 1000
+	maxPasswordLength    = 72 // предел bcrypt
+)
+
 type Service struct {
 	Storage storage.Storage
 	Random  RandomProvider
+
+	Scanner        URLScanner
+	ScanTimeout    time.Duration
+	ScanFailClosed bool // при ошибке проверки отклонять сохранение
+
+	Tracker AccessTracker
+
+	// Domains домены со своими пространствами alias. Пусто - один домен без имени.
+	Domains       map[string]DomainRules
+	DefaultDomain string
+
+	Geo GeoLocator
+
+	// QrCodes рисует QR коды коротких ссылок вида PublicUrl/<alias>
+	QrCodes   QrRenderer
+	PublicUrl *url.URL
+
+	// Pages читает заголовок и OpenGraph теги Url при сохранении
+	Pages       PageFetcher
+	PageTimeout time.Duration
+
+	// Events шина событий ссылок, создается в New
+	Events *EventBus
+
+	// Webhooks хранит подписки на события; nil - подписки недоступны
+	Webhooks storage.WebhookStore
+
+	// Changes журнал изменений ссылок для WatchUrls; nil - недоступен
+	Changes       storage.ChangeFeed
+	WatchInterval time.Duration
+
+	// patterns скомпилированные шаблоны User-Agent правил, создается в New
+	patterns *patternCache
 }
 
-func New(storage storage.Storage, random RandomProvider) *Service {
-	return &Service{
-		Storage: storage,
-		Random:  random,
+// Option настраивает необязательные зависимости сервиса.
+type Option func(*Service)
+
+// WithScanner подключает проверку Url при сохранении и получении.
+func WithScanner(scanner URLScanner, timeout time.Duration, failClosed bool) Option {
+	return func(s *Service) {
+		s.Scanner = scanner
+		s.ScanTimeout = timeout
+		s.ScanFailClosed = failClosed
 	}
 }
 
-// SaveUrl сохраняет Url и возвращает алиас.
-func (s *Service) SaveUrl(ctx context.Context, urlStr string) (string, error) {
+// WithAccessTracker подключает учет времени последнего обращения.
+func WithAccessTracker(tracker AccessTracker) Option {
+	return func(s *Service) {
+		s.Tracker = tracker
+	}
+}
+
+// WithGeoLocator подключает определение страны клиента для правил перехода.
+func WithGeoLocator(geo GeoLocator) Option {
+	return func(s *Service) {
+		s.Geo = geo
+	}
+}
+
+// WithQrCodes подключает QR коды. publicUrl - адрес сервера переходов для домена
+// по умолчанию; ссылки остальных доменов получают его схему и свое имя хоста.
+func WithQrCodes(renderer QrRenderer, publicUrl *url.URL) Option {
+	return func(s *Service) {
+		s.QrCodes = renderer
+		s.PublicUrl = publicUrl
+	}
+}
+
+// WithPageFetcher подключает чтение сведений о странице Url при сохранении.
+// Недоступность страницы не мешает сохранению.
+func WithPageFetcher(fetcher PageFetcher, timeout time.Duration) Option {
+	return func(s *Service) {
+		s.Pages = fetcher
+		s.PageTimeout = timeout
+	}
+}
+
+// WithDomains включает несколько доменов. Ссылки домена по умолчанию хранятся
+// без домена, поэтому ссылки, созданные до подключения доменов, остаются в нем.
+func WithDomains(defaultDomain string, domains map[string]DomainRules) Option {
+	return func(s *Service) {
+		s.DefaultDomain = defaultDomain
+		s.Domains = domains
+	}
+}
+
+func New(storage storage.Storage, random RandomProvider, opts ...Option) *Service {
+	s := &Service{
+		Storage:  storage,
+		Random:   random,
+		Events:   NewEventBus(),
+		patterns: newPatternCache(maxCachedPatterns),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SaveUrl сохраняет ссылку с метаданными в домене link.Domain и возвращает алиас.
+// Поле Alias входной ссылки игнорируется.
+func (s *Service) SaveUrl(ctx context.Context, link storage.Link) (string, error) {
 	const op = "service.SaveUrl"
 
+	// Url ссылки с вариантами можно не указывать, им станет первый вариант
+	if link.Url == "" && len(link.Destinations) > 0 {
+		link.Url = link.Destinations[0].Url
+	}
+	urlStr := link.Url
+
+	domain, rules, err := s.resolveDomain(link.Domain)
+	if err != nil {
+		return "", err
+	}
+	link.Domain = domain
+
 	// Валидация Url
-	parsedUrl, err := url.ParseRequestURI(urlStr)
-	if err != nil || parsedUrl.Scheme == "" || parsedUrl.Host == "" {
+	if !validUrl(urlStr) {
 		return "", ErrBadUrl
 	}
 
-	// Генерация алиаса
-	var alias string
+	// Валидация метаданных
+	if link.Tags, err = normalizeMetadata(link); err != nil {
+		return "", err
+	}
+	if link.Expired(time.Now()) {
+		return "", ErrBadExpiry
+	}
+	if link.Rules, err = normalizeRules(link.Rules); err != nil {
+		return "", err
+	}
+	if link.Destinations, err = normalizeDestinations(link.Destinations); err != nil {
+		return "", err
+	}
+	if link.MaxUses < 0 {
+		return "", ErrBadMaxUses
+	}
+	if !validQueryForward(link.ForwardQuery) {
+		return "", ErrBadForward
+	}
+	if link.Template {
+		if err = validateTemplate(link); err != nil {
+			return "", err
+		}
+	}
+	link.UsesLeft = link.MaxUses
+
+	if len(link.Password) > maxPasswordLength {
+		return "", ErrBadPassword
+	}
+	link.PasswordHash = ""
+	if link.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(link.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		link.PasswordHash = string(hash)
+		link.Password = ""
+	}
+
+	// Проверка безопасности Url, адресов правил и вариантов
+	if err = s.scanUrl(ctx, urlStr, s.ScanFailClosed); err != nil {
+		return "", err
+	}
+	for _, rule := range link.Rules {
+		if err = s.scanUrl(ctx, rule.Url, s.ScanFailClosed); err != nil {
+			return "", err
+		}
+	}
+	for _, destination := range link.Destinations {
+		if err = s.scanUrl(ctx, destination.Url, s.ScanFailClosed); err != nil {
+			return "", err
+		}
+	}
 
+	// сведения о странице собирает только сервис
+	link.Page = s.fetchPage(ctx, urlStr)
+
+	length := rules.AliasLength
+	if length <= 0 {
+		length = aliasLength
+	}
+
+	// Генерация алиаса, пока не найдется свободный или не истечет срок запроса
 	for {
-		alias, err = s.Random.RandomString(aliasLength)
+		if err = ctx.Err(); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		link.Alias, err = s.Random.RandomString(length)
 		if err != nil {
 			return "", fmt.Errorf("%s: %w", op, err)
 		}
+		if slices.Contains(rules.Reserved, link.Alias) {
+			continue
+		}
 
-		err = s.Storage.SaveUrl(ctx, alias, urlStr)
+		err = s.Storage.SaveUrl(ctx, link)
 		if err != nil {
 			if errors.Is(err, storage.ErrExistAlias) {
 				continue
 			}
 			return "", fmt.Errorf("%s: %w", op, err)
 		}
-		return alias, nil
+		s.emit(ctx, EventCreated, link.Domain, link.Alias, func(event *Event) {
+			event.Url = link.Url
+			event.Status = storage.StatusActive
+		})
+		return link.Alias, nil
 	}
 }
 
-func (s *Service) GetUrl(ctx context.Context, alias string) (string, error) {
+// GetUrl возвращает ссылку, в которой Url заменен адресом перехода для rc:
+// первого совпавшего правила или варианта A/B разделения, с путем и параметрами
+// перехода по ForwardPath и ForwardQuery. У шаблона подстановки заполняются из пути и query.
+// Ссылка с паролем требует rc.Password, ссылка с ограничением тратит одно использование.
+// Если NeedsPreview, ссылка возвращается без учета перехода для страницы предпросмотра,
+// у ссылки с ограничением - без Url и сведений о странице.
+func (s *Service) GetUrl(ctx context.Context, domain, alias string, rc RequestContext) (storage.Link, error) {
 	const op = "service.GetUrl"
 
-	getUrl, err := s.Storage.GetUrl(ctx, alias)
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	link, err := s.Storage.GetUrl(ctx, domain, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return storage.Link{}, ErrNotFound
+		}
+		if errors.Is(err, storage.ErrDisabled) {
+			return storage.Link{}, ErrDisabled
+		}
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// путь после alias есть только у ссылок, которые его переносят или заполняют им шаблон
+	if rc.Path != "" && !link.ForwardPath && !link.Template {
+		return storage.Link{}, ErrNotFound
+	}
+
+	// исчерпанная ссылка не спрашивает пароль
+	if link.MaxUses > 0 && link.UsesLeft <= 0 {
+		return storage.Link{}, ErrExhausted
+	}
+	if err = checkPassword(link, rc.Password); err != nil {
+		return storage.Link{}, err
+	}
+
+	// порядок заполнения шаблона путем задает Url ссылки, даже если выбран другой адрес
+	var order []string
+	if link.Template {
+		order = placeholders(link.Url)
+	}
+
+	var variant int
+	link.Url, variant = s.resolveUrl(link, rc)
+
+	// Ссылки, помеченные после сохранения, не отдаются. Проверяется сохраненный адрес
+	// без подстановок, пути и параметров запроса: иначе каждый новый query обходил бы
+	// кэш вердиктов. Недоступность проверки не блокирует переходы.
+	if err = s.scanUrl(ctx, link.Url, false); err != nil {
+		return storage.Link{}, err
+	}
+
+	if link.Template {
+		if link.Url, rc.Query, err = expandTemplate(link.Url, order, rc); err != nil {
+			return storage.Link{}, err
+		}
+	}
+	// путь и параметры переносятся в адрес, выбранный правилами или вариантами
+	if link.Url, err = forwardUrl(link.Url, link, rc); err != nil {
+		return storage.Link{}, err
+	}
+
+	// страница предпросмотра - еще не переход, он учитывается после подтверждения.
+	// Адрес ссылки с ограничением не показывается: иначе его можно узнавать
+	// через предпросмотр сколько угодно раз, не тратя использований.
+	if NeedsPreview(link, rc) {
+		if link.MaxUses > 0 {
+			link.Url, link.Page = "", storage.Page{}
+		}
+		link.Domain = s.domainName(link.Domain)
+		return link, nil
+	}
+
+	// использование списывается последним, чтобы отказ выше его не тратил
+	if link.MaxUses > 0 {
+		link.UsesLeft, err = s.Storage.UseUrl(ctx, domain, alias)
+		if err != nil {
+			if errors.Is(err, storage.ErrExhausted) {
+				return storage.Link{}, ErrExhausted
+			}
+			if errors.Is(err, storage.ErrNotFound) {
+				return storage.Link{}, ErrNotFound
+			}
+			return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if s.Tracker != nil {
+		s.Tracker.Track(link.Key(), variant)
+	}
+
+	link.Domain = s.domainName(link.Domain)
+	return link, nil
+}
+
+// GetUrlInfo возвращает ссылку с метаданными и временными метками без учета обращения.
+func (s *Service) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	const op = "service.GetUrlInfo"
+
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	link, err := s.Storage.GetUrlInfo(ctx, domain, alias)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
-			return "", ErrNotFound
+			return storage.Link{}, ErrNotFound
 		}
-		return "", fmt.Errorf("%s: %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return getUrl, nil
+	link.Domain = s.domainName(link.Domain)
+	return link, nil
 }
 
-func (s *Service) DeleteUrl(ctx context.Context, alias string) error {
+// ListUrls возвращает ссылки, опционально отфильтрованные по тегу.
+func (s *Service) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	const op = "service.ListUrls"
+
+	if filter.Limit <= 0 || filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+
+	links, err := s.Storage.ListUrls(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i := range links {
+		links[i].Domain = s.domainName(links[i].Domain)
+	}
+	return links, nil
+}
+
+func (s *Service) DeleteUrl(ctx context.Context, domain, alias string) error {
 	const op = "service.DeleteUrl"
 
-	if err := s.Storage.DeleteUrl(ctx, alias); err != nil {
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Storage.DeleteUrl(ctx, domain, alias); err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			return ErrNotFound
 		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	s.emit(ctx, EventDeleted, domain, alias, func(event *Event) {
+		event.Status = storage.StatusDeleted
+	})
+	return nil
+}
+
+// DisableUrl отключает ссылку без удаления.
+func (s *Service) DisableUrl(ctx context.Context, domain, alias string) error {
+	const op = "service.DisableUrl"
+
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Storage.DisableUrl(ctx, domain, alias); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNotFound
+		}
+		if errors.Is(err, storage.ErrUnchanged) {
+			// статус уже нужный, события нет
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.emit(ctx, EventUpdated, domain, alias, func(event *Event) {
+		event.Status = storage.StatusDisabled
+	})
+	return nil
+}
+
+// EnableUrl включает отключенную ссылку.
+func (s *Service) EnableUrl(ctx context.Context, domain, alias string) error {
+	const op = "service.EnableUrl"
+
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Storage.EnableUrl(ctx, domain, alias); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNotFound
+		}
+		if errors.Is(err, storage.ErrUnchanged) {
+			// статус уже нужный, события нет
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.emit(ctx, EventUpdated, domain, alias, func(event *Event) {
+		event.Status = storage.StatusActive
+	})
+	return nil
+}
+
+// RestoreUrl восстанавливает удаленную ссылку, пока она не очищена.
+func (s *Service) RestoreUrl(ctx context.Context, domain, alias string) error {
+	const op = "service.RestoreUrl"
+
+	domain, _, err := s.resolveDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Storage.RestoreUrl(ctx, domain, alias); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.emit(ctx, EventUpdated, domain, alias, func(event *Event) {
+		event.Status = storage.StatusActive
+	})
+	return nil
+}
+
+// PurgeDeleted окончательно удаляет ссылки, удаленные дольше retention назад.
+func (s *Service) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	const op = "service.PurgeDeleted"
+
+	purged, err := s.Storage.PurgeDeleted(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return purged, fmt.Errorf("%s: %w", op, err)
+	}
+	return purged, nil
+}
+
+// PurgeStale окончательно удаляет пачку истекших или давно не использованных ссылок.
+func (s *Service) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	const op = "service.PurgeStale"
+
+	keys, err := s.Storage.PurgeStale(ctx, filter)
+	if err != nil {
+		return keys, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !filter.DryRun {
+		// очистка по обоим критериям сразу не различает причину, считаем ее удалением
+		eventType := EventDeleted
+		if !filter.ExpiredBefore.IsZero() && filter.NotAccessedSince.IsZero() {
+			eventType = EventExpired
+		}
+		for _, key := range keys {
+			s.emit(ctx, eventType, key.Domain, key.Alias, nil)
+		}
+	}
+	return keys, nil
+}
+
+// resolveDomain возвращает домен, под которым ссылки хранятся в хранилище, и его правила.
+// Пустой домен означает домен по умолчанию. Без настроенных доменов домен не учитывается.
+func (s *Service) resolveDomain(domain string) (string, DomainRules, error) {
+	if len(s.Domains) == 0 {
+		return "", DomainRules{}, nil
+	}
+
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		domain = s.DefaultDomain
+	}
+
+	rules, ok := s.Domains[domain]
+	if !ok {
+		return "", DomainRules{}, ErrUnknownDomain
+	}
+	if domain == s.DefaultDomain {
+		return "", rules, nil
+	}
+	return domain, rules, nil
+}
+
+// domainName возвращает имя домена ссылки, прочитанной из хранилища.
+func (s *Service) domainName(domain string) string {
+	if domain == "" {
+		return s.DefaultDomain
+	}
+	return domain
+}
+
+// checkPassword сверяет пароль с хешем ссылки.
+func checkPassword(link storage.Link, password string) error {
+	if link.PasswordHash == "" {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordNeeded
+	}
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// validUrl проверяет, что Url абсолютный, содержит хост и помещается в хранилище.
+func validUrl(urlStr string) bool {
+	if len(urlStr) > storage.MaxUrlLength {
+		return false
+	}
+	parsedUrl, err := url.ParseRequestURI(urlStr)
+	return err == nil && parsedUrl.Scheme != "" && parsedUrl.Host != ""
+}
+
+// normalizeMetadata проверяет длины метаданных и возвращает теги
+// в нижнем регистре, без пустых значений и повторов.
+func normalizeMetadata(link storage.Link) ([]string, error) {
+	if utf8.RuneCountInString(link.Title) > maxTitleLength ||
+		utf8.RuneCountInString(link.Description) > maxDescriptionLength ||
+		utf8.RuneCountInString(link.Notes) > maxNotesLength {
+		return nil, ErrBadMetadata
+	}
+
+	var tags []string
+	for _, tag := range link.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, ErrBadMetadata
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return nil, ErrBadMetadata
+	}
+
+	return tags, nil
+}
+
+// scanUrl проверяет Url сканером, если он подключен.
+// failClosed определяет реакцию на ошибку или таймаут проверки.
+func (s *Service) scanUrl(ctx context.Context, urlStr string, failClosed bool) error {
+	const op = "service.scanUrl"
+
+	if s.Scanner == nil {
+		return nil
+	}
+
+	timeout := s.ScanTimeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	scanCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	verdict, err := s.Scanner.Scan(scanCtx, urlStr)
+	if err != nil {
+		// отмененный запрос - не недоступность сканера
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+		log.Printf("%s: url='%s'. %v", op, urlStr, err)
+		if failClosed {
+			return ErrScanUnavailable
+		}
+		return nil
+	}
+
+	if verdict.Malicious {
+		log.Printf("%s: url='%s'. заблокирован: %s", op, urlStr, verdict.Reason)
+		return ErrMaliciousUrl
+	}
+
 	return nil
 }
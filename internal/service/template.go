@@ -0,0 +1,119 @@
+package service
+
+import (
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Ограничения шаблонов
+const maxPlaceholders = 10
+
+var (
+	placeholderRe     = regexp.MustCompile(`\{([^{}]*)\}`)
+	placeholderNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	// значения подставляются без экранирования, поэтому допускаются только
+	// незарезервированные символы Url: они не меняют структуру адреса
+	templateValueRe = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,100}$`)
+)
+
+// placeholders возвращает имена подстановок шаблона в порядке первого появления.
+func placeholders(template string) []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// validateTemplate проверяет подстановки в адресах ссылки-шаблона.
+// Хост и схема шаблона фиксированы: validUrl не пропускает { } в них.
+func validateTemplate(link storage.Link) error {
+	if link.ForwardPath {
+		// путь после alias целиком занят значениями шаблона
+		return ErrBadTemplate
+	}
+
+	templates := []string{link.Url}
+	for _, rule := range link.Rules {
+		templates = append(templates, rule.Url)
+	}
+	for _, destination := range link.Destinations {
+		templates = append(templates, destination.Url)
+	}
+
+	var names []string
+	for _, template := range templates {
+		for _, name := range placeholders(template) {
+			if !placeholderNameRe.MatchString(name) {
+				return ErrBadTemplate
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 || len(names) > maxPlaceholders {
+		return ErrBadTemplate
+	}
+	return nil
+}
+
+// expandTemplate подставляет значения в адрес urlStr. Сегменты пути rc.Path
+// заполняют подстановки по порядку order, остальные берутся из query параметров
+// с тем же именем. Возвращает query без параметров, ушедших в подстановки.
+func expandTemplate(urlStr string, order []string, rc RequestContext) (string, url.Values, error) {
+	values := make(map[string]string)
+
+	if path := strings.Trim(rc.Path, "/"); path != "" {
+		segments := strings.Split(path, "/")
+		if len(segments) > len(order) {
+			return "", nil, ErrNotFound
+		}
+		for i, segment := range segments {
+			value, err := url.PathUnescape(segment)
+			if err != nil {
+				return "", nil, ErrBadTemplateValue
+			}
+			values[order[i]] = value
+		}
+	}
+
+	query := rc.Query
+	var used []string
+	for _, name := range placeholders(urlStr) {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if !query.Has(name) {
+			return "", nil, ErrBadTemplateValue
+		}
+		values[name] = query.Get(name)
+		used = append(used, name)
+	}
+	if len(used) > 0 {
+		query = make(url.Values, len(rc.Query))
+		for key, vals := range rc.Query {
+			if !slices.Contains(used, key) {
+				query[key] = vals
+			}
+		}
+	}
+
+	var err error
+	expanded := placeholderRe.ReplaceAllStringFunc(urlStr, func(m string) string {
+		value := values[m[1:len(m)-1]]
+		if !templateValueRe.MatchString(value) || value == "." || value == ".." {
+			err = ErrBadTemplateValue
+		}
+		return value
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return expanded, query, nil
+}
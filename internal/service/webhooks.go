@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadWebhook          = errors.New("ошибка: невалидная подписка")
+	ErrWebhooksUnavailable = errors.New("ошибка: подписки не поддерживаются хранилищем")
+)
+
+// Ограничения подписки
+const (
+	maxWebhookFilters   = 20
+	minWebhookSecret    = 16
+	maxWebhookSecret    = 256
+	webhookSecretLength = 32 // байт в сгенерированном ключе
+)
+
+// WithWebhooks подключает хранение подписок на события ссылок.
+func WithWebhooks(store storage.WebhookStore) Option {
+	return func(s *Service) {
+		s.Webhooks = store
+	}
+}
+
+// CreateWebhook сохраняет подписку и возвращает ее с id и ключом подписи.
+// Пустой Secret заменяется случайным. Домены проверяются и приводятся к именам.
+func (s *Service) CreateWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error) {
+	const op = "service.CreateWebhook"
+
+	if s.Webhooks == nil {
+		return storage.Webhook{}, ErrWebhooksUnavailable
+	}
+
+	webhook.Url = strings.TrimSpace(webhook.Url)
+	if !validUrl(webhook.Url) {
+		return storage.Webhook{}, ErrBadWebhook
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret = randomHex(webhookSecretLength)
+	} else if len(webhook.Secret) < minWebhookSecret || len(webhook.Secret) > maxWebhookSecret {
+		return storage.Webhook{}, ErrBadWebhook
+	}
+
+	if len(webhook.Events) > maxWebhookFilters || len(webhook.Domains) > maxWebhookFilters {
+		return storage.Webhook{}, ErrBadWebhook
+	}
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		if !slices.Contains(EventTypes, EventType(event)) {
+			return storage.Webhook{}, ErrBadWebhook
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	domains := make([]string, 0, len(webhook.Domains))
+	for _, domain := range webhook.Domains {
+		stored, _, err := s.resolveDomain(domain)
+		if err != nil {
+			return storage.Webhook{}, err
+		}
+		// события несут имя домена, поэтому фильтр хранится по имени
+		if name := s.domainName(stored); !slices.Contains(domains, name) {
+			domains = append(domains, name)
+		}
+	}
+	webhook.Domains = domains
+
+	webhook.ID = randomHex(16)
+	webhook.CreatedAt = time.Now().UTC()
+
+	if err := s.Webhooks.SaveWebhook(ctx, webhook); err != nil {
+		return storage.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return webhook, nil
+}
+
+// ListWebhooks возвращает подписки без ключей подписи.
+func (s *Service) ListWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	const op = "service.ListWebhooks"
+
+	if s.Webhooks == nil {
+		return nil, ErrWebhooksUnavailable
+	}
+
+	webhooks, err := s.Webhooks.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook удаляет подписку.
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+	const op = "service.DeleteWebhook"
+
+	if s.Webhooks == nil {
+		return ErrWebhooksUnavailable
+	}
+
+	if err := s.Webhooks.DeleteWebhook(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
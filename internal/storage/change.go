@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrBadOffset = errors.New("ошибка: невалидная позиция журнала изменений")
+
+// ChangeOp вид изменения ссылки.
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update" // смена статуса, исчерпание использований; мягкое удаление тоже
+	ChangeDelete ChangeOp = "delete" // окончательное удаление при очистке
+)
+
+// ChangeReason причина изменения, которую не выразить видом и статусом.
+type ChangeReason string
+
+const (
+	ReasonExhausted ChangeReason = "exhausted" // ChangeUpdate: списано последнее использование
+	ReasonPurged    ChangeReason = "purged"    // ChangeDelete: очистка мягко удаленной ссылки
+	ReasonExpired   ChangeReason = "expired"   // ChangeDelete: очистка истекшей ссылки
+	ReasonStale     ChangeReason = "stale"     // ChangeDelete: очистка давно не использованной ссылки
+)
+
+// Change запись журнала изменений ссылок.
+type Change struct {
+	Offset string // позиция записи; чтение с нее продолжается со следующей
+	Op     ChangeOp
+	Domain string // пусто - домен по умолчанию
+	Alias  string
+	Status Status       // статус после изменения, пусто у ChangeDelete
+	Url    string       // только у ChangeInsert
+	Reason ChangeReason // пусто у смены статуса и создания
+	At     time.Time
+}
+
+// ChangeFeed реализуется хранилищами, которые пишут журнал изменений ссылок
+// атомарно с самими изменениями. Время обращений и счетчики переходов в журнал не попадают.
+type ChangeFeed interface {
+	// ReadChanges возвращает до limit изменений после offset в порядке применения.
+	// Пустой offset - с начала журнала. ErrBadOffset - offset не из этого журнала.
+	ReadChanges(ctx context.Context, offset string, limit int) ([]Change, error)
+	// PurgeChanges удаляет записи старше before и возвращает их число.
+	PurgeChanges(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,88 @@
+package mapStorage
+
+import (
+	"context"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Журнал изменений в памяти пишется под той же блокировкой, что и сами изменения,
+// и живет до перезапуска. Позиция - номер записи.
+
+type changeEntry struct {
+	seq    uint64
+	change storage.Change
+}
+
+// logChange добавляет запись журнала об изменении ссылки key. Вызывается под s.mu.
+func (s *MapStorage) logChange(op storage.ChangeOp, key storage.Key, status storage.Status, url string, reason storage.ChangeReason) {
+	s.changeSeq++
+	s.changes = append(s.changes, changeEntry{
+		seq: s.changeSeq,
+		change: storage.Change{
+			Offset: strconv.FormatUint(s.changeSeq, 10),
+			Op:     op,
+			Domain: key.Domain,
+			Alias:  key.Alias,
+			Status: status,
+			Url:    url,
+			Reason: reason,
+			At:     time.Now(),
+		},
+	})
+}
+
+func (s *MapStorage) ReadChanges(ctx context.Context, offset string, limit int) ([]storage.Change, error) {
+	const op = "storage.MapStorage.ReadChanges"
+
+	var after uint64
+	if offset != "" {
+		n, err := strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return nil, storage.ErrBadOffset
+		}
+		after = n
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start := sort.Search(len(s.changes), func(i int) bool {
+		return s.changes[i].seq > after
+	})
+	entries := s.changes[start:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+
+	changes := make([]storage.Change, 0, len(entries))
+	for _, entry := range entries {
+		changes = append(changes, entry.change)
+	}
+	return changes, nil
+}
+
+func (s *MapStorage) PurgeChanges(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.MapStorage.PurgeChanges"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := sort.Search(len(s.changes), func(i int) bool {
+		return !s.changes[i].change.At.Before(before)
+	})
+	s.changes = slices.Delete(s.changes, 0, end)
+	return int64(end), nil
+}
@@ -2,78 +2,384 @@ package mapStorage
 
 import (
 	"context"
+	"fmt"
 	"github.com/RVodassa/url-shortener/internal/storage"
+	"slices"
+	"sort"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+type record struct {
+	link      storage.Link
+	seq       uint64 // порядок создания для ListUrls
+	deletedAt time.Time
+}
+
 type MapStorage struct {
 	mu    sync.RWMutex
-	store map[string]string
+	store map[storage.Key]*record
+	seq   uint64
+
+	changes   []changeEntry
+	changeSeq uint64
+
+	webhooks      map[string]storage.Webhook
+	deliveries    map[string]storage.Delivery
+	webhookOffset string
 }
 
 func New() storage.Storage {
 	return &MapStorage{
-		store: make(map[string]string),
+		store:      make(map[storage.Key]*record),
+		webhooks:   make(map[string]storage.Webhook),
+		deliveries: make(map[string]storage.Delivery),
 	}
 }
 
-func (s *MapStorage) SaveUrl(ctx context.Context, alias, UrlSave string) error {
+func (s *MapStorage) SaveUrl(ctx context.Context, link storage.Link) error {
 	const op = "storage.MapStorage.SaveUrl"
 
-	if alias == "" {
+	if link.Alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
-	if UrlSave == "" {
+	if link.Url == "" {
 		return storage.ErrUrlIsEmpty
 	}
+	if utf8.RuneCountInString(link.Url) > storage.MaxUrlLength {
+		return storage.ErrUrlTooLong
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.store[alias]; exists {
+	if _, exists := s.store[link.Key()]; exists {
 		return storage.ErrExistAlias
 	}
 
-	s.store[alias] = UrlSave
+	now := time.Now()
+	link.Tags = slices.Clone(link.Tags)
+	link.Rules = slices.Clone(link.Rules)
+	link.Destinations = slices.Clone(link.Destinations)
+	for i := range link.Destinations {
+		link.Destinations[i].Clicks = 0
+	}
+	link.Status = storage.StatusActive
+	link.CreatedAt = now
+	link.UpdatedAt = now
+	link.LastAccessedAt = time.Time{}
+	s.seq++
+	s.store[link.Key()] = &record{link: link, seq: s.seq}
+	s.logChange(storage.ChangeInsert, link.Key(), storage.StatusActive, link.Url, "")
 	return nil
 }
 
-func (s *MapStorage) GetUrl(ctx context.Context, alias string) (string, error) {
+func (s *MapStorage) GetUrl(ctx context.Context, domain, alias string) (storage.Link, error) {
 	const op = "storage.MapStorage.GetUrl"
 
 	if alias == "" {
-		return "", storage.ErrAliasIsEmpty
+		return storage.Link{}, storage.ErrAliasIsEmpty
+	}
+
+	if err := ctx.Err(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	Url, exists := s.store[alias]
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
+	if !exists || rec.link.Status == storage.StatusDeleted || rec.link.Expired(time.Now()) {
+		return storage.Link{}, storage.ErrNotFound
+	}
+	if rec.link.Status == storage.StatusDisabled {
+		return storage.Link{}, storage.ErrDisabled
+	}
+
+	return rec.copyLink(), nil
+}
+
+func (s *MapStorage) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	const op = "storage.MapStorage.GetUrlInfo"
+
+	if alias == "" {
+		return storage.Link{}, storage.ErrAliasIsEmpty
+	}
+
+	if err := ctx.Err(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
 	if !exists {
-		return "", storage.ErrNotFound
+		return storage.Link{}, storage.ErrNotFound
 	}
 
-	return Url, nil
+	return rec.copyLink(), nil
 }
 
-func (s *MapStorage) DeleteUrl(ctx context.Context, alias string) error {
+func (s *MapStorage) TouchUrls(ctx context.Context, accessed map[storage.Key]storage.Access) error {
+	const op = "storage.MapStorage.TouchUrls"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, access := range accessed {
+		rec, exists := s.store[key]
+		if !exists {
+			continue
+		}
+		if rec.link.LastAccessedAt.Before(access.At) {
+			rec.link.LastAccessedAt = access.At
+		}
+		for variant, clicks := range access.Clicks {
+			if variant >= 0 && variant < len(rec.link.Destinations) {
+				rec.link.Destinations[variant].Clicks += clicks
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MapStorage) UseUrl(ctx context.Context, domain, alias string) (int64, error) {
+	const op = "storage.MapStorage.UseUrl"
+
+	if alias == "" {
+		return 0, storage.ErrAliasIsEmpty
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
+	if !exists || rec.link.Status == storage.StatusDeleted {
+		return 0, storage.ErrNotFound
+	}
+	if rec.link.MaxUses <= 0 {
+		return -1, nil
+	}
+	if rec.link.UsesLeft <= 0 {
+		return 0, storage.ErrExhausted
+	}
+
+	rec.link.UsesLeft--
+	if rec.link.UsesLeft == 0 {
+		s.logChange(storage.ChangeUpdate, rec.link.Key(), rec.link.Status, "", storage.ReasonExhausted)
+	}
+	return rec.link.UsesLeft, nil
+}
+
+func (s *MapStorage) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	const op = "storage.MapStorage.ListUrls"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*record, 0, len(s.store))
+	for _, rec := range s.store {
+		if rec.link.Status == storage.StatusDeleted {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(rec.link.Tags, filter.Tag) {
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].seq < records[j].seq
+	})
+
+	if filter.Offset >= len(records) {
+		return nil, nil
+	}
+	records = records[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(records) {
+		records = records[:filter.Limit]
+	}
+
+	links := make([]storage.Link, 0, len(records))
+	for _, rec := range records {
+		links = append(links, rec.copyLink())
+	}
+	return links, nil
+}
+
+// copyLink возвращает копию ссылки, не разделяющую срезы с хранилищем.
+func (r *record) copyLink() storage.Link {
+	link := r.link
+	link.Tags = slices.Clone(r.link.Tags)
+	link.Rules = slices.Clone(r.link.Rules)
+	link.Destinations = slices.Clone(r.link.Destinations)
+	return link
+}
+
+func (s *MapStorage) DeleteUrl(ctx context.Context, domain, alias string) error {
 	const op = "storage.MapStorage.DeleteUrl"
 
 	if alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
+	if !exists || rec.link.Status == storage.StatusDeleted {
+		return storage.ErrNotFound
+	}
+
+	rec.link.Status = storage.StatusDeleted
+	rec.link.UpdatedAt = time.Now()
+	rec.deletedAt = rec.link.UpdatedAt
+	s.logChange(storage.ChangeUpdate, rec.link.Key(), storage.StatusDeleted, "", "")
+	return nil
+}
+
+func (s *MapStorage) DisableUrl(ctx context.Context, domain, alias string) error {
+	return s.switchStatus(ctx, "storage.MapStorage.DisableUrl", domain, alias, storage.StatusActive, storage.StatusDisabled)
+}
+
+func (s *MapStorage) EnableUrl(ctx context.Context, domain, alias string) error {
+	return s.switchStatus(ctx, "storage.MapStorage.EnableUrl", domain, alias, storage.StatusDisabled, storage.StatusActive)
+}
+
+// switchStatus переводит не удаленную ссылку из from в to. ErrUnchanged, если она уже не в from.
+func (s *MapStorage) switchStatus(ctx context.Context, op, domain, alias string, from, to storage.Status) error {
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
+	if !exists || rec.link.Status == storage.StatusDeleted {
+		return storage.ErrNotFound
+	}
+
+	if rec.link.Status != from {
+		return storage.ErrUnchanged
+	}
+	rec.link.Status = to
+	rec.link.UpdatedAt = time.Now()
+	s.logChange(storage.ChangeUpdate, rec.link.Key(), to, "", "")
+	return nil
+}
+
+func (s *MapStorage) RestoreUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.MapStorage.RestoreUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.store[alias]; !exists {
+	rec, exists := s.store[storage.Key{Domain: domain, Alias: alias}]
+	if !exists || rec.link.Status != storage.StatusDeleted {
 		return storage.ErrNotFound
 	}
 
-	delete(s.store, alias)
+	rec.link.Status = storage.StatusActive
+	rec.link.UpdatedAt = time.Now()
+	rec.deletedAt = time.Time{}
+	s.logChange(storage.ChangeUpdate, rec.link.Key(), storage.StatusActive, "", "")
 	return nil
 }
 
+func (s *MapStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.MapStorage.PurgeDeleted"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for key, rec := range s.store {
+		if rec.link.Status == storage.StatusDeleted && rec.deletedAt.Before(before) {
+			delete(s.store, key)
+			s.logChange(storage.ChangeDelete, key, "", "", storage.ReasonPurged)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MapStorage) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	const op = "storage.MapStorage.PurgeStale"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*record, 0)
+	for _, rec := range s.store {
+		if filter.Match(rec.link) {
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].seq < records[j].seq
+	})
+	if filter.DryRun && filter.Offset > 0 {
+		records = records[min(filter.Offset, len(records)):]
+	}
+	if filter.Limit > 0 && filter.Limit < len(records) {
+		records = records[:filter.Limit]
+	}
+
+	keys := make([]storage.Key, 0, len(records))
+	for _, rec := range records {
+		keys = append(keys, rec.link.Key())
+		if !filter.DryRun {
+			delete(s.store, rec.link.Key())
+			s.logChange(storage.ChangeDelete, rec.link.Key(), "", "", filter.Reason(rec.link))
+		}
+	}
+	return keys, nil
+}
+
 func (s *MapStorage) Disconnect(ctx context.Context) error {
 	return nil
 }
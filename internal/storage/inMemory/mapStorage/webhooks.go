@@ -0,0 +1,184 @@
+package mapStorage
+
+import (
+	"context"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Подписки, outbox и позиция журнала в памяти живут до перезапуска, как и ссылки MapStorage.
+
+func (s *MapStorage) SaveWebhook(ctx context.Context, webhook storage.Webhook) error {
+	const op = "storage.MapStorage.SaveWebhook"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook.Events = slices.Clone(webhook.Events)
+	webhook.Domains = slices.Clone(webhook.Domains)
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	s.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (s *MapStorage) ListWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	const op = "storage.MapStorage.ListWebhooks"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]storage.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhook.Events = slices.Clone(webhook.Events)
+		webhook.Domains = slices.Clone(webhook.Domains)
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (s *MapStorage) DeleteWebhook(ctx context.Context, id string) error {
+	const op = "storage.MapStorage.DeleteWebhook"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (s *MapStorage) WebhookOffset(ctx context.Context) (string, error) {
+	const op = "storage.MapStorage.WebhookOffset"
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.webhookOffset, nil
+}
+
+func (s *MapStorage) EnqueueDeliveries(ctx context.Context, deliveries []storage.Delivery, from, to string) error {
+	const op = "storage.MapStorage.EnqueueDeliveries"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.webhookOffset != from {
+		return storage.ErrOffsetMoved
+	}
+	s.webhookOffset = to
+
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if _, ok := s.deliveries[delivery.ID]; ok {
+			continue
+		}
+		delivery.Payload = slices.Clone(delivery.Payload)
+		if delivery.CreatedAt.IsZero() {
+			delivery.CreatedAt = now
+		}
+		s.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+func (s *MapStorage) ClaimDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]storage.Delivery, error) {
+	const op = "storage.MapStorage.ClaimDeliveries"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []storage.Delivery
+	for _, delivery := range s.deliveries {
+		if !delivery.NextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i, delivery := range due {
+		leased := delivery
+		leased.NextAttempt = now.Add(lease)
+		s.deliveries[delivery.ID] = leased
+		due[i].Payload = slices.Clone(delivery.Payload)
+	}
+	return due, nil
+}
+
+func (s *MapStorage) CompleteDelivery(ctx context.Context, id string) error {
+	const op = "storage.MapStorage.CompleteDelivery"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deliveries, id)
+	return nil
+}
+
+func (s *MapStorage) RetryDelivery(ctx context.Context, id string, attempts int, next time.Time, lastErr string) error {
+	const op = "storage.MapStorage.RetryDelivery"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	delivery.Attempts = attempts
+	delivery.NextAttempt = next
+	delivery.LastError = lastErr
+	s.deliveries[id] = delivery
+	return nil
+}
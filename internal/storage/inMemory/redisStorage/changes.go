@@ -0,0 +1,92 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/go-redis/redis/v8"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// offsetPattern id записи stream: "<unix ms>-<номер>".
+var offsetPattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// addChange добавляет запись журнала в транзакцию изменения ссылки id.
+func (r *RedisStorage) addChange(ctx context.Context, pipe redis.Pipeliner, op storage.ChangeOp, id string,
+	status storage.Status, url string, reason storage.ChangeReason) {
+	domain, alias := splitID(id)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.keys.key(changesKey),
+		Values: []interface{}{"op", string(op), "domain", domain, "alias", alias, "status", string(status), "url", url,
+			"reason", string(reason)},
+	})
+}
+
+// ReadChanges читает stream после offset. Позиция - id записи stream.
+func (r *RedisStorage) ReadChanges(ctx context.Context, offset string, limit int) ([]storage.Change, error) {
+	const op = "storage.RedisStorage.ReadChanges"
+
+	if offset == "" {
+		offset = "0"
+	} else if !offsetPattern.MatchString(offset) {
+		return nil, storage.ErrBadOffset
+	}
+
+	streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{r.keys.key(changesKey), offset},
+		Count:   int64(limit),
+		Block:   -1, // без ожидания, ждет вызывающий
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: offset='%s'. %w", op, offset, err)
+	}
+
+	var changes []storage.Change
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			changes = append(changes, changeFromMessage(message))
+		}
+	}
+	return changes, nil
+}
+
+// changeFromMessage переводит запись stream в изменение; время берется из id записи.
+func changeFromMessage(message redis.XMessage) storage.Change {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+
+	change := storage.Change{
+		Offset: message.ID,
+		Op:     storage.ChangeOp(field("op")),
+		Domain: field("domain"),
+		Alias:  field("alias"),
+		Status: storage.Status(field("status")),
+		Url:    field("url"),
+		Reason: storage.ChangeReason(field("reason")),
+	}
+	ms, _, _ := strings.Cut(message.ID, "-")
+	if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+		change.At = time.UnixMilli(n)
+	}
+	return change
+}
+
+// PurgeChanges удаляет записи stream старше before.
+func (r *RedisStorage) PurgeChanges(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.RedisStorage.PurgeChanges"
+
+	purged, err := r.client.XTrimMinID(ctx, r.keys.key(changesKey), strconv.FormatInt(before.UnixMilli(), 10)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return purged, nil
+}
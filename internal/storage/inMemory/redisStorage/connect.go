@@ -2,26 +2,169 @@ package redisStorage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/go-redis/redis/v8"
+	"log"
+	"net"
 	"os"
+	"time"
 )
 
-func Connect(ctx context.Context) (*RedisStorage, error) {
+// Config настройки подключения к Redis.
+//
+// Режим выбирается по настройкам: MasterName - Sentinel, Addrs - адреса sentinel;
+// несколько Addrs или Cluster - Redis Cluster, Addrs - начальные узлы;
+// иначе один сервер Addrs[0].
+type Config struct {
+	Addrs      []string
+	MasterName string // имя master в Sentinel
+	Cluster    bool   // Cluster и при одном начальном адресе
 
-	addr := os.Getenv("REDIS_ADDR")
-	if addr == "" {
-		return nil, fmt.Errorf("ошибка: пустой REDIS_ADDR в переменной окр")
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int // только для одного сервера и Sentinel
+
+	// пространство имен ключей; в Cluster по умолчанию "url-shortener",
+	// иначе пусто - ключи без префикса, как до появления настройки
+	KeyPrefix string
+
+	PoolSize     int // 0 - по умолчанию go-redis
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	TLS        bool
+	CAFile     string // пусто - системные CA
+	CertFile   string // сертификат клиента
+	KeyFile    string
+	ServerName string // пусто - хост первого адреса
+}
+
+// defaultClusterPrefix пространство имен ключей в Cluster, если KeyPrefix пуст.
+const defaultClusterPrefix = "url-shortener"
+
+func (c Config) cluster() bool {
+	return c.MasterName == "" && (c.Cluster || len(c.Addrs) > 1)
+}
+
+// Options переводит настройки в параметры go-redis.
+func (c Config) Options() (*redis.UniversalOptions, error) {
+	if len(c.Addrs) == 0 {
+		return nil, fmt.Errorf("ошибка: не заданы адреса Redis")
+	}
+	if c.cluster() && c.DB != 0 {
+		return nil, fmt.Errorf("ошибка: Redis Cluster поддерживает только базу 0")
 	}
 
-	r := &RedisStorage{
-		client: redis.NewClient(&redis.Options{
-			Addr: addr,
-		}),
+	opts := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		DB:               c.DB,
+		PoolSize:         c.PoolSize,
+		DialTimeout:      c.DialTimeout,
+		ReadTimeout:      c.ReadTimeout,
+		WriteTimeout:     c.WriteTimeout,
+	}
+
+	if c.TLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+// tlsConfig собирает TLS по файлам конфига. go-redis не выводит ServerName из адреса,
+// поэтому без ServerName берется хост первого адреса.
+func (c Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.Addrs[0])
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: адрес Redis '%s'. %w", c.Addrs[0], err)
+		}
+		tlsConfig.ServerName = host
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: CA Redis. %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ошибка: CA Redis '%s' без сертификатов", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: сертификат клиента Redis. %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
+	return tlsConfig, nil
+}
+
+// prefix возвращает префикс ключей. В Cluster он всегда hash tag, см. keyspace.
+func (c Config) prefix() keyspace {
+	ns := c.KeyPrefix
+	if c.cluster() {
+		if ns == "" {
+			ns = defaultClusterPrefix
+		}
+		return keyspace("{" + ns + "}:")
+	}
+	if ns == "" {
+		return ""
+	}
+	return keyspace(ns + ":")
+}
+
+// New создает хранилище над готовым клиентом; используется и в тестах.
+func New(client redis.UniversalClient, cfg Config) *RedisStorage {
+	return &RedisStorage{client: client, keys: cfg.prefix()}
+}
+
+// Connect подключается к Redis и переносит ссылки старой раскладки ключей, см. MigrateLayout.
+func Connect(ctx context.Context, cfg Config) (*RedisStorage, error) {
+	const op = "redisStorage.Connect"
+
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	var client redis.UniversalClient
+	if cfg.cluster() {
+		// NewUniversalClient выбирает Cluster только по числу адресов
+		client = redis.NewClusterClient(opts.Cluster())
+	} else {
+		client = redis.NewUniversalClient(opts)
+	}
+
+	r := New(client, cfg)
 	if err := r.client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("ошибка при подключении к Redis: %v", err)
 	}
 
+	migrated, err := r.MigrateLayout(ctx)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if migrated > 0 {
+		log.Printf("%s: ссылок перенесено в hash на ссылку: %d", op, migrated)
+	}
+
 	return r, nil
 }
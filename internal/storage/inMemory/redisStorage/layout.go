@@ -0,0 +1,135 @@
+package redisStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"time"
+)
+
+// layoutVersion текущая раскладка ключей: 2 - hash link:<id> на ссылку.
+// Раскладка 1 хранила ссылку в строковом ключе <id> и ключах status:, meta:, times:,
+// clicks:, uses: рядом с ним.
+const layoutVersion = "2"
+
+// legacyPrefixes строковые служебные ключи: раскладки 1, кроме Url ссылок, и webhooks:offset.
+// Остальные служебные ключи - hash, sorted set и stream, их SCAN по типу string не возвращает.
+// Хранилище считает пространство имен своим: чужие строковые ключи в нем приняли бы за ссылки.
+var legacyPrefixes = []string{"status:", "meta:", "uses:", "urls:", "webhooks:"}
+
+// migrateScript переносит ссылку KEYS[1] раскладки 1 в hash KEYS[7] и удаляет старые ключи.
+// KEYS[2..6] - status, meta, times, clicks, uses; KEYS[8] - индекс, в который не попали
+// ссылки, созданные до его появления. ARGV[1] - id, ARGV[2] - время переноса.
+// 0 - переносить нечего: ключ уже перенесен или hash ссылки существует.
+var migrateScript = redis.NewScript(`
+if redis.call("TYPE", KEYS[1]).ok ~= "string" or redis.call("EXISTS", KEYS[7]) == 1 then
+	return 0
+end
+local fields = {"url", redis.call("GET", KEYS[1]), "status", redis.call("GET", KEYS[2]) or "active"}
+local meta = redis.call("GET", KEYS[3])
+if meta then
+	table.insert(fields, "meta")
+	table.insert(fields, meta)
+end
+local times = redis.call("HGETALL", KEYS[4])
+local created = ARGV[2]
+for i = 1, #times, 2 do
+	table.insert(fields, times[i])
+	table.insert(fields, times[i + 1])
+	if times[i] == "created" then
+		created = times[i + 1]
+	end
+end
+local clicks = redis.call("HGETALL", KEYS[5])
+for i = 1, #clicks, 2 do
+	table.insert(fields, "click:" .. clicks[i])
+	table.insert(fields, clicks[i + 1])
+end
+local uses = redis.call("GET", KEYS[6])
+if uses then
+	table.insert(fields, "uses")
+	table.insert(fields, uses)
+end
+redis.call("HSET", KEYS[7], unpack(fields))
+if not redis.call("ZSCORE", KEYS[8], ARGV[1]) then
+	redis.call("ZADD", KEYS[8], created, ARGV[1])
+end
+redis.call("DEL", KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6])
+return 1
+`)
+
+// MigrateLayout переносит ссылки раскладки 1 в hash на ссылку и отмечает версию раскладки.
+// Каждая ссылка переносится одним скриптом, поэтому реплики, запущенные одновременно,
+// не мешают друг другу, а прерванный перенос можно повторить. Возвращает число
+// перенесенных ссылок; если раскладка уже текущая, ключи не перебираются.
+func (r *RedisStorage) MigrateLayout(ctx context.Context) (int, error) {
+	const op = "storage.RedisStorage.MigrateLayout"
+
+	version, err := r.client.Get(ctx, r.keys.key(layoutKey)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if version == layoutVersion {
+		return 0, nil
+	}
+
+	migrated := 0
+	scan := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.ScanType(ctx, 0, string(r.keys)+"*", 1000, "string").Iterator()
+		for iter.Next(ctx) {
+			id, ok := legacyID(strings.TrimPrefix(iter.Val(), string(r.keys)))
+			if !ok {
+				continue
+			}
+			keys := []string{
+				r.keys.key(id),
+				r.keys.key("status:" + id),
+				r.keys.key("meta:" + id),
+				r.keys.key("times:" + id),
+				r.keys.key("clicks:" + id),
+				r.keys.key("uses:" + id),
+				r.keys.link(id),
+				r.keys.key(indexKey),
+			}
+			n, err := migrateScript.Run(ctx, r.client, keys, id, time.Now().UnixNano()).Int()
+			if err != nil {
+				return fmt.Errorf("id='%s'. %w", id, err)
+			}
+			migrated += n
+		}
+		return iter.Err()
+	}
+
+	// в Cluster SCAN видит ключи одного узла
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scan(ctx, c)
+		})
+	} else {
+		err = scan(ctx, r.client)
+	}
+	if err != nil {
+		return migrated, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = r.client.Set(ctx, r.keys.key(layoutKey), layoutVersion, 0).Err(); err != nil {
+		return migrated, fmt.Errorf("%s: %w", op, err)
+	}
+	return migrated, nil
+}
+
+// legacyID возвращает id ссылки, если строковый ключ без префикса пространства имен -
+// Url ссылки раскладки 1.
+func legacyID(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	for _, prefix := range legacyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return "", false
+		}
+	}
+	return key, true
+}
@@ -2,79 +2,704 @@ package redisStorage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// Ключи хранилища. <id> - alias для домена по умолчанию и <domain>/<alias> для остальных.
+// Все ключи начинаются с префикса пространства имен, см. keyspace:
+//
+//	link:<id>       - hash ссылки, поля см. ниже
+//	urls:index      - sorted set всех id, score - время создания
+//	tag:<tag>       - sorted set id с тегом, score - время создания
+//	urls:deleted    - sorted set мягко удаленных id, score - unix время удаления
+//	urls:changes    - stream изменений ссылок, пишется в одной транзакции с изменением
+//	urls:layout     - версия раскладки ключей, см. MigrateLayout
+//
+// Ссылка целиком лежит в одном ключе, поэтому создание и изменение ссылки
+// атомарны без WATCH нескольких ключей.
+const (
+	linkKeyPrefix = "link:"
+	tagKeyPrefix  = "tag:"
+	indexKey      = "urls:index"
+	deletedKey    = "urls:deleted"
+	changesKey    = "urls:changes"
+	layoutKey     = "urls:layout"
+)
+
+// Поля hash link:<id>
+const (
+	urlField      = "url"
+	statusField   = "status"
+	metaField     = "meta" // метаданные ссылки в JSON
+	createdField  = "created"
+	updatedField  = "updated"
+	accessedField = "accessed" // время в unix nano
+	expiresField  = "expires"
+	usesField     = "uses"   // оставшиеся использования, только у ссылок с ограничением
+	clickPrefix   = "click:" // click:<n> - переходы по варианту n
+)
+
+// keyspace префикс ключей хранилища. Транзакции и скрипты трогают ключ ссылки вместе
+// с общими индексами и журналом, поэтому в Cluster префикс - hash tag вида "{ns}:",
+// и все ключи лежат в одном слоте. Пустой префикс - ключи без пространства имен.
+type keyspace string
+
+func (k keyspace) link(id string) string {
+	return string(k) + linkKeyPrefix + id
+}
+
+func (k keyspace) tag(tag string) string {
+	return string(k) + tagKeyPrefix + tag
+}
+
+// key возвращает общий ключ name, например indexKey, с префиксом.
+func (k keyspace) key(name string) string {
+	return string(k) + name
+}
+
+// listBatch размер порции alias, читаемых за раз в ListUrls.
+const listBatch = 100
+
+// meta метаданные ссылки, хранимые рядом с Url.
+type meta struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+
+	Rules        []storage.Rule        `json:"rules,omitempty"`
+	Destinations []storage.Destination `json:"destinations,omitempty"`
+
+	PasswordHash string `json:"password_hash,omitempty"`
+	MaxUses      int64  `json:"max_uses,omitempty"`
+
+	Preview bool          `json:"preview,omitempty"`
+	Page    *storage.Page `json:"page,omitempty"`
+
+	ForwardQuery storage.QueryForward `json:"forward_query,omitempty"`
+	ForwardPath  bool                 `json:"forward_path,omitempty"`
+	Template     bool                 `json:"template,omitempty"`
+}
+
 type RedisStorage struct {
-	client *redis.Client
+	client redis.UniversalClient
+	keys   keyspace
+}
+
+// linkID возвращает идентификатор ссылки в ключах хранилища.
+func linkID(domain, alias string) string {
+	if domain == "" {
+		return alias
+	}
+	return domain + "/" + alias
+}
+
+// splitID разбирает идентификатор ссылки на домен и alias.
+func splitID(id string) (domain, alias string) {
+	if i := strings.LastIndexByte(id, '/'); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return "", id
 }
 
-func (r *RedisStorage) SaveUrl(ctx context.Context, alias, UrlSave string) error {
+// saveScript создает ссылку, только если ключа KEYS[1] еще нет, и в том же скрипте
+// добавляет ее в индекс KEYS[2], теги KEYS[4..] и журнал KEYS[3]. 0 - alias занят.
+var saveScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "url", ARGV[2], "status", "active", "meta", ARGV[3],
+	"created", ARGV[4], "updated", ARGV[4])
+if ARGV[5] ~= "0" then
+	redis.call("HSET", KEYS[1], "expires", ARGV[5])
+end
+if ARGV[6] ~= "" then
+	redis.call("HSET", KEYS[1], "uses", ARGV[6])
+end
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[1])
+for i = 4, #KEYS do
+	redis.call("ZADD", KEYS[i], ARGV[4], ARGV[1])
+end
+redis.call("XADD", KEYS[3], "*", "op", "insert", "domain", ARGV[7], "alias", ARGV[8],
+	"status", "active", "url", ARGV[2])
+return 1
+`)
+
+func (r *RedisStorage) SaveUrl(ctx context.Context, link storage.Link) error {
 	const op = "storage.RedisStorage.SaveUrl"
 
-	if alias == "" {
+	if link.Alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
 
-	if UrlSave == "" {
+	if link.Url == "" {
 		return storage.ErrUrlIsEmpty
 	}
+	if utf8.RuneCountInString(link.Url) > storage.MaxUrlLength {
+		return storage.ErrUrlTooLong
+	}
 
-	exists, err := r.client.Exists(ctx, alias).Result()
+	id := linkID(link.Domain, link.Alias)
+	data, err := json.Marshal(meta{
+		Title:        link.Title,
+		Description:  link.Description,
+		Tags:         link.Tags,
+		Notes:        link.Notes,
+		Rules:        link.Rules,
+		Destinations: link.Destinations,
+		PasswordHash: link.PasswordHash,
+		MaxUses:      link.MaxUses,
+		Preview:      link.Preview,
+		Page:         pageOrNil(link.Page),
+		ForwardQuery: link.ForwardQuery,
+		ForwardPath:  link.ForwardPath,
+		Template:     link.Template,
+	})
 	if err != nil {
-		return fmt.Errorf("%s: url='%s', alias='%s'. %w", op, UrlSave, alias, err)
+		return fmt.Errorf("%s: url='%s', id='%s'. %w", op, link.Url, id, err)
 	}
 
-	if exists > 0 {
-		return storage.ErrExistAlias
+	var expires int64
+	if !link.ExpiresAt.IsZero() {
+		expires = link.ExpiresAt.UnixNano()
+	}
+	uses := ""
+	if link.MaxUses > 0 {
+		uses = strconv.FormatInt(link.UsesLeft, 10)
 	}
 
-	cmd := r.client.Set(ctx, alias, UrlSave, 0)
-	if cmd.Err() != nil {
-		return fmt.Errorf("%s: url='%s', alias='%s'. %w", op, UrlSave, alias, cmd.Err())
+	keys := []string{r.keys.link(id), r.keys.key(indexKey), r.keys.key(changesKey)}
+	for _, tag := range link.Tags {
+		keys = append(keys, r.keys.tag(tag))
+	}
+	created, err := saveScript.Run(ctx, r.client, keys,
+		id, link.Url, data, time.Now().UnixNano(), expires, uses, link.Domain, link.Alias).Int()
+	if err != nil {
+		return fmt.Errorf("%s: url='%s', id='%s'. %w", op, link.Url, id, err)
+	}
+	if created == 0 {
+		return storage.ErrExistAlias
 	}
 
 	return nil
 }
 
-func (r *RedisStorage) GetUrl(ctx context.Context, alias string) (string, error) {
+func (r *RedisStorage) GetUrl(ctx context.Context, domain, alias string) (storage.Link, error) {
 	const op = "storage.RedisStorage.GetUrl"
 
 	if alias == "" {
-		return "", storage.ErrAliasIsEmpty
+		return storage.Link{}, storage.ErrAliasIsEmpty
+	}
+
+	id := linkID(domain, alias)
+	links, err := r.getLinks(ctx, id)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	link := links[0]
+	if link.Expired(time.Now()) {
+		return storage.Link{}, storage.ErrNotFound
+	}
+
+	switch link.Status {
+	case "", storage.StatusDeleted:
+		return storage.Link{}, storage.ErrNotFound
+	case storage.StatusDisabled:
+		return storage.Link{}, storage.ErrDisabled
+	}
+
+	return link, nil
+}
+
+func (r *RedisStorage) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	const op = "storage.RedisStorage.ListUrls"
+
+	key := r.keys.key(indexKey)
+	if filter.Tag != "" {
+		key = r.keys.tag(filter.Tag)
+	}
+
+	var links []storage.Link
+	skipped := 0
+	for start := int64(0); ; start += listBatch {
+		ids, err := r.client.ZRange(ctx, key, start, start+listBatch-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%s: tag='%s'. %w", op, filter.Tag, err)
+		}
+		if len(ids) == 0 {
+			return links, nil
+		}
+
+		batch, err := r.getLinks(ctx, ids...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tag='%s'. %w", op, filter.Tag, err)
+		}
+
+		for _, link := range batch {
+			// "" - ключ уже очищен, индекс догонит при следующей очистке
+			if link.Status == "" || link.Status == storage.StatusDeleted {
+				continue
+			}
+			if skipped < filter.Offset {
+				skipped++
+				continue
+			}
+			links = append(links, link)
+			if filter.Limit > 0 && len(links) == filter.Limit {
+				return links, nil
+			}
+		}
+	}
+}
+
+// getLinks читает ссылки одним запросом. Для отсутствующей ссылки Status пустой.
+func (r *RedisStorage) getLinks(ctx context.Context, ids ...string) ([]storage.Link, error) {
+	return r.readLinks(ctx, r.client, ids...)
+}
+
+// readLinks читает ссылки через c, в том числе внутри WATCH.
+func (r *RedisStorage) readLinks(ctx context.Context, c redis.Cmdable, ids ...string) ([]storage.Link, error) {
+	pipe := c.Pipeline()
+	fields := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		fields[i] = pipe.HGetAll(ctx, r.keys.link(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	links := make([]storage.Link, len(ids))
+	for i, id := range ids {
+		link, err := parseLink(id, fields[i].Val())
+		if err != nil {
+			return nil, fmt.Errorf("id='%s'. %w", id, err)
+		}
+		links[i] = link
+	}
+
+	return links, nil
+}
+
+// parseLink собирает ссылку из полей hash. Без поля url ссылки нет, Status пустой.
+func parseLink(id string, fields map[string]string) (storage.Link, error) {
+	Url, ok := fields[urlField]
+	if !ok {
+		return storage.Link{}, nil
+	}
+
+	var m meta
+	if data := fields[metaField]; data != "" {
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return storage.Link{}, err
+		}
+	}
+
+	for field, val := range fields {
+		variant, ok := strings.CutPrefix(field, clickPrefix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(variant)
+		if err != nil || n < 0 || n >= len(m.Destinations) {
+			continue
+		}
+		m.Destinations[n].Clicks, _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	status := storage.StatusActive
+	if s := fields[statusField]; s != "" {
+		status = storage.Status(s)
+	}
+	usesLeft, _ := strconv.ParseInt(fields[usesField], 10, 64)
+
+	domain, alias := splitID(id)
+	link := storage.Link{
+		Domain:         domain,
+		Alias:          alias,
+		Url:            Url,
+		Title:          m.Title,
+		Description:    m.Description,
+		Tags:           m.Tags,
+		Notes:          m.Notes,
+		Rules:          m.Rules,
+		Destinations:   m.Destinations,
+		PasswordHash:   m.PasswordHash,
+		MaxUses:        m.MaxUses,
+		UsesLeft:       usesLeft,
+		Preview:        m.Preview,
+		ForwardQuery:   m.ForwardQuery,
+		ForwardPath:    m.ForwardPath,
+		Template:       m.Template,
+		Status:         status,
+		CreatedAt:      parseUnixNano(fields[createdField]),
+		UpdatedAt:      parseUnixNano(fields[updatedField]),
+		LastAccessedAt: parseUnixNano(fields[accessedField]),
+		ExpiresAt:      parseUnixNano(fields[expiresField]),
+	}
+	if m.Page != nil {
+		link.Page = *m.Page
+	}
+	return link, nil
+}
+
+// pageOrNil возвращает nil для пустых сведений о странице, чтобы они не попадали в meta.
+func pageOrNil(page storage.Page) *storage.Page {
+	if page == (storage.Page{}) {
+		return nil
+	}
+	return &page
+}
+
+// parseUnixNano разбирает время, сохраненное в unix nano. Пустое значение - нулевое время.
+func parseUnixNano(val string) time.Time {
+	nano, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+func (r *RedisStorage) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	const op = "storage.RedisStorage.GetUrlInfo"
+
+	if alias == "" {
+		return storage.Link{}, storage.ErrAliasIsEmpty
+	}
+
+	id := linkID(domain, alias)
+	links, err := r.getLinks(ctx, id)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	if links[0].Status == "" {
+		return storage.Link{}, storage.ErrNotFound
+	}
+
+	return links[0], nil
+}
+
+// touchScript обновляет accessed, только если ссылка существует и новое время больше,
+// и прибавляет переходы по вариантам: ARGV[2..] - пары индекс варианта, число переходов.
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local cur = tonumber(redis.call("HGET", KEYS[1], "accessed") or "0")
+if cur < tonumber(ARGV[1]) then
+	redis.call("HSET", KEYS[1], "accessed", ARGV[1])
+end
+for i = 2, #ARGV, 2 do
+	redis.call("HINCRBY", KEYS[1], "click:" .. ARGV[i], ARGV[i + 1])
+end
+return 1
+`)
+
+func (r *RedisStorage) TouchUrls(ctx context.Context, accessed map[storage.Key]storage.Access) error {
+	const op = "storage.RedisStorage.TouchUrls"
+
+	if len(accessed) == 0 {
+		return nil
 	}
 
-	cmd := r.client.Get(ctx, alias)
-	if cmd.Err() != nil {
-		if errors.Is(cmd.Err(), redis.Nil) {
-			return "", storage.ErrNotFound
+	pipe := r.client.Pipeline()
+	for key, access := range accessed {
+		id := linkID(key.Domain, key.Alias)
+		args := make([]any, 0, 1+len(access.Clicks)*2)
+		args = append(args, access.At.UnixNano())
+		for variant, clicks := range access.Clicks {
+			args = append(args, variant, clicks)
 		}
-		return "", fmt.Errorf("%s: alias='%s'. %w", op, alias, cmd.Err())
+		touchScript.Eval(ctx, pipe, []string{r.keys.link(id)}, args...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Ответы useScript, кроме неотрицательного остатка
+const (
+	useNotFound  = -1
+	useUnlimited = -2
+	useExhausted = -3
+)
+
+// useScript списывает использование, если ссылка существует, не удалена и они остались.
+// Последнее использование пишется в журнал изменений KEYS[2].
+var useScript = redis.NewScript(`
+local status = redis.call("HGET", KEYS[1], "status")
+if not status or status == "deleted" then
+	return -1
+end
+local left = redis.call("HGET", KEYS[1], "uses")
+if not left then
+	return -2
+end
+if tonumber(left) <= 0 then
+	return -3
+end
+left = redis.call("HINCRBY", KEYS[1], "uses", -1)
+if left == 0 then
+	redis.call("XADD", KEYS[2], "*", "op", "update", "domain", ARGV[1], "alias", ARGV[2], "status", status,
+		"reason", "exhausted")
+end
+return left
+`)
+
+func (r *RedisStorage) UseUrl(ctx context.Context, domain, alias string) (int64, error) {
+	const op = "storage.RedisStorage.UseUrl"
+
+	if alias == "" {
+		return 0, storage.ErrAliasIsEmpty
+	}
+
+	id := linkID(domain, alias)
+	left, err := useScript.Run(ctx, r.client, []string{r.keys.link(id), r.keys.key(changesKey)}, domain, alias).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%s: id='%s'. %w", op, id, err)
 	}
 
-	return cmd.Val(), nil
+	switch left {
+	case useNotFound:
+		return 0, storage.ErrNotFound
+	case useUnlimited:
+		return -1, nil
+	case useExhausted:
+		return 0, storage.ErrExhausted
+	}
+	return left, nil
 }
 
-func (r *RedisStorage) DeleteUrl(ctx context.Context, alias string) error {
+func (r *RedisStorage) DeleteUrl(ctx context.Context, domain, alias string) error {
 	const op = "storage.RedisStorage.DeleteUrl"
 
 	if alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
 
-	cmd := r.client.Del(ctx, alias)
-	if cmd.Err() != nil {
-		return fmt.Errorf("%s: alias='%s'. %w", op, alias, cmd.Err())
+	id := linkID(domain, alias)
+	err := r.switchStatus(ctx, id, func(status storage.Status) bool {
+		return status != storage.StatusDeleted
+	}, storage.StatusDeleted)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrUnchanged) {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	return err
+}
+
+func (r *RedisStorage) DisableUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.RedisStorage.DisableUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	id := linkID(domain, alias)
+	err := r.switchStatus(ctx, id, func(status storage.Status) bool {
+		return status != storage.StatusDeleted
+	}, storage.StatusDisabled)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrUnchanged) {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
 	}
 
-	if cmd.Val() == 0 {
-		return storage.ErrNotFound
+	return err
+}
+
+func (r *RedisStorage) EnableUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.RedisStorage.EnableUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
 	}
 
-	return nil
+	id := linkID(domain, alias)
+	err := r.switchStatus(ctx, id, func(status storage.Status) bool {
+		return status != storage.StatusDeleted
+	}, storage.StatusActive)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrUnchanged) {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	return err
+}
+
+func (r *RedisStorage) RestoreUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.RedisStorage.RestoreUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	id := linkID(domain, alias)
+	err := r.switchStatus(ctx, id, func(status storage.Status) bool {
+		return status == storage.StatusDeleted
+	}, storage.StatusActive)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrUnchanged) {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	return err
+}
+
+func (r *RedisStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.RedisStorage.PurgeDeleted"
+
+	ids, err := r.client.ZRangeByScore(ctx, r.keys.key(deletedKey), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(before.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var purged int64
+	for _, id := range ids {
+		// ссылка могла быть восстановлена после выборки
+		ok, err := r.purgeLink(ctx, id, func(link storage.Link) bool {
+			return link.Status == storage.StatusDeleted
+		}, func(storage.Link) storage.ChangeReason {
+			return storage.ReasonPurged
+		})
+		if err != nil {
+			return purged, fmt.Errorf("%s: id='%s'. %w", op, id, err)
+		}
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// switchStatus атомарно переводит ссылку в статус to, если allowed разрешает текущий статус.
+// Повторная установка того же статуса возвращает ErrUnchanged.
+func (r *RedisStorage) switchStatus(ctx context.Context, id string, allowed func(storage.Status) bool, to storage.Status) error {
+	key := r.keys.link(id)
+	return r.client.Watch(ctx, func(tx *redis.Tx) error {
+		status, err := tx.HGet(ctx, key, statusField).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return storage.ErrNotFound
+			}
+			return err
+		}
+		if !allowed(storage.Status(status)) {
+			return storage.ErrNotFound
+		}
+
+		if storage.Status(status) == to {
+			return storage.ErrUnchanged
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, statusField, string(to), updatedField, time.Now().UnixNano())
+			if to == storage.StatusDeleted {
+				pipe.ZAdd(ctx, r.keys.key(deletedKey), &redis.Z{Score: float64(time.Now().Unix()), Member: id})
+			} else {
+				pipe.ZRem(ctx, r.keys.key(deletedKey), id)
+			}
+			r.addChange(ctx, pipe, storage.ChangeUpdate, id, to, "", "")
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (r *RedisStorage) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	const op = "storage.RedisStorage.PurgeStale"
+
+	var keys []storage.Key
+	skip := 0
+	if filter.DryRun {
+		skip = filter.Offset
+	}
+	for start := int64(0); ; {
+		batch, err := r.client.ZRange(ctx, r.keys.key(indexKey), start, start+listBatch-1).Result()
+		if err != nil {
+			return keys, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(batch) == 0 {
+			return keys, nil
+		}
+
+		links, err := r.getLinks(ctx, batch...)
+		if err != nil {
+			return keys, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// очищенные id уходят из индекса, и следующая порция сдвигается на их число
+		next := start + int64(len(batch))
+		for _, link := range links {
+			if link.Status == "" || !filter.Match(link) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if !filter.DryRun {
+				// к ссылке могли обратиться после выборки
+				id := linkID(link.Domain, link.Alias)
+				ok, err := r.purgeLink(ctx, id, filter.Match, filter.Reason)
+				if err != nil {
+					return keys, fmt.Errorf("%s: id='%s'. %w", op, id, err)
+				}
+				if !ok {
+					continue
+				}
+				next--
+			}
+			keys = append(keys, link.Key())
+			if filter.Limit > 0 && len(keys) == filter.Limit {
+				return keys, nil
+			}
+		}
+		start = next
+	}
+}
+
+// purgeLink удаляет ссылку, если она все еще подходит под match, и пишет в журнал причину reason.
+// Ссылка перечитывается под WATCH, поэтому параллельное изменение отменяет удаление.
+func (r *RedisStorage) purgeLink(ctx context.Context, id string, match func(storage.Link) bool,
+	reason func(storage.Link) storage.ChangeReason) (bool, error) {
+	var purged bool
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		links, err := r.readLinks(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		link := links[0]
+		if link.Status == "" || !match(link) {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, r.keys.link(id))
+			pipe.ZRem(ctx, r.keys.key(deletedKey), id)
+			pipe.ZRem(ctx, r.keys.key(indexKey), id)
+			for _, tag := range link.Tags {
+				pipe.ZRem(ctx, r.keys.tag(tag), id)
+			}
+			r.addChange(ctx, pipe, storage.ChangeDelete, id, "", "", reason(link))
+			return nil
+		})
+		purged = err == nil
+		return err
+	}, r.keys.link(id))
+
+	return purged, err
 }
 
 func (r *RedisStorage) Disconnect(ctx context.Context) error {
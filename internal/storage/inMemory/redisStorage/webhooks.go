@@ -0,0 +1,222 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/go-redis/redis/v8"
+	"sort"
+	"time"
+)
+
+// Ключи подписок и outbox:
+//
+//	webhooks            - hash, поле - id подписки, значение - подписка в JSON
+//	webhooks:deliveries - hash, поле - id доставки, значение - доставка в JSON
+//	webhooks:outbox     - sorted set id доставок, score - время следующей попытки (unix nano)
+//	webhooks:offset     - позиция urls:changes, до которой доставки уже поставлены
+const (
+	webhooksKey   = "webhooks"
+	deliveriesKey = "webhooks:deliveries"
+	outboxKey     = "webhooks:outbox"
+	offsetKey     = "webhooks:offset"
+)
+
+func (r *RedisStorage) SaveWebhook(ctx context.Context, webhook storage.Webhook) error {
+	const op = "storage.RedisStorage.SaveWebhook"
+
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(webhook)
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, webhook.ID, err)
+	}
+	if err = r.client.HSet(ctx, r.keys.key(webhooksKey), webhook.ID, data).Err(); err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, webhook.ID, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) ListWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	const op = "storage.RedisStorage.ListWebhooks"
+
+	values, err := r.client.HVals(ctx, r.keys.key(webhooksKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	webhooks := make([]storage.Webhook, 0, len(values))
+	for _, value := range values {
+		var webhook storage.Webhook
+		if err = json.Unmarshal([]byte(value), &webhook); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook удаляет подписку. Ее доставки остаются в outbox,
+// но отбрасываются отправителем, который не находит подписку.
+func (r *RedisStorage) DeleteWebhook(ctx context.Context, id string) error {
+	const op = "storage.RedisStorage.DeleteWebhook"
+
+	deleted, err := r.client.HDel(ctx, r.keys.key(webhooksKey), id).Result()
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	if deleted == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (r *RedisStorage) WebhookOffset(ctx context.Context) (string, error) {
+	const op = "storage.RedisStorage.WebhookOffset"
+
+	offset, err := r.client.Get(ctx, r.keys.key(offsetKey)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return offset, nil
+}
+
+// EnqueueDeliveries сверяет позицию под WATCH: если другая реплика перенесла ее
+// раньше, транзакция не выполняется и возвращается ErrOffsetMoved.
+func (r *RedisStorage) EnqueueDeliveries(ctx context.Context, deliveries []storage.Delivery, from, to string) error {
+	const op = "storage.RedisStorage.EnqueueDeliveries"
+
+	now := time.Now()
+	data := make([][]byte, len(deliveries))
+	for i, delivery := range deliveries {
+		if delivery.CreatedAt.IsZero() {
+			delivery.CreatedAt = now
+		}
+		var err error
+		if data[i], err = json.Marshal(delivery); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	key := r.keys.key(offsetKey)
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		offset, err := tx.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if offset != from {
+			return storage.ErrOffsetMoved
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, to, 0)
+			for i, delivery := range deliveries {
+				pipe.HSetNX(ctx, r.keys.key(deliveriesKey), delivery.ID, data[i])
+				pipe.ZAddNX(ctx, r.keys.key(outboxKey), &redis.Z{Score: float64(delivery.NextAttempt.UnixNano()), Member: delivery.ID})
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return storage.ErrOffsetMoved
+	}
+	if err != nil && !errors.Is(err, storage.ErrOffsetMoved) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return err
+}
+
+// claimScript выбирает наступившие доставки и откладывает их на время аренды.
+// Потерянные id без данных убираются из outbox.
+var claimScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+local result = {}
+for _, id in ipairs(ids) do
+	local data = redis.call("HGET", KEYS[2], id)
+	if data then
+		redis.call("ZADD", KEYS[1], ARGV[3], id)
+		table.insert(result, data)
+	else
+		redis.call("ZREM", KEYS[1], id)
+	end
+end
+return result
+`)
+
+func (r *RedisStorage) ClaimDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]storage.Delivery, error) {
+	const op = "storage.RedisStorage.ClaimDeliveries"
+
+	leaseUntil := now.Add(lease)
+	values, err := claimScript.Run(ctx, r.client, []string{r.keys.key(outboxKey), r.keys.key(deliveriesKey)},
+		now.UnixNano(), limit, leaseUntil.UnixNano()).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries := make([]storage.Delivery, 0, len(values))
+	for _, value := range values {
+		var delivery storage.Delivery
+		if err = json.Unmarshal([]byte(value), &delivery); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		delivery.NextAttempt = leaseUntil
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (r *RedisStorage) CompleteDelivery(ctx context.Context, id string) error {
+	const op = "storage.RedisStorage.CompleteDelivery"
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.keys.key(outboxKey), id)
+		pipe.HDel(ctx, r.keys.key(deliveriesKey), id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	return nil
+}
+
+// RetryDelivery перезаписывает доставку. Гонки нет: доставку держит аренда ClaimDeliveries.
+func (r *RedisStorage) RetryDelivery(ctx context.Context, id string, attempts int, next time.Time, lastErr string) error {
+	const op = "storage.RedisStorage.RetryDelivery"
+
+	value, err := r.client.HGet(ctx, r.keys.key(deliveriesKey), id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return storage.ErrNotFound
+		}
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+
+	var delivery storage.Delivery
+	if err = json.Unmarshal([]byte(value), &delivery); err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	delivery.Attempts = attempts
+	delivery.NextAttempt = next
+	delivery.LastError = lastErr
+
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.keys.key(deliveriesKey), id, data)
+		pipe.ZAdd(ctx, r.keys.key(outboxKey), &redis.Z{Score: float64(next.UnixNano()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	return nil
+}
@@ -7,10 +7,51 @@ package mock_storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	storage "github.com/RVodassa/url-shortener/internal/storage"
 	gomock "github.com/golang/mock/gomock"
 )
 
+// MockLocker is a mock of Locker interface.
+type MockLocker struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockerMockRecorder
+}
+
+// MockLockerMockRecorder is the mock recorder for MockLocker.
+type MockLockerMockRecorder struct {
+	mock *MockLocker
+}
+
+// NewMockLocker creates a new mock instance.
+func NewMockLocker(ctrl *gomock.Controller) *MockLocker {
+	mock := &MockLocker{ctrl: ctrl}
+	mock.recorder = &MockLockerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLocker) EXPECT() *MockLockerMockRecorder {
+	return m.recorder
+}
+
+// TryLock mocks base method.
+func (m *MockLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TryLock", ctx, name)
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TryLock indicates an expected call of TryLock.
+func (mr *MockLockerMockRecorder) TryLock(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryLock", reflect.TypeOf((*MockLocker)(nil).TryLock), ctx, name)
+}
+
 // MockStorage is a mock of Storage interface.
 type MockStorage struct {
 	ctrl     *gomock.Controller
@@ -35,17 +76,31 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 }
 
 // DeleteUrl mocks base method.
-func (m *MockStorage) DeleteUrl(ctx context.Context, alias string) error {
+func (m *MockStorage) DeleteUrl(ctx context.Context, domain, alias string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUrl", ctx, alias)
+	ret := m.ctrl.Call(m, "DeleteUrl", ctx, domain, alias)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUrl indicates an expected call of DeleteUrl.
-func (mr *MockStorageMockRecorder) DeleteUrl(ctx, alias interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) DeleteUrl(ctx, domain, alias interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockStorage)(nil).DeleteUrl), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockStorage)(nil).DeleteUrl), ctx, domain, alias)
+}
+
+// DisableUrl mocks base method.
+func (m *MockStorage) DisableUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableUrl indicates an expected call of DisableUrl.
+func (mr *MockStorageMockRecorder) DisableUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableUrl", reflect.TypeOf((*MockStorage)(nil).DisableUrl), ctx, domain, alias)
 }
 
 // Disconnect mocks base method.
@@ -62,31 +117,148 @@ func (mr *MockStorageMockRecorder) Disconnect(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disconnect", reflect.TypeOf((*MockStorage)(nil).Disconnect), ctx)
 }
 
+// EnableUrl mocks base method.
+func (m *MockStorage) EnableUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableUrl indicates an expected call of EnableUrl.
+func (mr *MockStorageMockRecorder) EnableUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableUrl", reflect.TypeOf((*MockStorage)(nil).EnableUrl), ctx, domain, alias)
+}
+
 // GetUrl mocks base method.
-func (m *MockStorage) GetUrl(ctx context.Context, alias string) (string, error) {
+func (m *MockStorage) GetUrl(ctx context.Context, domain, alias string) (storage.Link, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUrl", ctx, alias)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "GetUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(storage.Link)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUrl indicates an expected call of GetUrl.
-func (mr *MockStorageMockRecorder) GetUrl(ctx, alias interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrl", reflect.TypeOf((*MockStorage)(nil).GetUrl), ctx, domain, alias)
+}
+
+// GetUrlInfo mocks base method.
+func (m *MockStorage) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUrlInfo", ctx, domain, alias)
+	ret0, _ := ret[0].(storage.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUrlInfo indicates an expected call of GetUrlInfo.
+func (mr *MockStorageMockRecorder) GetUrlInfo(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrlInfo", reflect.TypeOf((*MockStorage)(nil).GetUrlInfo), ctx, domain, alias)
+}
+
+// ListUrls mocks base method.
+func (m *MockStorage) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUrls", ctx, filter)
+	ret0, _ := ret[0].([]storage.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUrls indicates an expected call of ListUrls.
+func (mr *MockStorageMockRecorder) ListUrls(ctx, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrl", reflect.TypeOf((*MockStorage)(nil).GetUrl), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUrls", reflect.TypeOf((*MockStorage)(nil).ListUrls), ctx, filter)
+}
+
+// PurgeDeleted mocks base method.
+func (m *MockStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted.
+func (mr *MockStorageMockRecorder) PurgeDeleted(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockStorage)(nil).PurgeDeleted), ctx, before)
+}
+
+// PurgeStale mocks base method.
+func (m *MockStorage) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeStale", ctx, filter)
+	ret0, _ := ret[0].([]storage.Key)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeStale indicates an expected call of PurgeStale.
+func (mr *MockStorageMockRecorder) PurgeStale(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeStale", reflect.TypeOf((*MockStorage)(nil).PurgeStale), ctx, filter)
+}
+
+// RestoreUrl mocks base method.
+func (m *MockStorage) RestoreUrl(ctx context.Context, domain, alias string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUrl indicates an expected call of RestoreUrl.
+func (mr *MockStorageMockRecorder) RestoreUrl(ctx, domain, alias interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUrl", reflect.TypeOf((*MockStorage)(nil).RestoreUrl), ctx, domain, alias)
 }
 
 // SaveUrl mocks base method.
-func (m *MockStorage) SaveUrl(ctx context.Context, alias, UrlSave string) error {
+func (m *MockStorage) SaveUrl(ctx context.Context, link storage.Link) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveUrl", ctx, alias, UrlSave)
+	ret := m.ctrl.Call(m, "SaveUrl", ctx, link)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SaveUrl indicates an expected call of SaveUrl.
-func (mr *MockStorageMockRecorder) SaveUrl(ctx, alias, UrlSave interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) SaveUrl(ctx, link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUrl", reflect.TypeOf((*MockStorage)(nil).SaveUrl), ctx, link)
+}
+
+// TouchUrls mocks base method.
+func (m *MockStorage) TouchUrls(ctx context.Context, accessed map[storage.Key]storage.Access) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchUrls", ctx, accessed)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchUrls indicates an expected call of TouchUrls.
+func (mr *MockStorageMockRecorder) TouchUrls(ctx, accessed interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchUrls", reflect.TypeOf((*MockStorage)(nil).TouchUrls), ctx, accessed)
+}
+
+// UseUrl mocks base method.
+func (m *MockStorage) UseUrl(ctx context.Context, domain, alias string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseUrl", ctx, domain, alias)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseUrl indicates an expected call of UseUrl.
+func (mr *MockStorageMockRecorder) UseUrl(ctx, domain, alias interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUrl", reflect.TypeOf((*MockStorage)(nil).SaveUrl), ctx, alias, UrlSave)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseUrl", reflect.TypeOf((*MockStorage)(nil).UseUrl), ctx, domain, alias)
 }
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadChanges читает outbox в порядке (tx, id) и только строки транзакций, завершенных
+// до самой старой из выполняющихся. Номера id выдаются до коммита, поэтому строка
+// с меньшим id может стать видимой позже большей; порядок по транзакциям этого не допускает.
+// Позиция - "<tx>-<id>" последней прочитанной строки.
+func (p *Postgres) ReadChanges(ctx context.Context, offset string, limit int) ([]storage.Change, error) {
+	const op = "storage.Postgres.ReadChanges"
+
+	tx, id, err := parseOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT tx::text, id, op, domain, alias, status, url, reason, created_at FROM outbox
+		WHERE tx < pg_snapshot_xmin(pg_current_snapshot()) AND (tx, id) > ($1::text::xid8, $2)
+		ORDER BY tx, id LIMIT $3`
+
+	rows, err := p.pool.Query(ctx, query, tx, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: offset='%s'. %w", op, offset, err)
+	}
+	defer rows.Close()
+
+	var changes []storage.Change
+	for rows.Next() {
+		var change storage.Change
+		var rowTx string
+		var rowID int64
+		err = rows.Scan(&rowTx, &rowID, &change.Op, &change.Domain, &change.Alias, &change.Status, &change.Url, &change.Reason, &change.At)
+		if err != nil {
+			return nil, fmt.Errorf("%s: offset='%s'. %w", op, offset, err)
+		}
+		change.Offset = rowTx + "-" + strconv.FormatInt(rowID, 10)
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: offset='%s'. %w", op, offset, err)
+	}
+
+	return changes, nil
+}
+
+// parseOffset разбирает позицию "<tx>-<id>". Пустая позиция - начало журнала.
+func parseOffset(offset string) (string, int64, error) {
+	if offset == "" {
+		return "0", 0, nil
+	}
+
+	txPart, idPart, ok := strings.Cut(offset, "-")
+	if !ok {
+		return "", 0, storage.ErrBadOffset
+	}
+	tx, err := strconv.ParseUint(txPart, 10, 64)
+	if err != nil {
+		return "", 0, storage.ErrBadOffset
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id < 0 {
+		return "", 0, storage.ErrBadOffset
+	}
+	return strconv.FormatUint(tx, 10), id, nil
+}
+
+// PurgeChanges удаляет записи outbox старше before.
+func (p *Postgres) PurgeChanges(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.Postgres.PurgeChanges"
+
+	result, err := p.pool.Exec(ctx, `DELETE FROM outbox WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result.RowsAffected(), nil
+}
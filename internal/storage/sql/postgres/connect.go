@@ -2,14 +2,15 @@ package postgres
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GetDBConfig возвращает карту с переменными окружения для подключения к базе данных.
@@ -33,72 +34,182 @@ func GetEnv(key, defaultValue string) string {
 	return value
 }
 
-func ConnectDB(ctx context.Context) (*pgxpool.Pool, error) {
-	const op = "postgres.ConnectDB"
+// DSN собирает адрес базы из переменных окружения DB_*.
+func DSN() (string, error) {
+	const op = "postgres.DSN"
 
 	// Получаем конфигурацию базы данных
 	config := GetDBConfig()
 
 	// Проверяем обязательные переменные
 	if config["user"] == "" {
-		return nil, fmt.Errorf("%s: пустой DB_USER", op)
+		return "", fmt.Errorf("%s: пустой DB_USER", op)
 	}
 	if config["password"] == "" {
-		return nil, fmt.Errorf("%s: пустой DB_PASSWORD", op)
+		return "", fmt.Errorf("%s: пустой DB_PASSWORD", op)
 	}
 	if config["name"] == "" {
-		return nil, fmt.Errorf("%s: пустой DB_NAME", op)
+		return "", fmt.Errorf("%s: пустой DB_NAME", op)
 	}
 
 	// Формируем строку подключения
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		config["user"], config["password"], config["host"], config["port"], config["name"], config["ssl"])
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		config["user"], config["password"], config["host"], config["port"], config["name"], config["ssl"]), nil
+}
 
-	conn, err := pgxpool.New(context.Background(), connStr)
-	if err != nil {
-		return nil, fmt.Errorf("%s: New. %w", op, err)
+// Config настройки пула соединений, TLS и реплик. Адрес основной базы берется из DB_*.
+type Config struct {
+	MaxConns        int32 // 0 - по умолчанию pgxpool
+	MinConns        int32
+	MaxConnLifetime time.Duration // 0 - по умолчанию pgxpool
+	MaxConnIdleTime time.Duration // 0 - по умолчанию pgxpool
+	// statement_timeout сессии; 0 - без ограничения. Миграции выполняются без него.
+	StatementTimeout time.Duration
+
+	SSLMode     string // sslmode, пусто - из DB_SSL или адреса реплики
+	SSLRootCert string // CA сервера
+	SSLCert     string // сертификат клиента
+	SSLKey      string
+
+	// адреса реплик только для чтения; пусто - все запросы к основной базе
+	Replicas []string
+}
+
+// WithTLS добавляет к dsn режим и файлы TLS из конфига, заменяя заданные в dsn.
+// Понимает адреса вида postgres://... и host=... .
+func (c Config) WithTLS(dsn string) (string, error) {
+	params := [][2]string{
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
 	}
 
-	// Проверяем соединение
-	err = conn.Ping(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("%s: Ping. %w", op, err)
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		for _, param := range params {
+			if param[1] != "" {
+				dsn += fmt.Sprintf(" %s='%s'", param[0], quote.Replace(param[1]))
+			}
+		}
+		return dsn, nil
 	}
 
-	log.Printf("%s: запуск миграций", op)
-	err = runMigrations(connStr)
+	u, err := url.Parse(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %v", op, err)
+		return "", err
+	}
+	query := u.Query()
+	for _, param := range params {
+		if param[1] != "" {
+			query.Set(param[0], param[1])
+		}
 	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
 
-	log.Printf("%s: база данных готова к работе", op)
+// PoolConfig разбирает dsn и применяет к нему настройки пула.
+func (c Config) PoolConfig(dsn string) (*pgxpool.Config, error) {
+	dsn, err := c.WithTLS(dsn)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	return conn, nil
+	if c.MaxConns > 0 {
+		poolConfig.MaxConns = c.MaxConns
+	}
+	if c.MinConns > 0 {
+		poolConfig.MinConns = c.MinConns
+	}
+	if c.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+	return poolConfig, nil
 }
 
-func runMigrations(connStr string) error {
-	const op = "postgres.runMigrations"
+// Connect подключается к основной базе из DB_* и к репликам cfg. Если DB_AUTO_MIGRATE
+// не false, перед работой применяет миграции, см. Migrate.
+// Недоступная при запуске реплика не мешает запуску: чтения с нее уходят на основную базу.
+func Connect(ctx context.Context, cfg Config) (*Postgres, error) {
+	const op = "postgres.Connect"
 
-	m, err := migrate.New("file://migrations", connStr)
+	connStr, err := DSN()
 	if err != nil {
-		return fmt.Errorf("%s: New. %v", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer func() {
-		if m != nil {
-			errSource, errDB := m.Close()
-			if errSource != nil {
-				log.Printf("%s: m.Close. %v", op, errSource)
-			}
-			if errDB != nil {
-				log.Printf("%s: m.Close. %v", op, errDB)
-			}
-			return
+	autoMigrate, err := strconv.ParseBool(GetEnv("DB_AUTO_MIGRATE", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: DB_AUTO_MIGRATE. %w", op, err)
+	}
+
+	conn, err := newPool(ctx, connStr, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Проверяем соединение
+	err = conn.Ping(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: Ping. %w", op, err)
+	}
+
+	if autoMigrate {
+		log.Printf("%s: запуск миграций", op)
+		migrateStr, err := cfg.WithTLS(connStr)
+		if err == nil {
+			err = Migrate(ctx, migrateStr, func(m *migrate.Migrate) error {
+				return MigrateCommand{Name: "up"}.Run(m, log.Writer())
+			})
 		}
-	}()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
 
-	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("%s: не удалось применить миграции. Ошибка: %v", op, err)
+	replicas := make([]IPGX, 0, len(cfg.Replicas))
+	for i, replicaStr := range cfg.Replicas {
+		replica, err := newPool(ctx, replicaStr, cfg)
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+			conn.Close()
+			// адрес реплики может содержать пароль, поэтому только номер
+			return nil, fmt.Errorf("%s: реплика %d. %w", op, i, err)
+		}
+		if err = replica.Ping(ctx); err != nil {
+			log.Printf("%s: реплика %d недоступна: %v", op, i, err)
+		}
+		replicas = append(replicas, replica)
 	}
 
-	return nil
+	log.Printf("%s: база данных готова к работе, реплик: %d", op, len(replicas))
+
+	return New(conn, replicas...), nil
+}
+
+// newPool создает пул для dsn; соединения открываются по мере надобности.
+func newPool(ctx context.Context, dsn string, cfg Config) (*pgxpool.Pool, error) {
+	poolConfig, err := cfg.PoolConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ParseConfig. %w", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("New. %w", err)
+	}
+	return pool, nil
 }
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"log"
+	"strconv"
+)
+
+var ErrBadMigrateCommand = errors.New("ошибка: команды migrate: up, down N, version, force V")
+
+// migrationsLock имя advisory-блокировки миграций, общей для всех реплик.
+const migrationsLock = "url-shortener:migrations"
+
+// MigrateCommand команда migrate.
+type MigrateCommand struct {
+	Name string // up, down, version, force
+	N    int    // число откатываемых миграций для down, версия для force
+}
+
+// ParseMigrateCommand разбирает аргументы migrate: up, down N, version, force V.
+// down требует явного N, чтобы случайно не откатить всю схему.
+func ParseMigrateCommand(args []string) (MigrateCommand, error) {
+	if len(args) == 0 {
+		return MigrateCommand{}, ErrBadMigrateCommand
+	}
+
+	cmd := MigrateCommand{Name: args[0]}
+	switch cmd.Name {
+	case "up", "version":
+		if len(args) != 1 {
+			return MigrateCommand{}, ErrBadMigrateCommand
+		}
+	case "down", "force":
+		if len(args) != 2 {
+			return MigrateCommand{}, ErrBadMigrateCommand
+		}
+		n, err := strconv.Atoi(args[1])
+		// force -1 снимает версию совсем, как в golang-migrate
+		if err != nil || (cmd.Name == "down" && n < 1) || (cmd.Name == "force" && n < -1) {
+			return MigrateCommand{}, ErrBadMigrateCommand
+		}
+		cmd.N = n
+	default:
+		return MigrateCommand{}, ErrBadMigrateCommand
+	}
+	return cmd, nil
+}
+
+// Run выполняет команду и пишет в out версию схемы после нее.
+func (c MigrateCommand) Run(m *migrate.Migrate, out io.Writer) error {
+	var err error
+	switch c.Name {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Steps(-c.N)
+	case "force":
+		err = m.Force(c.N)
+	case "version":
+	default:
+		return ErrBadMigrateCommand
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		_, _ = fmt.Fprintln(out, "схема без миграций")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "версия схемы: %d, dirty: %t\n", version, dirty)
+	return nil
+}
+
+// Migrate выполняет fn над встроенными миграциями, удерживая advisory-блокировку,
+// чтобы реплики, запущенные одновременно, применяли миграции по очереди.
+// Блокировка снимается вместе с соединением, даже если процесс упадет.
+func Migrate(ctx context.Context, dsn string, fn func(m *migrate.Migrate) error) error {
+	const op = "postgres.Migrate"
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("%s: Connect. %w", op, err)
+	}
+	defer func() {
+		_ = conn.Close(context.WithoutCancel(ctx))
+	}()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey(migrationsLock)); err != nil {
+		return fmt.Errorf("%s: блокировка. %w", op, err)
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return fmt.Errorf("%s: iofs.New. %w", op, err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, dsn)
+	if err != nil {
+		return fmt.Errorf("%s: New. %w", op, err)
+	}
+	defer func() {
+		errSource, errDB := m.Close()
+		if errSource != nil {
+			log.Printf("%s: m.Close. %v", op, errSource)
+		}
+		if errDB != nil {
+			log.Printf("%s: m.Close. %v", op, errDB)
+		}
+	}()
+
+	if err = fn(m); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
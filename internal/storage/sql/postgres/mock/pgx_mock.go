@@ -68,6 +68,26 @@ func (mr *MockIPGXMockRecorder) Exec(ctx, sql interface{}, arguments ...interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exec", reflect.TypeOf((*MockIPGX)(nil).Exec), varargs...)
 }
 
+// Query mocks base method.
+func (m *MockIPGX) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, sql}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Query", varargs...)
+	ret0, _ := ret[0].(pgx.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockIPGXMockRecorder) Query(ctx, sql interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, sql}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockIPGX)(nil).Query), varargs...)
+}
+
 // QueryRow mocks base method.
 func (m *MockIPGX) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
 	m.ctrl.T.Helper()
@@ -104,3 +124,133 @@ func (mr *MockIPGXMockRecorder) Scan(dest ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockIPGX)(nil).Scan), dest...)
 }
+
+// Begin mocks base method.
+func (m *MockIPGX) Begin(ctx context.Context) (pgx.Tx, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Begin", ctx)
+	ret0, _ := ret[0].(pgx.Tx)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Begin indicates an expected call of Begin.
+func (mr *MockIPGXMockRecorder) Begin(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockIPGX)(nil).Begin), ctx)
+}
+
+// BeginTx mocks base method.
+func (m *MockIPGX) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginTx", ctx, txOptions)
+	ret0, _ := ret[0].(pgx.Tx)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginTx indicates an expected call of BeginTx.
+func (mr *MockIPGXMockRecorder) BeginTx(ctx, txOptions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTx", reflect.TypeOf((*MockIPGX)(nil).BeginTx), ctx, txOptions)
+}
+
+// Commit mocks base method.
+func (m *MockIPGX) Commit(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockIPGXMockRecorder) Commit(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockIPGX)(nil).Commit), ctx)
+}
+
+// Rollback mocks base method.
+func (m *MockIPGX) Rollback(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockIPGXMockRecorder) Rollback(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockIPGX)(nil).Rollback), ctx)
+}
+
+// CopyFrom mocks base method.
+func (m *MockIPGX) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyFrom", ctx, tableName, columnNames, rowSrc)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CopyFrom indicates an expected call of CopyFrom.
+func (mr *MockIPGXMockRecorder) CopyFrom(ctx, tableName, columnNames, rowSrc interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyFrom", reflect.TypeOf((*MockIPGX)(nil).CopyFrom), ctx, tableName, columnNames, rowSrc)
+}
+
+// SendBatch mocks base method.
+func (m *MockIPGX) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendBatch", ctx, b)
+	ret0, _ := ret[0].(pgx.BatchResults)
+	return ret0
+}
+
+// SendBatch indicates an expected call of SendBatch.
+func (mr *MockIPGXMockRecorder) SendBatch(ctx, b interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendBatch", reflect.TypeOf((*MockIPGX)(nil).SendBatch), ctx, b)
+}
+
+// LargeObjects mocks base method.
+func (m *MockIPGX) LargeObjects() pgx.LargeObjects {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LargeObjects")
+	ret0, _ := ret[0].(pgx.LargeObjects)
+	return ret0
+}
+
+// LargeObjects indicates an expected call of LargeObjects.
+func (mr *MockIPGXMockRecorder) LargeObjects() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LargeObjects", reflect.TypeOf((*MockIPGX)(nil).LargeObjects))
+}
+
+// Prepare mocks base method.
+func (m *MockIPGX) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prepare", ctx, name, sql)
+	ret0, _ := ret[0].(*pgconn.StatementDescription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prepare indicates an expected call of Prepare.
+func (mr *MockIPGXMockRecorder) Prepare(ctx, name, sql interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prepare", reflect.TypeOf((*MockIPGX)(nil).Prepare), ctx, name, sql)
+}
+
+// Conn mocks base method.
+func (m *MockIPGX) Conn() *pgx.Conn {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Conn")
+	ret0, _ := ret[0].(*pgx.Conn)
+	return ret0
+}
+
+// Conn indicates an expected call of Conn.
+func (mr *MockIPGXMockRecorder) Conn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Conn", reflect.TypeOf((*MockIPGX)(nil).Conn))
+}
@@ -7,96 +7,532 @@ import (
 	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
+// IPGX пул соединений; *pgxpool.Pool реализует его как есть.
 type IPGX interface {
-	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
-	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 	Close()
 }
 type Postgres struct {
-	pool IPGX
+	pool     IPGX
+	replicas []IPGX        // только для чтения, см. readLink
+	next     atomic.Uint64 // реплика для следующего чтения
 }
 
-func New(pool IPGX) *Postgres {
-	return &Postgres{pool: pool}
+// New создает хранилище над основной базой pool. Реплики, если есть,
+// обслуживают GetUrl, все записи идут в pool.
+func New(pool IPGX, replicas ...IPGX) *Postgres {
+	return &Postgres{pool: pool, replicas: replicas}
 }
 
 // SaveUrl сохраняет Url в базе данных.
-func (p *Postgres) SaveUrl(ctx context.Context, alias, urlsave string) error {
+func (p *Postgres) SaveUrl(ctx context.Context, link storage.Link) error {
 	const op = "storage.Postgres.SaveUrl"
 
-	if alias == "" {
+	if link.Alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
-	if urlsave == "" {
+	if link.Url == "" {
 		return storage.ErrUrlIsEmpty
 	}
 
-	query := `INSERT INTO urls (alias, Url) VALUES ($1, $2)`
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	rules := link.Rules
+	if rules == nil {
+		rules = []storage.Rule{}
+	}
+	destinations := link.Destinations
+	if destinations == nil {
+		destinations = []storage.Destination{}
+	}
+
+	query := `INSERT INTO urls (domain, alias, Url, title, description, tags, notes, expires_at, rules, destinations,
+			password_hash, max_uses, uses_left, preview, page, forward_query, forward_path,
+			template)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`
 
-	_, err := p.pool.Exec(ctx, query, alias, urlsave)
+	err := p.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, link.Domain, link.Alias, link.Url, link.Title, link.Description, tags, link.Notes,
+			nullTime(link.ExpiresAt), rules, destinations, link.PasswordHash, link.MaxUses, link.UsesLeft,
+			link.Preview, link.Page, link.ForwardQuery, link.ForwardPath, link.Template)
+		if err != nil {
+			return err
+		}
+		return logChange(ctx, tx, storage.ChangeInsert, link.Domain, link.Alias, storage.StatusActive, link.Url)
+	})
 	if err != nil {
-		// Проверка на ошибку уникальности
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23505" { // Код ошибки для нарушения уникальности
-				return storage.ErrExistAlias
-			}
+		if constraintErr := constraintError(err); constraintErr != nil {
+			return constraintErr
 		}
-		return fmt.Errorf("%s: url='%s', alias='%s'. %w", op, urlsave, alias, err)
+		return fmt.Errorf("%s: url='%s', domain='%s', alias='%s'. %w", op, link.Url, link.Domain, link.Alias, err)
 	}
 
 	return nil
 }
 
+// linkColumns колонки, читаемые scanLink.
+const linkColumns = `alias, Url, title, description, tags, notes, status, created_at, updated_at, last_accessed_at,
+	expires_at, domain, rules, destinations, destination_clicks, password_hash, max_uses, uses_left, preview, page,
+	forward_query, forward_path, template`
+
+// scanLink читает строку, выбранную по linkColumns.
+func scanLink(row pgx.Row) (storage.Link, error) {
+	var link storage.Link
+	var lastAccessedAt, expiresAt *time.Time
+	var clicks map[string]int64
+	err := row.Scan(&link.Alias, &link.Url, &link.Title, &link.Description, &link.Tags, &link.Notes, &link.Status,
+		&link.CreatedAt, &link.UpdatedAt, &lastAccessedAt, &expiresAt, &link.Domain, &link.Rules, &link.Destinations,
+		&clicks, &link.PasswordHash, &link.MaxUses, &link.UsesLeft, &link.Preview, &link.Page,
+		&link.ForwardQuery, &link.ForwardPath, &link.Template)
+	if lastAccessedAt != nil {
+		link.LastAccessedAt = *lastAccessedAt
+	}
+	if expiresAt != nil {
+		link.ExpiresAt = *expiresAt
+	}
+	for variant, n := range clicks {
+		if i, err := strconv.Atoi(variant); err == nil && i >= 0 && i < len(link.Destinations) {
+			link.Destinations[i].Clicks = n
+		}
+	}
+	return link, err
+}
+
+// nullTime возвращает nil для нулевого времени, чтобы в колонку попал NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 // GetUrl возвращает Url по его alias.
-func (p *Postgres) GetUrl(ctx context.Context, alias string) (string, error) {
+func (p *Postgres) GetUrl(ctx context.Context, domain, alias string) (storage.Link, error) {
 	const op = "storage.Postgres.GetUrl"
 
 	if alias == "" {
-		return "", storage.ErrAliasIsEmpty
+		return storage.Link{}, storage.ErrAliasIsEmpty
+	}
+
+	query := `SELECT ` + linkColumns + ` FROM urls WHERE domain = $1 AND alias = $2`
+
+	link, err := p.readLink(ctx, query, domain, alias)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.Link{}, storage.ErrNotFound
+		}
+		return storage.Link{}, fmt.Errorf("%s: domain='%s', alias='%s'. %w", op, domain, alias, err)
+	}
+
+	if link.Expired(time.Now()) {
+		return storage.Link{}, storage.ErrNotFound
+	}
+
+	switch link.Status {
+	case storage.StatusDeleted:
+		return storage.Link{}, storage.ErrNotFound
+	case storage.StatusDisabled:
+		return storage.Link{}, storage.ErrDisabled
+	}
+
+	return link, nil
+}
+
+// readLink читает ссылку с очередной реплики по кругу, а если реплик нет, реплика
+// недоступна или ссылки на ней нет - с основной базы: отстающая реплика может
+// еще не знать о только что созданной ссылке.
+func (p *Postgres) readLink(ctx context.Context, query string, args ...any) (storage.Link, error) {
+	if len(p.replicas) > 0 {
+		replica := p.replicas[p.next.Add(1)%uint64(len(p.replicas))]
+		link, err := scanLink(replica.QueryRow(ctx, query, args...))
+		if err == nil || ctx.Err() != nil {
+			return link, err
+		}
+	}
+	return scanLink(p.pool.QueryRow(ctx, query, args...))
+}
+
+// GetUrlInfo возвращает Url в любом статусе.
+func (p *Postgres) GetUrlInfo(ctx context.Context, domain, alias string) (storage.Link, error) {
+	const op = "storage.Postgres.GetUrlInfo"
+
+	if alias == "" {
+		return storage.Link{}, storage.ErrAliasIsEmpty
 	}
 
-	var Url string
-	query := `SELECT Url FROM urls WHERE alias = $1`
+	query := `SELECT ` + linkColumns + ` FROM urls WHERE domain = $1 AND alias = $2`
 
-	err := p.pool.QueryRow(ctx, query, alias).Scan(&Url)
+	link, err := scanLink(p.pool.QueryRow(ctx, query, domain, alias))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", storage.ErrNotFound
+			return storage.Link{}, storage.ErrNotFound
 		}
-		return "", fmt.Errorf("%s: alias='%s'. %w", op, alias, err)
+		return storage.Link{}, fmt.Errorf("%s: domain='%s', alias='%s'. %w", op, domain, alias, err)
+	}
+
+	return link, nil
+}
+
+// TouchUrls обновляет время последнего обращения и прибавляет переходы по вариантам одним запросом.
+func (p *Postgres) TouchUrls(ctx context.Context, accessed map[storage.Key]storage.Access) error {
+	const op = "storage.Postgres.TouchUrls"
+
+	if len(accessed) == 0 {
+		return nil
+	}
+
+	domains := make([]string, 0, len(accessed))
+	aliases := make([]string, 0, len(accessed))
+	times := make([]time.Time, 0, len(accessed))
+	clicks := make([]map[string]int64, 0, len(accessed))
+	for key, access := range accessed {
+		domains = append(domains, key.Domain)
+		aliases = append(aliases, key.Alias)
+		times = append(times, access.At)
+
+		variants := make(map[string]int64, len(access.Clicks))
+		for variant, n := range access.Clicks {
+			variants[strconv.Itoa(variant)] = n
+		}
+		clicks = append(clicks, variants)
+	}
+
+	// GREATEST пропускает NULL, поэтому первое обращение тоже записывается
+	query := `UPDATE urls SET last_accessed_at = GREATEST(urls.last_accessed_at, v.accessed_at),
+		destination_clicks = CASE WHEN v.clicks = '{}' THEN urls.destination_clicks ELSE (
+			SELECT jsonb_object_agg(k, COALESCE((urls.destination_clicks->>k)::bigint, 0) + COALESCE((v.clicks->>k)::bigint, 0))
+			FROM jsonb_object_keys(urls.destination_clicks || v.clicks) AS k
+		) END
+		FROM unnest($1::text[], $2::text[], $3::timestamptz[], $4::jsonb[]) AS v(domain, alias, accessed_at, clicks)
+		WHERE urls.domain = v.domain AND urls.alias = v.alias`
+
+	_, err := p.pool.Exec(ctx, query, domains, aliases, times, clicks)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseUrl списывает использование одним UPDATE ... RETURNING: параллельные переходы
+// по одной ссылке не могут потратить больше использований, чем осталось.
+// В outbox попадает только последнее использование, после которого ссылка исчерпана.
+func (p *Postgres) UseUrl(ctx context.Context, domain, alias string) (int64, error) {
+	const op = "storage.Postgres.UseUrl"
+
+	if alias == "" {
+		return 0, storage.ErrAliasIsEmpty
+	}
+
+	// link видит строку до списания, поэтому отличает исчерпанную ссылку от отсутствующей
+	query := `WITH link AS (
+			SELECT max_uses FROM urls WHERE domain = $1 AND alias = $2 AND status <> 'deleted'
+		), used AS (
+			UPDATE urls SET uses_left = uses_left - 1
+			WHERE domain = $1 AND alias = $2 AND status <> 'deleted' AND max_uses > 0 AND uses_left > 0
+			RETURNING uses_left, status
+		), logged AS (
+			INSERT INTO outbox (op, domain, alias, status, reason)
+			SELECT 'update', $1, $2, status, 'exhausted' FROM used WHERE uses_left = 0
+		)
+		SELECT (SELECT max_uses FROM link), (SELECT uses_left FROM used)`
+
+	var maxUses, left *int64
+	if err := p.pool.QueryRow(ctx, query, domain, alias).Scan(&maxUses, &left); err != nil {
+		return 0, fmt.Errorf("%s: domain='%s', alias='%s'. %w", op, domain, alias, err)
+	}
+
+	switch {
+	case maxUses == nil:
+		return 0, storage.ErrNotFound
+	case *maxUses <= 0:
+		return -1, nil
+	case left == nil:
+		return 0, storage.ErrExhausted
+	}
+	return *left, nil
+}
+
+// ListUrls возвращает не удаленные Url, опционально отфильтрованные по тегу.
+func (p *Postgres) ListUrls(ctx context.Context, filter storage.ListFilter) ([]storage.Link, error) {
+	const op = "storage.Postgres.ListUrls"
+
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
+	}
+
+	query := `SELECT ` + linkColumns + ` FROM urls
+		WHERE status <> 'deleted' AND ($1 = '' OR $1 = ANY(tags))
+		ORDER BY id LIMIT $2 OFFSET $3`
+
+	rows, err := p.pool.Query(ctx, query, filter.Tag, limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: tag='%s'. %w", op, filter.Tag, err)
+	}
+	defer rows.Close()
+
+	var links []storage.Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tag='%s'. %w", op, filter.Tag, err)
+		}
+		links = append(links, link)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: tag='%s'. %w", op, filter.Tag, err)
 	}
 
-	return Url, nil
+	return links, nil
 }
 
-// DeleteUrl удаляет Url по его alias.
-func (p *Postgres) DeleteUrl(ctx context.Context, alias string) error {
+// DeleteUrl мягко удаляет Url по его alias.
+func (p *Postgres) DeleteUrl(ctx context.Context, domain, alias string) error {
 	const op = "storage.Postgres.DeleteUrl"
 
 	if alias == "" {
 		return storage.ErrAliasIsEmpty
 	}
 
-	query := `DELETE FROM urls WHERE alias = $1`
+	return p.switchStatus(ctx, op, domain, alias, `status <> 'deleted'`, storage.StatusDeleted, `deleted_at = now()`)
+}
+
+// DisableUrl отключает Url по его alias.
+func (p *Postgres) DisableUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.Postgres.DisableUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	return p.switchStatus(ctx, op, domain, alias, `status <> 'deleted'`, storage.StatusDisabled, "")
+}
 
-	result, err := p.pool.Exec(ctx, query, alias)
+// EnableUrl включает отключенный Url по его alias.
+func (p *Postgres) EnableUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.Postgres.EnableUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	return p.switchStatus(ctx, op, domain, alias, `status <> 'deleted'`, storage.StatusActive, "")
+}
+
+// RestoreUrl восстанавливает мягко удаленный Url.
+func (p *Postgres) RestoreUrl(ctx context.Context, domain, alias string) error {
+	const op = "storage.Postgres.RestoreUrl"
+
+	if alias == "" {
+		return storage.ErrAliasIsEmpty
+	}
+
+	return p.switchStatus(ctx, op, domain, alias, `status = 'deleted'`, storage.StatusActive, `deleted_at = NULL`)
+}
+
+// PurgeDeleted окончательно удаляет Url, мягко удаленные раньше before.
+func (p *Postgres) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.Postgres.PurgeDeleted"
+
+	query := `WITH purged AS (
+			SELECT id, domain, alias FROM urls WHERE status = 'deleted' AND deleted_at < $1 FOR UPDATE
+		), logged AS (
+			INSERT INTO outbox (op, domain, alias, reason) SELECT 'delete', domain, alias, 'purged' FROM purged
+		)
+		DELETE FROM urls USING purged WHERE urls.id = purged.id`
+
+	result, err := p.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// PurgeStale окончательно удаляет пачку истекших или давно не использованных Url.
+// Строки, заблокированные другой транзакцией, пропускаются до следующего прохода.
+func (p *Postgres) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	const op = "storage.Postgres.PurgeStale"
+
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
+	}
+
+	// удаленные ссылки дожидаются конца срока хранения в PurgeDeleted
+	where := `status <> 'deleted' AND (
+		($1::timestamptz IS NOT NULL AND expires_at < $1)
+		OR ($2::timestamptz IS NOT NULL AND COALESCE(last_accessed_at, created_at) < $2))`
+
+	query := `WITH stale AS (
+			SELECT id, domain, alias,
+				CASE WHEN $1::timestamptz IS NOT NULL AND expires_at < $1 THEN 'expired' ELSE 'stale' END AS reason
+			FROM urls WHERE ` + where + `
+			ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+		), logged AS (
+			INSERT INTO outbox (op, domain, alias, reason) SELECT 'delete', domain, alias, reason FROM stale
+		)
+		DELETE FROM urls USING stale WHERE urls.id = stale.id
+		RETURNING urls.domain, urls.alias`
+	args := []any{nullTime(filter.ExpiredBefore), nullTime(filter.NotAccessedSince), limit}
+	if filter.DryRun {
+		query = `SELECT domain, alias FROM urls WHERE ` + where + ` ORDER BY id LIMIT $3 OFFSET $4`
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := p.pool.Query(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("%s: alias='%s'. %w", op, alias, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 
-	// Проверяем количество затронутых строк
-	if result.RowsAffected() == 0 {
-		return storage.ErrNotFound
+	var keys []storage.Key
+	for rows.Next() {
+		var key storage.Key
+		if err = rows.Scan(&key.Domain, &key.Alias); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	return keys, nil
+}
+
+// acquirer пул, выдающий отдельное соединение. Сессионная advisory-блокировка
+// живет на соединении, поэтому берется и снимается на одном и том же.
+type acquirer interface {
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+}
+
+// TryLock берет advisory-блокировку pg_try_advisory_lock, общую для всех реплик.
+// Блокировка снимается сама, если соединение с базой оборвется.
+func (p *Postgres) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	const op = "storage.Postgres.TryLock"
+
+	pool, ok := p.pool.(acquirer)
+	if !ok {
+		return nil, false, fmt.Errorf("%s: name='%s'. пул не поддерживает выделенные соединения", op, name)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: name='%s'. %w", op, name, err)
+	}
+
+	key := lockKey(name)
+	var locked bool
+	if err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil || !locked {
+		conn.Release()
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: name='%s'. %w", op, name, err)
+		}
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		// снимаем и после отмены ctx вызывающего
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := conn.Exec(unlockCtx, `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			// соединение с неизвестным состоянием блокировки не возвращаем в пул
+			_ = conn.Conn().Close(unlockCtx)
+		}
+		conn.Release()
+	}
+	return unlock, true, nil
+}
+
+// lockKey переводит имя блокировки в ключ pg_advisory_lock.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// switchStatus в транзакции переводит ссылку, статус которой проходит условие where,
+// в статус to и пишет изменение в outbox. set - дополнительные присваивания UPDATE.
+// Возвращает ErrNotFound, если подходящей ссылки нет, и ErrUnchanged, если она уже в статусе to.
+func (p *Postgres) switchStatus(ctx context.Context, op, domain, alias, where string, to storage.Status, set string) error {
+	if set != "" {
+		set = ", " + set
+	}
+
+	err := p.WithTx(ctx, func(tx pgx.Tx) error {
+		var current storage.Status
+		err := tx.QueryRow(ctx, `SELECT status FROM urls WHERE domain = $1 AND alias = $2 AND `+where+` FOR UPDATE`,
+			domain, alias).Scan(&current)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return storage.ErrNotFound
+			}
+			return err
+		}
+		if current == to {
+			return storage.ErrUnchanged
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE urls SET status = $3, updated_at = now()`+set+`
+			WHERE domain = $1 AND alias = $2`, domain, alias, to)
+		if err != nil {
+			return err
+		}
+		return logChange(ctx, tx, storage.ChangeUpdate, domain, alias, to, "")
+	})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrUnchanged) {
+		return fmt.Errorf("%s: domain='%s', alias='%s'. %w", op, domain, alias, err)
+	}
+	return err
+}
+
+// constraintError переводит нарушение ограничения таблицы urls в ошибку storage,
+// nil - err не из них.
+func constraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch pgErr.Code {
+	case "23505": // unique_violation, единственное уникальное ограничение (domain, alias)
+		return storage.ErrExistAlias
+	case "23514": // check_violation
+		switch pgErr.ConstraintName {
+		case "urls_url_check":
+			return storage.ErrUrlTooLong
+		case "urls_alias_check":
+			return storage.ErrAliasIsEmpty
+		}
+	}
 	return nil
 }
 
+// logChange пишет изменение ссылки в outbox; вызывается в транзакции самого изменения.
+func logChange(ctx context.Context, q Querier, op storage.ChangeOp, domain, alias string, status storage.Status, url string) error {
+	_, err := q.Exec(ctx, `INSERT INTO outbox (op, domain, alias, status, url) VALUES ($1, $2, $3, $4, $5)`,
+		string(op), domain, alias, string(status), url)
+	return err
+}
+
 // Disconnect закрывает соединение с базой данных.
 func (p *Postgres) Disconnect(ctx context.Context) error {
+	for _, replica := range p.replicas {
+		replica.Close()
+	}
 	p.pool.Close()
 	return nil
 }
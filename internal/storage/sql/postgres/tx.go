@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"math/rand/v2"
+	"time"
+)
+
+// Querier запросы, общие для пула и транзакции.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Повтор транзакций, прерванных базой
+const (
+	maxTxAttempts = 3
+	txRetryDelay  = 20 * time.Millisecond // до разброса, удваивается с каждой попыткой
+)
+
+// WithTx выполняет fn в транзакции READ COMMITTED, см. WithTxOptions.
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return p.WithTxOptions(ctx, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions выполняет fn в транзакции с opts. Ошибка fn откатывает транзакцию
+// и возвращается как есть, иначе транзакция фиксируется. Транзакция, прерванная
+// из-за конфликта сериализации или взаимной блокировки, повторяется целиком,
+// поэтому fn не должна иметь побочных эффектов вне базы.
+func (p *Postgres) WithTxOptions(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := p.runTx(ctx, opts, fn)
+		if err == nil || !retryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay/2 + rand.N(delay/2+1)):
+		}
+		delay *= 2
+	}
+}
+
+// runTx выполняет одну попытку транзакции.
+func (p *Postgres) runTx(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := p.pool.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("начало транзакции. %w", err)
+	}
+
+	// откат и после отмены ctx, иначе соединение вернется в пул посреди транзакции
+	rollback := func() {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		rollback()
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("фиксация транзакции. %w", err)
+	}
+	return nil
+}
+
+// retryable сообщает, что транзакцию прервала база и ее можно повторить:
+// 40001 serialization_failure, 40P01 deadlock_detected.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+func (p *Postgres) SaveWebhook(ctx context.Context, webhook storage.Webhook) error {
+	const op = "storage.Postgres.SaveWebhook"
+
+	query := `INSERT INTO webhooks (id, url, secret, events, domains) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := p.pool.Exec(ctx, query, webhook.ID, webhook.Url, webhook.Secret, nonNil(webhook.Events), nonNil(webhook.Domains))
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, webhook.ID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) ListWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	const op = "storage.Postgres.ListWebhooks"
+
+	rows, err := p.pool.Query(ctx, `SELECT id, url, secret, events, domains, created_at FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var webhooks []storage.Webhook
+	for rows.Next() {
+		var webhook storage.Webhook
+		err = rows.Scan(&webhook.ID, &webhook.Url, &webhook.Secret, &webhook.Events, &webhook.Domains, &webhook.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook удаляет подписку, доставки удаляются каскадно.
+func (p *Postgres) DeleteWebhook(ctx context.Context, id string) error {
+	const op = "storage.Postgres.DeleteWebhook"
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) WebhookOffset(ctx context.Context) (string, error) {
+	const op = "storage.Postgres.WebhookOffset"
+
+	var offset string
+	if err := p.pool.QueryRow(ctx, `SELECT position FROM webhook_offset`).Scan(&offset); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return offset, nil
+}
+
+// EnqueueDeliveries переносит позицию условным UPDATE: реплика, начавшая с той же позиции,
+// дождется блокировки строки, не найдет from и получит ErrOffsetMoved.
+// Доставки кладутся в outbox одним запросом в той же транзакции.
+func (p *Postgres) EnqueueDeliveries(ctx context.Context, deliveries []storage.Delivery, from, to string) error {
+	const op = "storage.Postgres.EnqueueDeliveries"
+
+	ids := make([]string, len(deliveries))
+	webhookIDs := make([]string, len(deliveries))
+	events := make([]string, len(deliveries))
+	payloads := make([][]byte, len(deliveries))
+	nexts := make([]time.Time, len(deliveries))
+	for i, delivery := range deliveries {
+		ids[i] = delivery.ID
+		webhookIDs[i] = delivery.WebhookID
+		events[i] = delivery.Event
+		payloads[i] = delivery.Payload
+		nexts[i] = delivery.NextAttempt
+	}
+
+	err := p.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `INSERT INTO webhook_offset (position) VALUES ($2)
+			ON CONFLICT (id) DO UPDATE SET position = $2 WHERE webhook_offset.position = $1`, from, to)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storage.ErrOffsetMoved
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		query := `INSERT INTO webhook_deliveries (id, webhook_id, event, payload, next_attempt_at)
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::bytea[], $5::timestamptz[])
+			ON CONFLICT (id) DO NOTHING`
+
+		_, err = tx.Exec(ctx, query, ids, webhookIDs, events, payloads, nexts)
+		return err
+	})
+	if err != nil && !errors.Is(err, storage.ErrOffsetMoved) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return err
+}
+
+// ClaimDeliveries откладывает выбранные доставки в той же команде, что и выбирает.
+// SKIP LOCKED не дает репликам ждать друг друга на одних строках.
+func (p *Postgres) ClaimDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]storage.Delivery, error) {
+	const op = "storage.Postgres.ClaimDeliveries"
+
+	query := `UPDATE webhook_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE next_attempt_at <= $1
+			ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING id, webhook_id, event, payload, attempts, last_error, created_at`
+
+	rows, err := p.pool.Query(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []storage.Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		delivery.NextAttempt = now.Add(lease)
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return deliveries, nil
+}
+
+func scanDelivery(row pgx.Row) (storage.Delivery, error) {
+	var delivery storage.Delivery
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Attempts,
+		&delivery.LastError, &delivery.CreatedAt)
+	return delivery, err
+}
+
+func (p *Postgres) CompleteDelivery(ctx context.Context, id string) error {
+	const op = "storage.Postgres.CompleteDelivery"
+
+	if _, err := p.pool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	return nil
+}
+
+func (p *Postgres) RetryDelivery(ctx context.Context, id string, attempts int, next time.Time, lastErr string) error {
+	const op = "storage.Postgres.RetryDelivery"
+
+	query := `UPDATE webhook_deliveries SET attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1`
+
+	tag, err := p.pool.Exec(ctx, query, id, attempts, next, lastErr)
+	if err != nil {
+		return fmt.Errorf("%s: id='%s'. %w", op, id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// nonNil заменяет nil пустым срезом, чтобы в колонку NOT NULL попал пустой массив.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -3,19 +3,210 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var (
 	ErrUrlIsEmpty   = errors.New("ошибка: пустой Url")
+	ErrUrlTooLong   = errors.New("ошибка: слишком длинный Url")
 	ErrAliasIsEmpty = errors.New("ошибка: пустой alias")
 	ErrNotFound     = errors.New("ошибка: Url не найден")
 	ErrExistAlias   = errors.New("ошибка: alias занят")
+	ErrDisabled     = errors.New("ошибка: Url отключен")
+	ErrExhausted    = errors.New("ошибка: использования Url исчерпаны")
+	ErrUnchanged    = errors.New("ошибка: Url уже в этом статусе")
 )
 
+// MaxUrlLength наибольшая длина Url в символах, как в проверке колонки url Postgres.
+const MaxUrlLength = 8192
+
+// Status состояние ссылки.
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDisabled Status = "disabled"
+	StatusDeleted  Status = "deleted" // мягко удалена, alias зарезервирован до очистки
+)
+
+// Key адрес ссылки: alias уникален в пределах домена.
+type Key struct {
+	Domain string // пусто - домен по умолчанию
+	Alias  string
+}
+
+// Rule условие перехода: если совпали все заданные поля, ссылка ведет на Url.
+// Пустые поля не проверяются.
+type Rule struct {
+	UserAgent string            `json:"user_agent,omitempty"` // регулярное выражение по User-Agent без учета регистра
+	Language  string            `json:"language,omitempty"`   // предпочтительный язык клиента, например "ru" или "pt-br"
+	Country   string            `json:"country,omitempty"`    // ISO 3166-1 код страны клиента по IP
+	Query     map[string]string `json:"query,omitempty"`      // обязательные значения query параметров
+	Url       string            `json:"url"`
+}
+
+// Destination вариант перехода при A/B разделении трафика.
+type Destination struct {
+	Url    string `json:"url"`
+	Weight int    `json:"weight"` // доля трафика относительно суммы весов всех вариантов
+	Clicks int64  `json:"-"`      // переходы на вариант, хранилище считает их отдельно
+}
+
+// QueryForward перенос query параметров перехода в адрес назначения.
+type QueryForward string
+
+const (
+	QueryForwardOff      QueryForward = ""         // параметры перехода отбрасываются
+	QueryForwardMerge    QueryForward = "merge"    // добавляются параметры, которых нет в адресе
+	QueryForwardOverride QueryForward = "override" // параметры перехода заменяют одноименные в адресе
+)
+
+// Page сведения о странице назначения для страницы предпросмотра.
+type Page struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"` // адрес картинки og:image
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Access обращения к ссылке, накопленные между сбросами.
+type Access struct {
+	At     time.Time     // время последнего обращения
+	Clicks map[int]int64 // переходы по индексам Destinations
+}
+
+// Link ссылка с метаданными.
+type Link struct {
+	Domain      string // пусто - домен по умолчанию
+	Alias       string
+	Url         string
+	Title       string
+	Description string
+	Tags        []string
+	Notes       string // заметки автора
+	Status      Status
+
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	LastAccessedAt time.Time // нулевое значение - обращений не было
+	ExpiresAt      time.Time // нулевое значение - бессрочная
+
+	// Rules проверяются по порядку, Url - переход, если ни одно правило не совпало
+	Rules []Rule
+	// Destinations делят трафик по весам, если ни одно правило не совпало.
+	// Пусто - переход на Url.
+	Destinations []Destination
+
+	Password     string // пароль в открытом виде, только на входе сервиса и не сохраняется
+	PasswordHash string // bcrypt хеш пароля, пусто - без пароля
+	MaxUses      int64  // 0 - без ограничения
+	UsesLeft     int64  // оставшиеся использования при MaxUses > 0
+
+	Preview bool // показывать страницу предпросмотра перед переходом
+	Page    Page // сведения о странице Url, прочитанные при сохранении
+
+	// ForwardQuery переносит query параметры перехода в адрес назначения
+	ForwardQuery QueryForward
+	// ForwardPath дописывает путь после alias к адресу назначения: /{alias}/a/b -> Url/a/b
+	ForwardPath bool
+
+	// Template адреса ссылки - шаблоны с {имя}, значения берутся из сегментов пути
+	// после alias и query параметров. Шаблон хранится под своим alias, как обычная ссылка.
+	Template bool
+}
+
+// Key возвращает адрес ссылки.
+func (l Link) Key() Key {
+	return Key{Domain: l.Domain, Alias: l.Alias}
+}
+
+// Expired сообщает, истек ли срок действия ссылки к моменту now.
+func (l Link) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// ListFilter параметры выборки ссылок.
+type ListFilter struct {
+	Tag    string // пусто - без фильтра
+	Limit  int
+	Offset int
+}
+
+// PurgeFilter критерии очистки устаревших ссылок. Ссылка подходит,
+// если выполнен хотя бы один из заданных критериев. Удаленные ссылки не подходят:
+// их до конца срока хранения можно восстановить, очищает их PurgeDeleted.
+type PurgeFilter struct {
+	ExpiredBefore    time.Time // истекшие раньше; нулевое - не учитывать
+	NotAccessedSince time.Time // без обращений с этого момента; нулевое - не учитывать
+	Limit            int       // размер пачки
+	DryRun           bool      // только вернуть подходящие alias, не удаляя
+	Offset           int       // пропустить столько подходящих ссылок; только при DryRun
+}
+
+// Match проверяет ссылку по критериям очистки.
+// Ссылка без обращений считается использованной в момент создания.
+func (f PurgeFilter) Match(link Link) bool {
+	if link.Status == StatusDeleted {
+		return false
+	}
+	if !f.ExpiredBefore.IsZero() && !link.ExpiresAt.IsZero() && link.ExpiresAt.Before(f.ExpiredBefore) {
+		return true
+	}
+	if !f.NotAccessedSince.IsZero() {
+		lastUsed := link.LastAccessedAt
+		if lastUsed.IsZero() {
+			lastUsed = link.CreatedAt
+		}
+		return lastUsed.Before(f.NotAccessedSince)
+	}
+	return false
+}
+
+// Reason возвращает причину очистки подходящей ссылки для журнала изменений:
+// ReasonExpired, если ссылка подошла по сроку действия, иначе ReasonStale.
+func (f PurgeFilter) Reason(link Link) ChangeReason {
+	if !f.ExpiredBefore.IsZero() && !link.ExpiresAt.IsZero() && link.ExpiresAt.Before(f.ExpiredBefore) {
+		return ReasonExpired
+	}
+	return ReasonStale
+}
+
+// Locker реализуется хранилищами, умеющими брать блокировку, общую для всех реплик.
+type Locker interface {
+	// TryLock не ждет освобождения: ok=false, если блокировка занята.
+	// unlock нужно вызвать, только если ok=true.
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
 //go:generate mockgen -source=storage.go -destination=./mock/storage_mock.go
 type Storage interface {
-	SaveUrl(ctx context.Context, alias, UrlSave string) error
-	GetUrl(ctx context.Context, alias string) (string, error)
-	DeleteUrl(ctx context.Context, alias string) error
+	SaveUrl(ctx context.Context, link Link) error
+	// GetUrl возвращает ErrDisabled для отключенной и ErrNotFound для удаленной или истекшей ссылки.
+	GetUrl(ctx context.Context, domain, alias string) (Link, error)
+	// GetUrlInfo возвращает ссылку в любом статусе, в том числе удаленную до очистки.
+	GetUrlInfo(ctx context.Context, domain, alias string) (Link, error)
+	// TouchUrls сохраняет время последнего обращения и переходы по вариантам пачкой.
+	// Неизвестные ссылки пропускаются.
+	TouchUrls(ctx context.Context, accessed map[Key]Access) error
+	// ListUrls возвращает не удаленные ссылки всех доменов в порядке создания.
+	ListUrls(ctx context.Context, filter ListFilter) ([]Link, error)
+	// DeleteUrl мягко удаляет ссылку: alias остается занятым до PurgeDeleted.
+	DeleteUrl(ctx context.Context, domain, alias string) error
+	// DisableUrl и EnableUrl переключают active <-> disabled.
+	// ErrUnchanged, если ссылка уже в нужном статусе: ничего не меняется и в журнал не пишется.
+	DisableUrl(ctx context.Context, domain, alias string) error
+	EnableUrl(ctx context.Context, domain, alias string) error
+	// UseUrl атомарно списывает одно использование ссылки и возвращает, сколько осталось.
+	// ErrExhausted, если использований не осталось. Для ссылки без ограничения
+	// ничего не списывает и возвращает -1.
+	UseUrl(ctx context.Context, domain, alias string) (int64, error)
+	// RestoreUrl возвращает удаленную ссылку в active. ErrNotFound, если удаленной ссылки нет.
+	RestoreUrl(ctx context.Context, domain, alias string) error
+	// PurgeDeleted окончательно удаляет ссылки, удаленные раньше before.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// PurgeStale окончательно удаляет не более filter.Limit истекших или давно не использованных
+	// активных и отключенных ссылок и возвращает их адреса. Мягко удаленные ссылки пропускаются:
+	// их очищает PurgeDeleted по окончании срока хранения.
+	PurgeStale(ctx context.Context, filter PurgeFilter) ([]Key, error)
 	Disconnect(ctx context.Context) error
 }
@@ -0,0 +1,576 @@
+// Package storagetest общие проверки контракта storage.Storage. Каждое хранилище
+// запускает их из своих тестов через Run, новое хранилище подключается так же.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory создает пустое хранилище для одной проверки. Disconnect вызывает Run.
+type Factory func(t *testing.T) storage.Storage
+
+// Run проверяет хранилище: пустые аргументы, ErrExistAlias, ErrNotFound, статусы,
+// использования, выборку, очистку, конкурентный доступ, отмену контекста и большие значения.
+// Журнал изменений и позиция доставок проверяются, если хранилище их поддерживает.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"Empty Input", testEmptyInput},
+		{"Save And Get", testSaveAndGet},
+		{"Exist Alias", testExistAlias},
+		{"Not Found", testNotFound},
+		{"Status", testStatus},
+		{"Use Url", testUseUrl},
+		{"List Urls", testListUrls},
+		{"Touch Urls", testTouchUrls},
+		{"Purge", testPurge},
+		{"Purge Stale Keeps Deleted", testPurgeStaleKeepsDeleted},
+		{"Purge Stale Dry Run Pages", testPurgeStaleDryRunPages},
+		{"Concurrent Save", testConcurrentSave},
+		{"Concurrent Use", testConcurrentUse},
+		{"Canceled Context", testCanceledContext},
+		{"Large Values", testLargeValues},
+		{"Change Feed", testChangeFeed},
+		{"Webhook Offset", testWebhookOffset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage(t)
+			t.Cleanup(func() { _ = s.Disconnect(context.Background()) })
+			tt.fn(t, s)
+		})
+	}
+}
+
+func save(t *testing.T, s storage.Storage, link storage.Link) {
+	t.Helper()
+	require.NoError(t, s.SaveUrl(context.Background(), link))
+}
+
+func testEmptyInput(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Url: "http://example.com"}), storage.ErrAliasIsEmpty)
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Alias: "alias1"}), storage.ErrUrlIsEmpty)
+
+	_, err := s.GetUrl(ctx, "", "")
+	assert.ErrorIs(t, err, storage.ErrAliasIsEmpty)
+	_, err = s.GetUrlInfo(ctx, "", "")
+	assert.ErrorIs(t, err, storage.ErrAliasIsEmpty)
+	_, err = s.UseUrl(ctx, "", "")
+	assert.ErrorIs(t, err, storage.ErrAliasIsEmpty)
+	assert.ErrorIs(t, s.DeleteUrl(ctx, "", ""), storage.ErrAliasIsEmpty)
+	assert.ErrorIs(t, s.DisableUrl(ctx, "", ""), storage.ErrAliasIsEmpty)
+	assert.ErrorIs(t, s.EnableUrl(ctx, "", ""), storage.ErrAliasIsEmpty)
+	assert.ErrorIs(t, s.RestoreUrl(ctx, "", ""), storage.ErrAliasIsEmpty)
+
+	// пустое хранилище и пустые пачки - не ошибка
+	assert.NoError(t, s.TouchUrls(ctx, nil))
+	links, err := s.ListUrls(ctx, storage.ListFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+	purged, err := s.PurgeDeleted(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	keys, err := s.PurgeStale(ctx, storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func testSaveAndGet(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	save(t, s, storage.Link{
+		Domain:       "example.org",
+		Alias:        "alias1",
+		Url:          "http://example.com",
+		Title:        "Example",
+		Description:  "Описание",
+		Tags:         []string{"news", "go"},
+		Notes:        "заметка",
+		ExpiresAt:    expires,
+		Destinations: []storage.Destination{{Url: "http://a.example.com", Weight: 1}, {Url: "http://b.example.com", Weight: 3}},
+		MaxUses:      5,
+		UsesLeft:     5,
+		ForwardQuery: storage.QueryForwardMerge,
+		ForwardPath:  true,
+	})
+
+	link, err := s.GetUrl(ctx, "example.org", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", link.Domain)
+	assert.Equal(t, "alias1", link.Alias)
+	assert.Equal(t, "http://example.com", link.Url)
+	assert.Equal(t, "Example", link.Title)
+	assert.Equal(t, "Описание", link.Description)
+	assert.ElementsMatch(t, []string{"news", "go"}, link.Tags)
+	assert.Equal(t, "заметка", link.Notes)
+	assert.Equal(t, storage.StatusActive, link.Status)
+	assert.WithinDuration(t, expires, link.ExpiresAt, time.Millisecond)
+	assert.WithinDuration(t, time.Now(), link.CreatedAt, time.Minute)
+	assert.True(t, link.LastAccessedAt.IsZero())
+	assert.Len(t, link.Destinations, 2)
+	assert.Equal(t, int64(5), link.MaxUses)
+	assert.Equal(t, int64(5), link.UsesLeft)
+	assert.Equal(t, storage.QueryForwardMerge, link.ForwardQuery)
+	assert.True(t, link.ForwardPath)
+
+	// домены не пересекаются
+	_, err = s.GetUrl(ctx, "", "alias1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testExistAlias(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{Alias: "alias1", Url: "http://example.com"})
+
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Alias: "alias1", Url: "http://example.org"}), storage.ErrExistAlias)
+	assert.NoError(t, s.SaveUrl(ctx, storage.Link{Domain: "example.org", Alias: "alias1", Url: "http://example.org"}))
+
+	// удаленный alias занят до очистки
+	require.NoError(t, s.DeleteUrl(ctx, "", "alias1"))
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Alias: "alias1", Url: "http://example.org"}), storage.ErrExistAlias)
+
+	link, err := s.GetUrlInfo(ctx, "", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", link.Url)
+}
+
+func testNotFound(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetUrl(ctx, "", "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetUrlInfo(ctx, "", "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.UseUrl(ctx, "", "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.DeleteUrl(ctx, "", "missing"), storage.ErrNotFound)
+	assert.ErrorIs(t, s.DisableUrl(ctx, "", "missing"), storage.ErrNotFound)
+	assert.ErrorIs(t, s.EnableUrl(ctx, "", "missing"), storage.ErrNotFound)
+	assert.ErrorIs(t, s.RestoreUrl(ctx, "", "missing"), storage.ErrNotFound)
+
+	// истекшая ссылка не отдается для перехода, но видна в сведениях
+	save(t, s, storage.Link{Alias: "expired", Url: "http://example.com", ExpiresAt: time.Now().Add(-time.Minute)})
+	_, err = s.GetUrl(ctx, "", "expired")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetUrlInfo(ctx, "", "expired")
+	assert.NoError(t, err)
+
+	// неизвестные ссылки в пачке обращений пропускаются
+	assert.NoError(t, s.TouchUrls(ctx, map[storage.Key]storage.Access{{Alias: "missing"}: {At: time.Now()}}))
+}
+
+func testStatus(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{Alias: "alias1", Url: "http://example.com"})
+
+	require.NoError(t, s.DisableUrl(ctx, "", "alias1"))
+	assert.ErrorIs(t, s.DisableUrl(ctx, "", "alias1"), storage.ErrUnchanged)
+	_, err := s.GetUrl(ctx, "", "alias1")
+	assert.ErrorIs(t, err, storage.ErrDisabled)
+
+	require.NoError(t, s.EnableUrl(ctx, "", "alias1"))
+	assert.ErrorIs(t, s.EnableUrl(ctx, "", "alias1"), storage.ErrUnchanged)
+	_, err = s.GetUrl(ctx, "", "alias1")
+	assert.NoError(t, err)
+
+	// восстановить можно только удаленную ссылку
+	assert.ErrorIs(t, s.RestoreUrl(ctx, "", "alias1"), storage.ErrNotFound)
+
+	require.NoError(t, s.DeleteUrl(ctx, "", "alias1"))
+	assert.ErrorIs(t, s.DeleteUrl(ctx, "", "alias1"), storage.ErrNotFound)
+	assert.ErrorIs(t, s.DisableUrl(ctx, "", "alias1"), storage.ErrNotFound)
+	_, err = s.GetUrl(ctx, "", "alias1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	link, err := s.GetUrlInfo(ctx, "", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, storage.StatusDeleted, link.Status)
+
+	require.NoError(t, s.RestoreUrl(ctx, "", "alias1"))
+	link, err = s.GetUrl(ctx, "", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, storage.StatusActive, link.Status)
+}
+
+func testUseUrl(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{Alias: "limited", Url: "http://example.com", MaxUses: 2, UsesLeft: 2})
+	save(t, s, storage.Link{Alias: "unlimited", Url: "http://example.com"})
+
+	left, err := s.UseUrl(ctx, "", "limited")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), left)
+	left, err = s.UseUrl(ctx, "", "limited")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), left)
+	_, err = s.UseUrl(ctx, "", "limited")
+	assert.ErrorIs(t, err, storage.ErrExhausted)
+
+	left, err = s.UseUrl(ctx, "", "unlimited")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), left)
+}
+
+func testListUrls(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		tags := []string{"all"}
+		if i%2 == 0 {
+			tags = append(tags, "even")
+		}
+		save(t, s, storage.Link{Alias: fmt.Sprintf("alias%d", i), Url: "http://example.com", Tags: tags})
+	}
+	require.NoError(t, s.DeleteUrl(ctx, "", "alias3"))
+
+	aliases := func(links []storage.Link) []string {
+		result := make([]string, 0, len(links))
+		for _, link := range links {
+			result = append(result, link.Alias)
+		}
+		return result
+	}
+
+	links, err := s.ListUrls(ctx, storage.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alias1", "alias2", "alias4", "alias5"}, aliases(links))
+
+	links, err = s.ListUrls(ctx, storage.ListFilter{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alias2", "alias4"}, aliases(links))
+
+	links, err = s.ListUrls(ctx, storage.ListFilter{Tag: "even"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alias2", "alias4"}, aliases(links))
+
+	links, err = s.ListUrls(ctx, storage.ListFilter{Offset: 10})
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func testTouchUrls(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{
+		Alias:        "alias1",
+		Url:          "http://example.com",
+		Destinations: []storage.Destination{{Url: "http://a.example.com", Weight: 1}, {Url: "http://b.example.com", Weight: 1}},
+	})
+
+	at := time.Now().Truncate(time.Millisecond)
+	key := storage.Key{Alias: "alias1"}
+	require.NoError(t, s.TouchUrls(ctx, map[storage.Key]storage.Access{key: {At: at, Clicks: map[int]int64{1: 2}}}))
+	// более раннее обращение время не откатывает, переходы суммируются
+	require.NoError(t, s.TouchUrls(ctx, map[storage.Key]storage.Access{key: {At: at.Add(-time.Hour), Clicks: map[int]int64{1: 1}}}))
+
+	link, err := s.GetUrlInfo(ctx, "", "alias1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, at, link.LastAccessedAt, time.Millisecond)
+	require.Len(t, link.Destinations, 2)
+	assert.Equal(t, int64(0), link.Destinations[0].Clicks)
+	assert.Equal(t, int64(3), link.Destinations[1].Clicks)
+}
+
+func testPurge(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{Alias: "deleted", Url: "http://example.com"})
+	save(t, s, storage.Link{Alias: "expired", Url: "http://example.com", ExpiresAt: time.Now().Add(-time.Hour)})
+	save(t, s, storage.Link{Alias: "alive", Url: "http://example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, s.DeleteUrl(ctx, "", "deleted"))
+
+	purged, err := s.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = s.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	// после очистки alias свободен
+	_, err = s.GetUrlInfo(ctx, "", "deleted")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, s.SaveUrl(ctx, storage.Link{Alias: "deleted", Url: "http://example.org"}))
+
+	filter := storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 10, DryRun: true}
+	keys, err := s.PurgeStale(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired"}}, keys)
+	_, err = s.GetUrlInfo(ctx, "", "expired")
+	assert.NoError(t, err)
+
+	filter.DryRun = false
+	keys, err = s.PurgeStale(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired"}}, keys)
+	_, err = s.GetUrlInfo(ctx, "", "expired")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetUrl(ctx, "", "alive")
+	assert.NoError(t, err)
+}
+
+func testPurgeStaleKeepsDeleted(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	save(t, s, storage.Link{Alias: "expired", Url: "http://example.com", ExpiresAt: time.Now().Add(-time.Hour)})
+	save(t, s, storage.Link{Alias: "unused", Url: "http://example.com"})
+	require.NoError(t, s.DeleteUrl(ctx, "", "expired"))
+	require.NoError(t, s.DeleteUrl(ctx, "", "unused"))
+
+	// удаленные ссылки ждут конца срока хранения, даже если истекли или давно без обращений
+	keys, err := s.PurgeStale(ctx, storage.PurgeFilter{
+		ExpiredBefore:    time.Now(),
+		NotAccessedSince: time.Now().Add(time.Minute),
+		Limit:            10,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.NoError(t, s.RestoreUrl(ctx, "", "unused"))
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Alias: "expired", Url: "http://example.org"}), storage.ErrExistAlias)
+}
+
+func testPurgeStaleDryRunPages(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for _, alias := range []string{"expired1", "expired2", "expired3"} {
+		save(t, s, storage.Link{Alias: alias, Url: "http://example.com", ExpiresAt: time.Now().Add(-time.Hour)})
+	}
+
+	// пробный проход ничего не удаляет, поэтому следующая пачка читается со сдвигом
+	filter := storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 2, DryRun: true}
+	keys, err := s.PurgeStale(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired1"}, {Alias: "expired2"}}, keys)
+
+	filter.Offset = 2
+	keys, err = s.PurgeStale(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired3"}}, keys)
+
+	filter.Offset = 3
+	keys, err = s.PurgeStale(ctx, filter)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = s.GetUrlInfo(ctx, "", "expired1")
+	assert.NoError(t, err)
+}
+
+// concurrency число одновременных вызовов в проверках конкурентного доступа.
+const concurrency = 20
+
+func testConcurrentSave(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	errs := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.SaveUrl(ctx, storage.Link{Alias: "alias1", Url: fmt.Sprintf("http://example.com/%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+		assert.ErrorIs(t, err, storage.ErrExistAlias)
+	}
+	assert.Equal(t, 1, saved)
+}
+
+func testConcurrentUse(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const maxUses = concurrency / 2
+	save(t, s, storage.Link{Alias: "limited", Url: "http://example.com", MaxUses: maxUses, UsesLeft: maxUses})
+
+	errs := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.UseUrl(ctx, "", "limited")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	used := 0
+	for err := range errs {
+		if err == nil {
+			used++
+			continue
+		}
+		assert.ErrorIs(t, err, storage.ErrExhausted)
+	}
+	assert.Equal(t, maxUses, used)
+
+	link, err := s.GetUrlInfo(ctx, "", "limited")
+	require.NoError(t, err)
+	assert.Zero(t, link.UsesLeft)
+}
+
+func testCanceledContext(t *testing.T, s storage.Storage) {
+	save(t, s, storage.Link{Alias: "alias1", Url: "http://example.com"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.SaveUrl(ctx, storage.Link{Alias: "alias2", Url: "http://example.com"})
+	assert.True(t, errors.Is(err, context.Canceled), "SaveUrl: %v", err)
+	_, err = s.GetUrl(ctx, "", "alias1")
+	assert.True(t, errors.Is(err, context.Canceled), "GetUrl: %v", err)
+	_, err = s.UseUrl(ctx, "", "alias1")
+	assert.True(t, errors.Is(err, context.Canceled), "UseUrl: %v", err)
+	err = s.DeleteUrl(ctx, "", "alias1")
+	assert.True(t, errors.Is(err, context.Canceled), "DeleteUrl: %v", err)
+
+	// отмененные вызовы ничего не изменили
+	_, err = s.GetUrlInfo(context.Background(), "", "alias2")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	link, err := s.GetUrl(context.Background(), "", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, storage.StatusActive, link.Status)
+}
+
+func testLargeValues(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	// длина Url считается в символах, а не в байтах
+	prefix := "http://example.com/"
+	longUrl := prefix + strings.Repeat("я", storage.MaxUrlLength-len(prefix))
+	notes := strings.Repeat("заметка ", 8*1024)
+	tags := make([]string, 100)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	save(t, s, storage.Link{Alias: "large", Url: longUrl, Notes: notes, Tags: tags})
+	assert.ErrorIs(t, s.SaveUrl(ctx, storage.Link{Alias: "too-long", Url: longUrl + "я"}), storage.ErrUrlTooLong)
+
+	link, err := s.GetUrl(ctx, "", "large")
+	require.NoError(t, err)
+	assert.Equal(t, longUrl, link.Url)
+	assert.Equal(t, notes, link.Notes)
+	assert.ElementsMatch(t, tags, link.Tags)
+
+	links, err := s.ListUrls(ctx, storage.ListFilter{Tag: "tag99"})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "large", links[0].Alias)
+}
+
+func testChangeFeed(t *testing.T, s storage.Storage) {
+	feed, ok := s.(storage.ChangeFeed)
+	if !ok {
+		t.Skip("хранилище без журнала изменений")
+	}
+	ctx := context.Background()
+
+	save(t, s, storage.Link{Alias: "limited", Url: "http://example.com", MaxUses: 1, UsesLeft: 1})
+	save(t, s, storage.Link{Alias: "expired", Url: "http://example.com", ExpiresAt: time.Now().Add(-time.Hour)})
+	save(t, s, storage.Link{Alias: "deleted", Url: "http://example.com"})
+
+	_, err := s.UseUrl(ctx, "", "limited")
+	require.NoError(t, err)
+	require.NoError(t, s.DisableUrl(ctx, "", "limited"))
+	assert.ErrorIs(t, s.DisableUrl(ctx, "", "limited"), storage.ErrUnchanged)
+	require.NoError(t, s.DeleteUrl(ctx, "", "deleted"))
+	purged, err := s.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+	keys, err := s.PurgeStale(ctx, storage.PurgeFilter{ExpiredBefore: time.Now()})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	changes, err := feed.ReadChanges(ctx, "", 100)
+	require.NoError(t, err)
+
+	type entry struct {
+		op     storage.ChangeOp
+		alias  string
+		status storage.Status
+		reason storage.ChangeReason
+	}
+	got := make([]entry, 0, len(changes))
+	for _, change := range changes {
+		got = append(got, entry{change.Op, change.Alias, change.Status, change.Reason})
+	}
+	assert.Equal(t, []entry{
+		{storage.ChangeInsert, "limited", storage.StatusActive, ""},
+		{storage.ChangeInsert, "expired", storage.StatusActive, ""},
+		{storage.ChangeInsert, "deleted", storage.StatusActive, ""},
+		{storage.ChangeUpdate, "limited", storage.StatusActive, storage.ReasonExhausted},
+		{storage.ChangeUpdate, "limited", storage.StatusDisabled, ""},
+		{storage.ChangeUpdate, "deleted", storage.StatusDeleted, ""},
+		{storage.ChangeDelete, "deleted", "", storage.ReasonPurged},
+		{storage.ChangeDelete, "expired", "", storage.ReasonExpired},
+	}, got)
+	require.Len(t, changes, 8)
+	assert.Equal(t, "http://example.com", changes[0].Url)
+
+	// чтение продолжается после позиции
+	rest, err := feed.ReadChanges(ctx, changes[5].Offset, 100)
+	require.NoError(t, err)
+	require.Len(t, rest, 2)
+	assert.Equal(t, changes[6].Offset, rest[0].Offset)
+}
+
+func testWebhookOffset(t *testing.T, s storage.Storage) {
+	store, ok := s.(storage.WebhookStore)
+	if !ok {
+		t.Skip("хранилище без подписок")
+	}
+	ctx := context.Background()
+
+	offset, err := store.WebhookOffset(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, offset)
+
+	require.NoError(t, store.SaveWebhook(ctx, storage.Webhook{ID: "hook-1", Url: "http://example.com", Secret: "0123456789abcdef"}))
+	deliveries := []storage.Delivery{{
+		ID:          "event-1-hook-1",
+		WebhookID:   "hook-1",
+		Event:       "link.created",
+		Payload:     []byte(`{}`),
+		NextAttempt: time.Now().Add(-time.Second),
+	}}
+	require.NoError(t, store.EnqueueDeliveries(ctx, deliveries, "", "1-1"))
+
+	// позицию уже перенесли: ничего не записывается
+	assert.ErrorIs(t, store.EnqueueDeliveries(ctx, []storage.Delivery{{
+		ID: "event-2-hook-1", WebhookID: "hook-1", Event: "link.created", Payload: []byte(`{}`),
+	}}, "", "1-2"), storage.ErrOffsetMoved)
+	offset, err = store.WebhookOffset(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1-1", offset)
+
+	// уже поставленная доставка не дублируется, пустая пачка переносит позицию
+	require.NoError(t, store.EnqueueDeliveries(ctx, deliveries, "1-1", "1-2"))
+	require.NoError(t, store.EnqueueDeliveries(ctx, nil, "1-2", "1-3"))
+	offset, err = store.WebhookOffset(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1-3", offset)
+
+	claimed, err := store.ClaimDeliveries(ctx, time.Now(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "event-1-hook-1", claimed[0].ID)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrOffsetMoved = errors.New("ошибка: позицию журнала изменений уже перенесли")
+
+// Webhook подписка на события ссылок.
+type Webhook struct {
+	ID        string
+	Url       string
+	Secret    string   // ключ HMAC подписи доставок
+	Events    []string // типы событий, пусто - все
+	Domains   []string // имена доменов ссылок, пусто - все
+	CreatedAt time.Time
+}
+
+// Delivery доставка события подписчику, ожидающая в outbox.
+type Delivery struct {
+	ID          string
+	WebhookID   string
+	Event       string // тип события
+	Payload     []byte // тело запроса, подписывается как есть
+	Attempts    int    // неудачные попытки
+	NextAttempt time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// WebhookStore реализуется хранилищами, которые хранят подписки и outbox доставок,
+// чтобы события переживали перезапуск. Доставки строятся по журналу изменений ссылок,
+// поэтому хранилище держит и позицию журнала, до которой они уже поставлены.
+type WebhookStore interface {
+	SaveWebhook(ctx context.Context, webhook Webhook) error
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	// DeleteWebhook удаляет подписку, ее недоставленные события больше не отправляются.
+	// ErrNotFound - подписки нет.
+	DeleteWebhook(ctx context.Context, id string) error
+
+	// WebhookOffset возвращает позицию журнала изменений, до которой доставки уже поставлены.
+	// Пусто - с начала журнала.
+	WebhookOffset(ctx context.Context) (string, error)
+	// EnqueueDeliveries кладет доставки в outbox и переносит позицию журнала с from на to
+	// в одной транзакции. ErrOffsetMoved - позиция уже не from, ничего не записано.
+	// Доставка с уже поставленным id пропускается.
+	EnqueueDeliveries(ctx context.Context, deliveries []Delivery, from, to string) error
+	// ClaimDeliveries возвращает до limit доставок, время которых наступило к now,
+	// и откладывает их до now+lease, чтобы другая реплика не отправила их одновременно.
+	ClaimDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Delivery, error)
+	// CompleteDelivery удаляет доставку из outbox.
+	CompleteDelivery(ctx context.Context, id string) error
+	// RetryDelivery откладывает доставку до next после неудачной попытки.
+	RetryDelivery(ctx context.Context, id string, attempts int, next time.Time, lastErr string) error
+}
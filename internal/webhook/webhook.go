@@ -0,0 +1,403 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderID        = "X-Webhook-Id"        // id события, одинаков во всех попытках
+	HeaderEvent     = "X-Webhook-Event"     // тип события
+	HeaderTimestamp = "X-Webhook-Timestamp" // unix время попытки
+	// HeaderSignature "sha256=" + hex HMAC-SHA256 ключа подписки от "<timestamp>.<тело>"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// metrics счетчики доставок, публикуются через expvar (/debug/vars).
+var metrics = expvar.NewMap("webhooks")
+
+// Config параметры отправки.
+type Config struct {
+	Interval    time.Duration // период чтения журнала и выборки outbox, 0 - отправка выключена
+	BatchSize   int           // сколько записей журнала и доставок выбирается за раз
+	Workers     int           // одновременных запросов
+	MaxAttempts int           // после стольких неудач доставка отбрасывается
+	BaseBackoff time.Duration // пауза после первой неудачи, дальше удваивается
+	MaxBackoff  time.Duration
+	Timeout     time.Duration // таймаут одного запроса
+}
+
+// Report итог одного прохода.
+type Report struct {
+	Delivered int
+	Retried   int
+	Dropped   int // исчерпаны попытки или подписка удалена
+}
+
+// Source отдает события ссылок из журнала изменений, см. service.Service.ReadEvents.
+type Source interface {
+	ReadEvents(ctx context.Context, offset string, limit int) ([]service.Event, string, error)
+}
+
+// Dispatcher строит доставки по журналу изменений ссылок, ставит их в outbox хранилища
+// и отправляет подписчикам. Журнал пишется в одной транзакции с изменением ссылки,
+// поэтому событие не теряется при падении между изменением и постановкой в outbox;
+// доставка выполняется хотя бы один раз, получатель отсеивает повторы по HeaderID.
+type Dispatcher struct {
+	store  storage.WebhookStore
+	source Source
+	client *http.Client
+	cfg    Config
+	now    func() time.Time
+}
+
+// New создает отправителя событий source. client nil - клиент с таймаутом cfg.Timeout.
+// Адреса подписок задают администраторы, поэтому внутренняя сеть не запрещена.
+func New(store storage.WebhookStore, source Source, client *http.Client, cfg Config) *Dispatcher {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 8
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = max(time.Hour, cfg.BaseBackoff)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Dispatcher{
+		store:  store,
+		source: source,
+		client: client,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Relay ставит в outbox доставки событий, появившихся в журнале после сохраненной позиции,
+// и возвращает их число. Доставки и новая позиция записываются вместе, поэтому событие
+// ставится один раз: реплика, чью позицию уже перенесла другая, прекращает проход.
+func (d *Dispatcher) Relay(ctx context.Context) (int, error) {
+	const op = "webhook.Relay"
+
+	from, err := d.store.WebhookOffset(ctx)
+	if err != nil {
+		metrics.Add("errors", 1)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var enqueued int
+	for {
+		events, to, err := d.source.ReadEvents(ctx, from, d.cfg.BatchSize)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return enqueued, fmt.Errorf("%s: offset='%s'. %w", op, from, err)
+		}
+		if to == from {
+			return enqueued, nil
+		}
+
+		// подписки читаются после журнала: подписка, созданная позже, его события не получает
+		deliveries, err := d.deliveries(ctx, events)
+		if err != nil {
+			metrics.Add("errors", 1)
+			return enqueued, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err = d.store.EnqueueDeliveries(ctx, deliveries, from, to); err != nil {
+			if errors.Is(err, storage.ErrOffsetMoved) {
+				return enqueued, nil
+			}
+			metrics.Add("errors", 1)
+			return enqueued, fmt.Errorf("%s: offset='%s'. %w", op, from, err)
+		}
+		enqueued += len(deliveries)
+		metrics.Add("enqueued", int64(len(deliveries)))
+		from = to
+	}
+}
+
+// deliveries строит доставки событий для подписок, фильтры которых они проходят.
+// Id доставки выводится из id события, поэтому повтор дает тот же id.
+func (d *Dispatcher) deliveries(ctx context.Context, events []service.Event) ([]storage.Delivery, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	webhooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []storage.Delivery
+	for _, event := range events {
+		var payload []byte
+		for _, webhook := range webhooks {
+			if !Matches(webhook, event) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(event); err != nil {
+					return nil, err
+				}
+			}
+			deliveries = append(deliveries, storage.Delivery{
+				ID:          event.ID + "-" + webhook.ID,
+				WebhookID:   webhook.ID,
+				Event:       string(event.Type),
+				Payload:     payload,
+				NextAttempt: event.At,
+			})
+		}
+	}
+	return deliveries, nil
+}
+
+// Matches проверяет событие по фильтрам подписки. Пустой фильтр пропускает все.
+// События до создания подписки ей не отправляются.
+func Matches(webhook storage.Webhook, event service.Event) bool {
+	if event.At.Before(webhook.CreatedAt) {
+		return false
+	}
+	if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, string(event.Type)) {
+		return false
+	}
+	if len(webhook.Domains) > 0 && !slices.Contains(webhook.Domains, event.Domain) {
+		return false
+	}
+	return true
+}
+
+// Sign возвращает значение HeaderSignature для тела body, отправленного в timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run каждые Interval ставит в outbox новые события журнала и отправляет наступившие доставки,
+// пока ctx не отменен.
+func (d *Dispatcher) Run(ctx context.Context) {
+	const op = "webhook.Run"
+
+	if d.cfg.Interval <= 0 {
+		return
+	}
+
+	log.Printf("%s: interval='%s' batch=%d workers=%d", op, d.cfg.Interval, d.cfg.BatchSize, d.cfg.Workers)
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Relay(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("%s: %v", op, err)
+			}
+			report, err := d.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("%s: %v", op, err)
+			}
+			if report.Retried+report.Dropped > 0 {
+				log.Printf("%s: доставлено: %d, отложено: %d, отброшено: %d",
+					op, report.Delivered, report.Retried, report.Dropped)
+			}
+		}
+	}
+}
+
+// RunOnce выбирает наступившие доставки и отправляет их.
+func (d *Dispatcher) RunOnce(ctx context.Context) (Report, error) {
+	const op = "webhook.RunOnce"
+
+	var report Report
+
+	now := d.now()
+	// аренда покрывает худший случай: все запросы пачки упираются в таймаут
+	rounds := (d.cfg.BatchSize + d.cfg.Workers - 1) / d.cfg.Workers
+	lease := time.Duration(rounds+1) * d.cfg.Timeout
+
+	deliveries, err := d.store.ClaimDeliveries(ctx, now, d.cfg.BatchSize, lease)
+	if err != nil {
+		metrics.Add("errors", 1)
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(deliveries) == 0 {
+		return report, nil
+	}
+
+	webhooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		metrics.Add("errors", 1)
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	byID := make(map[string]storage.Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		byID[webhook.ID] = webhook
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, d.cfg.Workers)
+	)
+	for _, delivery := range deliveries {
+		webhook, ok := byID[delivery.WebhookID]
+		if !ok {
+			if err = d.store.CompleteDelivery(ctx, delivery.ID); err != nil {
+				metrics.Add("errors", 1)
+				log.Printf("%s: id='%s'. %v", op, delivery.ID, err)
+			}
+			report.Dropped++
+			metrics.Add("dropped", 1)
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := d.process(ctx, webhook, delivery)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch result {
+			case resultDelivered:
+				report.Delivered++
+			case resultRetried:
+				report.Retried++
+			case resultDropped:
+				report.Dropped++
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report, nil
+}
+
+type result int
+
+const (
+	resultFailed result = iota // ошибка хранилища, доставка вернется после аренды
+	resultDelivered
+	resultRetried
+	resultDropped
+)
+
+// process отправляет доставку и записывает итог в outbox.
+func (d *Dispatcher) process(ctx context.Context, webhook storage.Webhook, delivery storage.Delivery) result {
+	const op = "webhook.process"
+
+	sendErr := d.send(ctx, webhook, delivery)
+	if sendErr == nil {
+		if err := d.store.CompleteDelivery(ctx, delivery.ID); err != nil {
+			metrics.Add("errors", 1)
+			log.Printf("%s: id='%s'. %v", op, delivery.ID, err)
+			return resultFailed
+		}
+		metrics.Add("delivered", 1)
+		return resultDelivered
+	}
+	metrics.Add("failed", 1)
+
+	attempts := delivery.Attempts + 1
+	if attempts >= d.cfg.MaxAttempts {
+		log.Printf("%s: доставка отброшена после %d попыток: id='%s' url='%s'. %v",
+			op, attempts, delivery.ID, webhook.Url, sendErr)
+		if err := d.store.CompleteDelivery(ctx, delivery.ID); err != nil {
+			metrics.Add("errors", 1)
+			log.Printf("%s: id='%s'. %v", op, delivery.ID, err)
+			return resultFailed
+		}
+		metrics.Add("dropped", 1)
+		return resultDropped
+	}
+
+	next := d.now().Add(d.backoff(attempts))
+	if err := d.store.RetryDelivery(ctx, delivery.ID, attempts, next, sendErr.Error()); err != nil {
+		metrics.Add("errors", 1)
+		log.Printf("%s: id='%s'. %v", op, delivery.ID, err)
+		return resultFailed
+	}
+	return resultRetried
+}
+
+// send выполняет один запрос. Успех - любой ответ 2xx.
+func (d *Dispatcher) send(ctx context.Context, webhook storage.Webhook, delivery storage.Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhook/1.0")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("ответ %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff пауза перед попыткой attempts+1: BaseBackoff·2^(attempts-1), не больше MaxBackoff,
+// со случайным разбросом в нижнюю половину, чтобы повторы не приходили пачкой.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.MaxBackoff
+	if shift := attempts - 1; shift < 32 {
+		if exp := d.cfg.BaseBackoff << shift; exp > 0 && exp < delay {
+			delay = exp
+		}
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
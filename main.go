@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/RVodassa/url-shortener/app"
 	"github.com/RVodassa/url-shortener/internal/config"
 	"github.com/joho/godotenv"
@@ -24,6 +25,14 @@ func main() {
 		log.Fatal("ошибка: конфиг. не готов к работе")
 	}
 
+	// миграции схемы: url-shortener migrate up | down N | version | force V
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = app.RunMigrate(context.Background(), cfg, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// запуск
 	newApp := app.New(cfg, storageType)
 	newApp.Run()
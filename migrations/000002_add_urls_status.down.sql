@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS indx_urls_deleted_at;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS status;
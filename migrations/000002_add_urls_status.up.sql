@@ -0,0 +1,5 @@
+ALTER TABLE urls
+    ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'active',
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX indx_urls_deleted_at ON urls (deleted_at) WHERE status = 'deleted';
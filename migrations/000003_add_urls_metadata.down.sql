@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS indx_urls_tags;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS title;
@@ -0,0 +1,7 @@
+ALTER TABLE urls
+    ADD COLUMN title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN notes TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX indx_urls_tags ON urls USING GIN (tags);
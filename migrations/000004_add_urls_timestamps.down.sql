@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS last_accessed_at,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_accessed_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS indx_urls_expires_at;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,6 @@
+-- откат не пройдет, если один alias уже занят в нескольких доменах
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_domain_alias_key;
+ALTER TABLE urls ADD CONSTRAINT urls_alias_key UNIQUE (alias);
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS domain;
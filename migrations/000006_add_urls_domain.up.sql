@@ -0,0 +1,6 @@
+-- существующие ссылки остаются в домене по умолчанию ('')
+ALTER TABLE urls
+    ADD COLUMN domain VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_alias_key;
+ALTER TABLE urls ADD CONSTRAINT urls_domain_alias_key UNIQUE (domain, alias);
@@ -0,0 +1,3 @@
+-- условия перехода по порядку проверки, см. storage.Rule
+ALTER TABLE urls
+    ADD COLUMN rules JSONB NOT NULL DEFAULT '[]';
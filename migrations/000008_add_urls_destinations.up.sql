@@ -0,0 +1,5 @@
+-- варианты A/B разделения, см. storage.Destination
+ALTER TABLE urls
+    ADD COLUMN destinations JSONB NOT NULL DEFAULT '[]',
+    -- переходы по вариантам: индекс варианта -> число переходов
+    ADD COLUMN destination_clicks JSONB NOT NULL DEFAULT '{}';
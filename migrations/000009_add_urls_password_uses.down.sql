@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS uses_left,
+    DROP COLUMN IF EXISTS max_uses,
+    DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    ADD COLUMN password_hash TEXT NOT NULL DEFAULT '', -- bcrypt, пусто - без пароля
+    ADD COLUMN max_uses BIGINT NOT NULL DEFAULT 0, -- 0 - без ограничения
+    ADD COLUMN uses_left BIGINT NOT NULL DEFAULT 0 CHECK (uses_left >= 0);
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS page,
+    DROP COLUMN IF EXISTS preview;
@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    ADD COLUMN preview BOOLEAN NOT NULL DEFAULT false, -- страница предпросмотра перед переходом
+    -- сведения о странице назначения, см. storage.Page
+    ADD COLUMN page JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS forward_path,
+    DROP COLUMN IF EXISTS forward_query;
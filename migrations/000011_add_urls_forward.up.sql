@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    -- перенос query параметров перехода, см. storage.QueryForward
+    ADD COLUMN forward_query TEXT NOT NULL DEFAULT '' CHECK (forward_query IN ('', 'merge', 'override')),
+    ADD COLUMN forward_path BOOLEAN NOT NULL DEFAULT false; -- дописывать путь после alias
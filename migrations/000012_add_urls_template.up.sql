@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    -- адреса ссылки - шаблоны с {имя}, см. storage.Link.Template
+    ADD COLUMN template BOOLEAN NOT NULL DEFAULT false;
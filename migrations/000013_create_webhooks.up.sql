@@ -0,0 +1,23 @@
+-- подписки на события ссылок
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL, -- ключ HMAC подписи
+    events TEXT[] NOT NULL DEFAULT '{}', -- пусто - все события
+    domains TEXT[] NOT NULL DEFAULT '{}', -- пусто - все домены
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- outbox доставок: строка живет, пока подписчик не примет событие или не кончатся попытки
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload BYTEA NOT NULL, -- тело запроса как есть, чтобы подпись сходилась
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS indx_webhook_deliveries_next ON webhook_deliveries (next_attempt_at);
@@ -0,0 +1,16 @@
+-- журнал изменений ссылок; строки пишутся тем же запросом, что меняет urls.
+-- tx - транзакция записи: читатель берет только строки завершенных транзакций
+-- в порядке (tx, id), поэтому позиция чтения не перескакивает незакоммиченные строки.
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    tx XID8 NOT NULL DEFAULT pg_current_xact_id(),
+    op TEXT NOT NULL CHECK (op IN ('insert', 'update', 'delete')),
+    domain TEXT NOT NULL,
+    alias TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS indx_outbox_position ON outbox (tx, id);
+CREATE INDEX IF NOT EXISTS indx_outbox_created_at ON outbox (created_at);
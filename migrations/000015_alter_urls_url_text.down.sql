@@ -0,0 +1,6 @@
+-- откат не пройдет, если есть url длиннее 255 символов
+CREATE INDEX IF NOT EXISTS indx_alias ON urls (alias);
+
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_url_check;
+
+ALTER TABLE urls ALTER COLUMN url TYPE VARCHAR(255);
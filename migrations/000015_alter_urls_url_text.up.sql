@@ -0,0 +1,8 @@
+-- VARCHAR(255) не вмещает адреса с метками кампаний; длину ограничивает проверка
+ALTER TABLE urls ALTER COLUMN url TYPE TEXT;
+
+ALTER TABLE urls
+    ADD CONSTRAINT urls_url_check CHECK (char_length(url) BETWEEN 1 AND 8192);
+
+-- alias уже проиндексирован ограничением уникальности (domain, alias)
+DROP INDEX IF EXISTS indx_alias;
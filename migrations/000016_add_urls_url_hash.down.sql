@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS indx_urls_url_hash;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS url_hash;
@@ -0,0 +1,5 @@
+-- поиск ссылок по адресу: индекс по хэшу вместо индекса по длинному тексту
+ALTER TABLE urls
+    ADD COLUMN url_hash BYTEA GENERATED ALWAYS AS (sha256(convert_to(url, 'UTF8'))) STORED;
+
+CREATE INDEX indx_urls_url_hash ON urls (url_hash);
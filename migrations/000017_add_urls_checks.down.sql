@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_status_check,
+    DROP CONSTRAINT IF EXISTS urls_alias_check;
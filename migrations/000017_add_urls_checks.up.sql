@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    ADD CONSTRAINT urls_alias_check CHECK (alias <> ''),
+    ADD CONSTRAINT urls_status_check CHECK (status IN ('active', 'disabled', 'deleted'));
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhook_offset;
+
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS reason;
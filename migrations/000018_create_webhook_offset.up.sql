@@ -0,0 +1,15 @@
+-- причина изменения, которую не выразить op и status: исчерпание использований, вид очистки
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
+
+-- позиция outbox, до которой события уже поставлены в webhook_deliveries; одна строка.
+-- Переносится в одной транзакции с постановкой доставок. Начинается с конца журнала:
+-- события до обновления уже поставлены в outbox прежней версией.
+CREATE TABLE IF NOT EXISTS webhook_offset (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    position TEXT NOT NULL
+);
+
+INSERT INTO webhook_offset (position)
+SELECT COALESCE((SELECT tx::text || '-' || id FROM outbox ORDER BY tx DESC, id DESC LIMIT 1), '')
+ON CONFLICT DO NOTHING;
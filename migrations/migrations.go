@@ -0,0 +1,8 @@
+// Package migrations встраивает миграции схемы Postgres в бинарный файл,
+// чтобы они не зависели от рабочего каталога.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
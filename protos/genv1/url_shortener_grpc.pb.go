@@ -21,6 +21,16 @@ type UrlShortenerClient interface {
 	SaveUrl(ctx context.Context, in *SaveUrlRequest, opts ...grpc.CallOption) (*SaveUrlResponse, error)
 	GetUrl(ctx context.Context, in *GetUrlRequest, opts ...grpc.CallOption) (*GetUrlResponse, error)
 	DeleteUrl(ctx context.Context, in *DeleteUrlRequest, opts ...grpc.CallOption) (*DeleteUrlResponse, error)
+	DisableUrl(ctx context.Context, in *DisableUrlRequest, opts ...grpc.CallOption) (*DisableUrlResponse, error)
+	EnableUrl(ctx context.Context, in *EnableUrlRequest, opts ...grpc.CallOption) (*EnableUrlResponse, error)
+	RestoreUrl(ctx context.Context, in *RestoreUrlRequest, opts ...grpc.CallOption) (*RestoreUrlResponse, error)
+	ListUrls(ctx context.Context, in *ListUrlsRequest, opts ...grpc.CallOption) (*ListUrlsResponse, error)
+	GetUrlInfo(ctx context.Context, in *GetUrlInfoRequest, opts ...grpc.CallOption) (*GetUrlInfoResponse, error)
+	GetQrCode(ctx context.Context, in *GetQrCodeRequest, opts ...grpc.CallOption) (*GetQrCodeResponse, error)
+	CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*CreateWebhookResponse, error)
+	ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksResponse, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error)
+	WatchUrls(ctx context.Context, in *WatchUrlsRequest, opts ...grpc.CallOption) (UrlShortener_WatchUrlsClient, error)
 }
 
 type urlShortenerClient struct {
@@ -58,6 +68,119 @@ func (c *urlShortenerClient) DeleteUrl(ctx context.Context, in *DeleteUrlRequest
 	return out, nil
 }
 
+func (c *urlShortenerClient) DisableUrl(ctx context.Context, in *DisableUrlRequest, opts ...grpc.CallOption) (*DisableUrlResponse, error) {
+	out := new(DisableUrlResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/DisableUrl", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) EnableUrl(ctx context.Context, in *EnableUrlRequest, opts ...grpc.CallOption) (*EnableUrlResponse, error) {
+	out := new(EnableUrlResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/EnableUrl", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) RestoreUrl(ctx context.Context, in *RestoreUrlRequest, opts ...grpc.CallOption) (*RestoreUrlResponse, error) {
+	out := new(RestoreUrlResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/RestoreUrl", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) ListUrls(ctx context.Context, in *ListUrlsRequest, opts ...grpc.CallOption) (*ListUrlsResponse, error) {
+	out := new(ListUrlsResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/ListUrls", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) GetUrlInfo(ctx context.Context, in *GetUrlInfoRequest, opts ...grpc.CallOption) (*GetUrlInfoResponse, error) {
+	out := new(GetUrlInfoResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/GetUrlInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) GetQrCode(ctx context.Context, in *GetQrCodeRequest, opts ...grpc.CallOption) (*GetQrCodeResponse, error) {
+	out := new(GetQrCodeResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/GetQrCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*CreateWebhookResponse, error) {
+	out := new(CreateWebhookResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/CreateWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksResponse, error) {
+	out := new(ListWebhooksResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/ListWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookResponse, error) {
+	out := new(DeleteWebhookResponse)
+	err := c.cc.Invoke(ctx, "/urlshortener.UrlShortener/DeleteWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *urlShortenerClient) WatchUrls(ctx context.Context, in *WatchUrlsRequest, opts ...grpc.CallOption) (UrlShortener_WatchUrlsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &UrlShortener_ServiceDesc.Streams[0], "/urlshortener.UrlShortener/WatchUrls", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &urlShortenerWatchUrlsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UrlShortener_WatchUrlsClient interface {
+	Recv() (*UrlChange, error)
+	grpc.ClientStream
+}
+
+type urlShortenerWatchUrlsClient struct {
+	grpc.ClientStream
+}
+
+func (x *urlShortenerWatchUrlsClient) Recv() (*UrlChange, error) {
+	m := new(UrlChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // UrlShortenerServer is the server API for UrlShortener service.
 // All implementations must embed UnimplementedUrlShortenerServer
 // for forward compatibility
@@ -65,6 +188,16 @@ type UrlShortenerServer interface {
 	SaveUrl(context.Context, *SaveUrlRequest) (*SaveUrlResponse, error)
 	GetUrl(context.Context, *GetUrlRequest) (*GetUrlResponse, error)
 	DeleteUrl(context.Context, *DeleteUrlRequest) (*DeleteUrlResponse, error)
+	DisableUrl(context.Context, *DisableUrlRequest) (*DisableUrlResponse, error)
+	EnableUrl(context.Context, *EnableUrlRequest) (*EnableUrlResponse, error)
+	RestoreUrl(context.Context, *RestoreUrlRequest) (*RestoreUrlResponse, error)
+	ListUrls(context.Context, *ListUrlsRequest) (*ListUrlsResponse, error)
+	GetUrlInfo(context.Context, *GetUrlInfoRequest) (*GetUrlInfoResponse, error)
+	GetQrCode(context.Context, *GetQrCodeRequest) (*GetQrCodeResponse, error)
+	CreateWebhook(context.Context, *CreateWebhookRequest) (*CreateWebhookResponse, error)
+	ListWebhooks(context.Context, *ListWebhooksRequest) (*ListWebhooksResponse, error)
+	DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error)
+	WatchUrls(*WatchUrlsRequest, UrlShortener_WatchUrlsServer) error
 	mustEmbedUnimplementedUrlShortenerServer()
 }
 
@@ -81,6 +214,36 @@ func (UnimplementedUrlShortenerServer) GetUrl(context.Context, *GetUrlRequest) (
 func (UnimplementedUrlShortenerServer) DeleteUrl(context.Context, *DeleteUrlRequest) (*DeleteUrlResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUrl not implemented")
 }
+func (UnimplementedUrlShortenerServer) DisableUrl(context.Context, *DisableUrlRequest) (*DisableUrlResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableUrl not implemented")
+}
+func (UnimplementedUrlShortenerServer) EnableUrl(context.Context, *EnableUrlRequest) (*EnableUrlResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableUrl not implemented")
+}
+func (UnimplementedUrlShortenerServer) RestoreUrl(context.Context, *RestoreUrlRequest) (*RestoreUrlResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreUrl not implemented")
+}
+func (UnimplementedUrlShortenerServer) ListUrls(context.Context, *ListUrlsRequest) (*ListUrlsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUrls not implemented")
+}
+func (UnimplementedUrlShortenerServer) GetUrlInfo(context.Context, *GetUrlInfoRequest) (*GetUrlInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUrlInfo not implemented")
+}
+func (UnimplementedUrlShortenerServer) GetQrCode(context.Context, *GetQrCodeRequest) (*GetQrCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQrCode not implemented")
+}
+func (UnimplementedUrlShortenerServer) CreateWebhook(context.Context, *CreateWebhookRequest) (*CreateWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhook not implemented")
+}
+func (UnimplementedUrlShortenerServer) ListWebhooks(context.Context, *ListWebhooksRequest) (*ListWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhooks not implemented")
+}
+func (UnimplementedUrlShortenerServer) DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedUrlShortenerServer) WatchUrls(*WatchUrlsRequest, UrlShortener_WatchUrlsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchUrls not implemented")
+}
 func (UnimplementedUrlShortenerServer) mustEmbedUnimplementedUrlShortenerServer() {}
 
 // UnsafeUrlShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -148,6 +311,189 @@ func _UrlShortener_DeleteUrl_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UrlShortener_DisableUrl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableUrlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).DisableUrl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/DisableUrl",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).DisableUrl(ctx, req.(*DisableUrlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_EnableUrl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnableUrlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).EnableUrl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/EnableUrl",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).EnableUrl(ctx, req.(*EnableUrlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_RestoreUrl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreUrlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).RestoreUrl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/RestoreUrl",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).RestoreUrl(ctx, req.(*RestoreUrlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_ListUrls_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUrlsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).ListUrls(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/ListUrls",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).ListUrls(ctx, req.(*ListUrlsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_GetUrlInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUrlInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).GetUrlInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/GetUrlInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).GetUrlInfo(ctx, req.(*GetUrlInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_GetQrCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQrCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).GetQrCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/GetQrCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).GetQrCode(ctx, req.(*GetQrCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_CreateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).CreateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/CreateWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).CreateWebhook(ctx, req.(*CreateWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_ListWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).ListWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/ListWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).ListWebhooks(ctx, req.(*ListWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UrlShortenerServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/urlshortener.UrlShortener/DeleteWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UrlShortenerServer).DeleteWebhook(ctx, req.(*DeleteWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UrlShortener_WatchUrls_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchUrlsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UrlShortenerServer).WatchUrls(m, &urlShortenerWatchUrlsServer{stream})
+}
+
+type UrlShortener_WatchUrlsServer interface {
+	Send(*UrlChange) error
+	grpc.ServerStream
+}
+
+type urlShortenerWatchUrlsServer struct {
+	grpc.ServerStream
+}
+
+func (x *urlShortenerWatchUrlsServer) Send(m *UrlChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // UrlShortener_ServiceDesc is the grpc.ServiceDesc for UrlShortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -167,7 +513,49 @@ var UrlShortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteUrl",
 			Handler:    _UrlShortener_DeleteUrl_Handler,
 		},
+		{
+			MethodName: "DisableUrl",
+			Handler:    _UrlShortener_DisableUrl_Handler,
+		},
+		{
+			MethodName: "EnableUrl",
+			Handler:    _UrlShortener_EnableUrl_Handler,
+		},
+		{
+			MethodName: "RestoreUrl",
+			Handler:    _UrlShortener_RestoreUrl_Handler,
+		},
+		{
+			MethodName: "ListUrls",
+			Handler:    _UrlShortener_ListUrls_Handler,
+		},
+		{
+			MethodName: "GetUrlInfo",
+			Handler:    _UrlShortener_GetUrlInfo_Handler,
+		},
+		{
+			MethodName: "GetQrCode",
+			Handler:    _UrlShortener_GetQrCode_Handler,
+		},
+		{
+			MethodName: "CreateWebhook",
+			Handler:    _UrlShortener_CreateWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhooks",
+			Handler:    _UrlShortener_ListWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _UrlShortener_DeleteWebhook_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchUrls",
+			Handler:       _UrlShortener_WatchUrls_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "protos/proto/url_shortener.proto",
 }
@@ -0,0 +1,72 @@
+package app_test
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/app"
+	"github.com/RVodassa/url-shortener/internal/config"
+	"github.com/RVodassa/url-shortener/internal/handler/grpc"
+	mockService "github.com/RVodassa/url-shortener/internal/service/mock"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/protos/genv1"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGRPCAddr(t *testing.T) {
+	assert.Equal(t, "0.0.0.0:8083", app.GRPCAddr(config.GRPCServer{Host: "0.0.0.0", Port: "8083"}))
+	assert.Equal(t, "localhost:8083", app.GRPCAddr(config.GRPCServer{Host: "localhost", Port: ":8083"}))
+	assert.Equal(t, "[::1]:8083", app.GRPCAddr(config.GRPCServer{Host: "::1", Port: "8083"}))
+}
+
+func TestNewGRPCServerOptions_MessageSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+
+	server := grpc.NewServer(app.NewGRPCServerOptions(config.GRPCServer{
+		MaxRecvMsgSize: 1024,
+		MaxSendMsgSize: 1024,
+	}, nil)...)
+	genv1.RegisterUrlShortenerServer(server, grpchandler.New(mockServiceProvider))
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := genv1.NewUrlShortenerClient(conn)
+	ctx := context.Background()
+
+	// запрос больше max_recv_msg_size не доходит до сервиса
+	_, err = client.SaveUrl(ctx, &genv1.SaveUrlRequest{Url: "http://example.com/" + strings.Repeat("a", 2048)})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// ответ больше max_send_msg_size не отправляется
+	mockServiceProvider.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "alias1").
+		Return(storage.Link{Alias: "alias1", Url: "http://example.com", Notes: strings.Repeat("a", 2048)}, nil)
+	_, err = client.GetUrlInfo(ctx, &genv1.GetUrlInfoRequest{Alias: "alias1"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	mockServiceProvider.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "alias2").
+		Return(storage.Link{Alias: "alias2", Url: "http://example.com"}, nil)
+	resp, err := client.GetUrlInfo(ctx, &genv1.GetUrlInfoRequest{Alias: "alias2"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", resp.Link.Url)
+}
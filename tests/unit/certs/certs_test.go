@@ -0,0 +1,219 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/RVodassa/url-shortener/app"
+	"github.com/RVodassa/url-shortener/internal/config"
+	"github.com/RVodassa/url-shortener/internal/handler/grpc"
+	"github.com/RVodassa/url-shortener/internal/lib/certs"
+	"github.com/RVodassa/url-shortener/internal/lib/principal"
+	mockService "github.com/RVodassa/url-shortener/internal/service/mock"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/protos/genv1"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issuer выпускает тестовые сертификаты.
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &issuer{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue возвращает сертификат и ключ в PEM.
+func (i *issuer) issue(t *testing.T, template *x509.Certificate) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, i.cert, &key.PublicKey, i.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (i *issuer) server(t *testing.T, serial int64) (certPEM, keyPEM []byte) {
+	return i.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// serverSerial возвращает серийный номер сертификата, который получит новое соединение.
+func serverSerial(t *testing.T, r *certs.Reloader) int64 {
+	config, err := r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return cert.SerialNumber.Int64()
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newIssuer(t)
+
+	certPEM, keyPEM := ca.server(t, 2)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	reloader, err := certs.NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), serverSerial(t, reloader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reloader.Watch(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+	// наблюдение начинается не сразу после запуска
+	time.Sleep(100 * time.Millisecond)
+
+	// новый сертификат подхватывается без перезапуска
+	certPEM, keyPEM = ca.server(t, 3)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	assert.Eventually(t, func() bool { return serverSerial(t, reloader) == 3 }, 2*time.Second, 20*time.Millisecond)
+
+	// испорченный файл не заменяет рабочий сертификат
+	writeFile(t, certFile, []byte("not a certificate"))
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int64(3), serverSerial(t, reloader))
+}
+
+func TestNewReloader_Errors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := newIssuer(t).server(t, 2)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	_, err := certs.NewReloader(filepath.Join(dir, "missing.crt"), keyFile, "")
+	assert.Error(t, err)
+
+	badCA := filepath.Join(dir, "ca.crt")
+	writeFile(t, badCA, []byte("not a certificate"))
+	_, err = certs.NewReloader(certFile, keyFile, badCA)
+	assert.EqualError(t, err, "certs.Reload: CA клиентов '"+badCA+"' без сертификатов")
+}
+
+func TestMutualTLS_Principal(t *testing.T) {
+	dir := t.TempDir()
+	ca := newIssuer(t)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.server(t, 2)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, ca.pem)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverTLS, err := app.NewTLSConfig(ctx, config.TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+
+	server := grpc.NewServer(app.NewGRPCServerOptions(config.GRPCServer{}, serverTLS)...)
+	genv1.RegisterUrlShortenerServer(server, grpchandler.New(mockServiceProvider))
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(clientCerts ...tls.Certificate) genv1.UrlShortenerClient {
+		conn, err := grpc.NewClient("passthrough:///localhost",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+				RootCAs:      roots,
+				ServerName:   "localhost",
+				Certificates: clientCerts,
+			})))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		return genv1.NewUrlShortenerClient(conn)
+	}
+
+	spiffeID, err := url.Parse("spiffe://example.org/ns/default/sa/admin")
+	require.NoError(t, err)
+	clientPEM, clientKeyPEM := ca.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "admin-client"},
+		URIs:         []*url.URL{spiffeID},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	require.NoError(t, err)
+
+	// вызывающий доступен сервису через контекст запроса
+	var caller principal.Principal
+	var ok bool
+	mockServiceProvider.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "alias1").
+		DoAndReturn(func(ctx context.Context, domain, alias string) (storage.Link, error) {
+			caller, ok = principal.FromContext(ctx)
+			return storage.Link{Alias: "alias1", Url: "http://example.com"}, nil
+		})
+	_, err = dial(clientCert).GetUrlInfo(context.Background(), &genv1.GetUrlInfoRequest{Alias: "alias1"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "admin-client", caller.CommonName)
+	assert.Equal(t, "spiffe://example.org/ns/default/sa/admin", caller.ID())
+	assert.Equal(t, "10", caller.Serial)
+
+	// без сертификата клиента соединение не устанавливается
+	_, err = dial().GetUrlInfo(context.Background(), &genv1.GetUrlInfoRequest{Alias: "alias1"})
+	assert.Error(t, err)
+}
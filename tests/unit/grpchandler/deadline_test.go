@@ -0,0 +1,100 @@
+package grpchandler_test
+
+import (
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/handler/grpc"
+	mockService "github.com/RVodassa/url-shortener/internal/service/mock"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/protos/genv1"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestDeadlineInterceptor(t *testing.T) {
+	interceptor := grpchandler.DeadlineInterceptor(grpchandler.Deadlines{
+		Default: 4 * time.Second,
+		Methods: map[string]time.Duration{"SaveUrl": 10 * time.Second, "ListUrls": 0},
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		ctx          func() (context.Context, context.CancelFunc)
+		wantDeadline time.Duration // 0 - срока нет
+	}{
+		{
+			name:         "Default",
+			method:       "/url_shortener.UrlShortener/GetUrl",
+			wantDeadline: 4 * time.Second,
+		},
+		{
+			name:         "Method Override",
+			method:       "/url_shortener.UrlShortener/SaveUrl",
+			wantDeadline: 10 * time.Second,
+		},
+		{
+			name:   "Override Disables",
+			method: "/url_shortener.UrlShortener/ListUrls",
+		},
+		{
+			name:   "Earlier Client Deadline",
+			method: "/url_shortener.UrlShortener/SaveUrl",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			wantDeadline: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.Background(), func() {}
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			var deadline time.Time
+			var ok bool
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, req any) (any, error) {
+					deadline, ok = ctx.Deadline()
+					return nil, nil
+				})
+			assert.NoError(t, err)
+
+			if tt.wantDeadline == 0 {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(tt.wantDeadline), deadline, 100*time.Millisecond)
+		})
+	}
+}
+
+func TestGrpcHandler_ExpiredContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	// хранилище вернуло ошибку сети, а не ошибку контекста
+	mockServiceProvider.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "alias1").
+		Return(storage.Link{}, errors.New("i/o timeout"))
+
+	_, err := handler.GetUrlInfo(ctx, &genv1.GetUrlInfoRequest{Alias: "alias1"})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
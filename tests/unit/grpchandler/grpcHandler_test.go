@@ -3,14 +3,19 @@ package grpchandler_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/RVodassa/url-shortener/internal/handler/grpc"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
 	"github.com/RVodassa/url-shortener/internal/service"
 	mockService "github.com/RVodassa/url-shortener/internal/service/mock"
+	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/RVodassa/url-shortener/protos/genv1"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"image/color"
 	"testing"
 )
 
@@ -34,12 +39,23 @@ func TestGrpcHandler_SaveUrl(t *testing.T) {
 			req:  &genv1.SaveUrlRequest{Url: "https://example.com"},
 			mockSaveUrl: func() {
 				mockServiceProvider.EXPECT().
-					SaveUrl(gomock.Any(), "https://example.com").
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com"}).
 					Return("example-alias", nil)
 			},
 			expectedResp: &genv1.SaveUrlResponse{Alias: "example-alias"},
 			expectedErr:  nil,
 		},
+		{
+			name: "Неизвестный домен",
+			req:  &genv1.SaveUrlRequest{Url: "https://example.com", Domain: "unknown.link"},
+			mockSaveUrl: func() {
+				mockServiceProvider.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com", Domain: "unknown.link"}).
+					Return("", service.ErrUnknownDomain)
+			},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrBadDomain.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
 		{
 			name: "Пустой Url",
 			req:  &genv1.SaveUrlRequest{Url: ""},
@@ -54,23 +70,67 @@ func TestGrpcHandler_SaveUrl(t *testing.T) {
 			req:  &genv1.SaveUrlRequest{Url: "invalid-Url"},
 			mockSaveUrl: func() {
 				mockServiceProvider.EXPECT().
-					SaveUrl(gomock.Any(), "invalid-Url").
+					SaveUrl(gomock.Any(), storage.Link{Url: "invalid-Url"}).
 					Return("", service.ErrBadUrl)
 			},
 			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrBadUrl.Error()),
 			expectedErrCode: codes.InvalidArgument,
 		},
+		{
+			name: "Url заблокирован проверкой",
+			req:  &genv1.SaveUrlRequest{Url: "https://evil.com"},
+			mockSaveUrl: func() {
+				mockServiceProvider.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://evil.com"}).
+					Return("", service.ErrMaliciousUrl)
+			},
+			expectedErr:     status.Error(codes.PermissionDenied, grpchandler.ErrMalicious.Error()),
+			expectedErrCode: codes.PermissionDenied,
+		},
+		{
+			name: "Проверка безопасности недоступна",
+			req:  &genv1.SaveUrlRequest{Url: "https://example.com"},
+			mockSaveUrl: func() {
+				mockServiceProvider.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com"}).
+					Return("", service.ErrScanUnavailable)
+			},
+			expectedErr:     status.Error(codes.Unavailable, grpchandler.ErrScanFailed.Error()),
+			expectedErrCode: codes.Unavailable,
+		},
 		{
 			name: "Внутренняя ошибка сервиса",
 			req:  &genv1.SaveUrlRequest{Url: "https://example.com"},
 			mockSaveUrl: func() {
 				mockServiceProvider.EXPECT().
-					SaveUrl(gomock.Any(), "https://example.com").
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com"}).
 					Return("", errors.New("internal error"))
 			},
 			expectedErr:     status.Error(codes.Internal, grpchandler.ErrInternal.Error()),
 			expectedErrCode: codes.Internal,
 		},
+		{
+			name: "Истек срок запроса",
+			req:  &genv1.SaveUrlRequest{Url: "https://example.com"},
+			mockSaveUrl: func() {
+				mockServiceProvider.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com"}).
+					Return("", fmt.Errorf("service.SaveUrl: %w", context.DeadlineExceeded))
+			},
+			expectedErr:     status.Error(codes.DeadlineExceeded, grpchandler.ErrTimeout.Error()),
+			expectedErrCode: codes.DeadlineExceeded,
+		},
+		{
+			name: "Запрос отменен",
+			req:  &genv1.SaveUrlRequest{Url: "https://example.com"},
+			mockSaveUrl: func() {
+				mockServiceProvider.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Url: "https://example.com"}).
+					Return("", fmt.Errorf("service.SaveUrl: %w", context.Canceled))
+			},
+			expectedErr:     status.Error(codes.Canceled, grpchandler.ErrCanceled.Error()),
+			expectedErrCode: codes.Canceled,
+		},
 	}
 
 	for _, tt := range tests {
@@ -114,8 +174,8 @@ func TestGrpcHandler_GetUrl(t *testing.T) {
 			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234"},
 			mockGetUrl: func() {
 				mockServiceProvider.EXPECT().
-					GetUrl(gomock.Any(), "QWERTY1234").
-					Return("https://example.com", nil)
+					GetUrl(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{Url: "https://example.com"}, nil)
 			},
 			expectedResp: &genv1.GetUrlResponse{Url: "https://example.com"},
 			expectedErr:  nil,
@@ -134,19 +194,52 @@ func TestGrpcHandler_GetUrl(t *testing.T) {
 			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234"},
 			mockGetUrl: func() {
 				mockServiceProvider.EXPECT().
-					GetUrl(gomock.Any(), "QWERTY1234").
-					Return("", service.ErrNotFound)
+					GetUrl(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, service.ErrNotFound)
 			},
 			expectedErr:     status.Error(codes.NotFound, grpchandler.ErrNotFound.Error()),
 			expectedErrCode: codes.NotFound,
 		},
+		{
+			name: "Url отключен",
+			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234"},
+			mockGetUrl: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, service.ErrDisabled)
+			},
+			expectedErr:     status.Error(codes.FailedPrecondition, grpchandler.ErrDisabled.Error()),
+			expectedErrCode: codes.FailedPrecondition,
+		},
+		{
+			name: "Пароль передается сервису",
+			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234", Password: "wrong"},
+			mockGetUrl: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "", "QWERTY1234", service.RequestContext{Password: "wrong", Confirmed: true}).
+					Return(storage.Link{}, service.ErrWrongPassword)
+			},
+			expectedErr:     status.Error(codes.PermissionDenied, grpchandler.ErrWrongPass.Error()),
+			expectedErrCode: codes.PermissionDenied,
+		},
+		{
+			name: "Использования исчерпаны",
+			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234"},
+			mockGetUrl: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, service.ErrExhausted)
+			},
+			expectedErr:     status.Error(codes.ResourceExhausted, grpchandler.ErrExhausted.Error()),
+			expectedErrCode: codes.ResourceExhausted,
+		},
 		{
 			name: "Внутренняя ошибка сервиса",
 			req:  &genv1.GetUrlRequest{Alias: "QWERTY1234"},
 			mockGetUrl: func() {
 				mockServiceProvider.EXPECT().
-					GetUrl(gomock.Any(), "QWERTY1234").
-					Return("", errors.New("internal error"))
+					GetUrl(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, errors.New("internal error"))
 			},
 			expectedErr:     status.Error(codes.Internal, grpchandler.ErrInternal.Error()),
 			expectedErrCode: codes.Internal,
@@ -191,7 +284,7 @@ func TestGrpcHandler_DeleteUrl(t *testing.T) {
 			req:  &genv1.DeleteUrlRequest{Alias: "QWERTY1234"},
 			mockDeleteUrl: func() {
 				mockServiceProvider.EXPECT().
-					DeleteUrl(gomock.Any(), "QWERTY1234").
+					DeleteUrl(gomock.Any(), "", "QWERTY1234").
 					Return(nil)
 			},
 			expectedResp: &genv1.DeleteUrlResponse{Status: "OK"},
@@ -210,7 +303,7 @@ func TestGrpcHandler_DeleteUrl(t *testing.T) {
 			req:  &genv1.DeleteUrlRequest{Alias: "QWERTY1234"},
 			mockDeleteUrl: func() {
 				mockServiceProvider.EXPECT().
-					DeleteUrl(gomock.Any(), "QWERTY1234").
+					DeleteUrl(gomock.Any(), "", "QWERTY1234").
 					Return(service.ErrNotFound)
 			},
 			expectedErr:     status.Error(codes.NotFound, grpchandler.ErrNotFound.Error()),
@@ -221,7 +314,7 @@ func TestGrpcHandler_DeleteUrl(t *testing.T) {
 			req:  &genv1.DeleteUrlRequest{Alias: "QWERTY1234"},
 			mockDeleteUrl: func() {
 				mockServiceProvider.EXPECT().
-					DeleteUrl(gomock.Any(), "QWERTY1234").
+					DeleteUrl(gomock.Any(), "", "QWERTY1234").
 					Return(errors.New("internal error"))
 			},
 			expectedErr:     status.Error(codes.Internal, grpchandler.ErrInternal.Error()),
@@ -247,3 +340,313 @@ func TestGrpcHandler_DeleteUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestGrpcHandler_DisableUrl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	tests := []struct {
+		name            string
+		req             *genv1.DisableUrlRequest
+		mockDisableUrl  func()
+		expectedResp    *genv1.DisableUrlResponse
+		expectedErr     error
+		expectedErrCode codes.Code
+	}{
+		{
+			name: "Успешное отключение url",
+			req:  &genv1.DisableUrlRequest{Alias: "QWERTY1234"},
+			mockDisableUrl: func() {
+				mockServiceProvider.EXPECT().
+					DisableUrl(gomock.Any(), "", "QWERTY1234").
+					Return(nil)
+			},
+			expectedResp: &genv1.DisableUrlResponse{Status: "OK"},
+		},
+		{
+			name:            "Пустой alias",
+			req:             &genv1.DisableUrlRequest{Alias: ""},
+			mockDisableUrl:  func() {},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrAliasEmpty.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "Не найден url",
+			req:  &genv1.DisableUrlRequest{Alias: "QWERTY1234"},
+			mockDisableUrl: func() {
+				mockServiceProvider.EXPECT().
+					DisableUrl(gomock.Any(), "", "QWERTY1234").
+					Return(service.ErrNotFound)
+			},
+			expectedErr:     status.Error(codes.NotFound, grpchandler.ErrNotFound.Error()),
+			expectedErrCode: codes.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockDisableUrl != nil {
+				tt.mockDisableUrl()
+			}
+			resp, err := handler.DisableUrl(context.Background(), tt.req)
+
+			if tt.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, tt.expectedErrCode, status.Code(err))
+				assert.Contains(t, err.Error(), tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResp, resp)
+			}
+		})
+	}
+}
+
+func TestGrpcHandler_GetQrCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	noMargin := 0
+
+	tests := []struct {
+		name            string
+		req             *genv1.GetQrCodeRequest
+		mockGetQrCode   func()
+		expectedResp    *genv1.GetQrCodeResponse
+		expectedErr     error
+		expectedErrCode codes.Code
+	}{
+		{
+			name: "Успешное получение QR кода",
+			req:  &genv1.GetQrCodeRequest{Alias: "QWERTY1234", Format: "svg", Margin: -1, Foreground: "#112233"},
+			mockGetQrCode: func() {
+				mockServiceProvider.EXPECT().
+					GetQrCode(gomock.Any(), "", "QWERTY1234", qrcode.Options{
+						Format:     qrcode.FormatSVG,
+						Margin:     &noMargin,
+						Foreground: color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff},
+					}).
+					Return([]byte("<svg/>"), nil)
+			},
+			expectedResp: &genv1.GetQrCodeResponse{Image: []byte("<svg/>"), ContentType: "image/svg+xml"},
+		},
+		{
+			name:            "Пустой alias",
+			req:             &genv1.GetQrCodeRequest{Alias: ""},
+			mockGetQrCode:   func() {},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrAliasEmpty.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
+		{
+			name:            "Невалидный цвет",
+			req:             &genv1.GetQrCodeRequest{Alias: "QWERTY1234", Background: "white"},
+			mockGetQrCode:   func() {},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrBadQr.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "QR коды не настроены",
+			req:  &genv1.GetQrCodeRequest{Alias: "QWERTY1234"},
+			mockGetQrCode: func() {
+				mockServiceProvider.EXPECT().
+					GetQrCode(gomock.Any(), "", "QWERTY1234", gomock.Any()).
+					Return(nil, service.ErrQrUnavailable)
+			},
+			expectedErr:     status.Error(codes.Unimplemented, grpchandler.ErrQrOff.Error()),
+			expectedErrCode: codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockGetQrCode != nil {
+				tt.mockGetQrCode()
+			}
+			resp, err := handler.GetQrCode(context.Background(), tt.req)
+
+			if tt.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, tt.expectedErrCode, status.Code(err))
+				assert.Contains(t, err.Error(), tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResp, resp)
+			}
+		})
+	}
+}
+
+func TestGrpcHandler_CreateWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	tests := []struct {
+		name              string
+		req               *genv1.CreateWebhookRequest
+		mockCreateWebhook func()
+		expectedResp      *genv1.CreateWebhookResponse
+		expectedErr       error
+		expectedErrCode   codes.Code
+	}{
+		{
+			name: "Успешное создание подписки",
+			req:  &genv1.CreateWebhookRequest{Url: "https://cms.example.com/hook", Events: []string{"link.created"}},
+			mockCreateWebhook: func() {
+				mockServiceProvider.EXPECT().
+					CreateWebhook(gomock.Any(), storage.Webhook{
+						Url:    "https://cms.example.com/hook",
+						Events: []string{"link.created"},
+					}).
+					Return(storage.Webhook{
+						ID:     "hook-1",
+						Url:    "https://cms.example.com/hook",
+						Secret: "generated-secret",
+						Events: []string{"link.created"},
+					}, nil)
+			},
+			expectedResp: &genv1.CreateWebhookResponse{Webhook: &genv1.Webhook{
+				Id:     "hook-1",
+				Url:    "https://cms.example.com/hook",
+				Secret: "generated-secret",
+				Events: []string{"link.created"},
+			}},
+		},
+		{
+			name:            "Пустой url",
+			req:             &genv1.CreateWebhookRequest{},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrUrlEmpty.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "Невалидная подписка",
+			req:  &genv1.CreateWebhookRequest{Url: "https://cms.example.com/hook", Events: []string{"link.clicked"}},
+			mockCreateWebhook: func() {
+				mockServiceProvider.EXPECT().
+					CreateWebhook(gomock.Any(), gomock.Any()).
+					Return(storage.Webhook{}, service.ErrBadWebhook)
+			},
+			expectedErr:     status.Error(codes.InvalidArgument, grpchandler.ErrBadHook.Error()),
+			expectedErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "Хранилище без подписок",
+			req:  &genv1.CreateWebhookRequest{Url: "https://cms.example.com/hook"},
+			mockCreateWebhook: func() {
+				mockServiceProvider.EXPECT().
+					CreateWebhook(gomock.Any(), gomock.Any()).
+					Return(storage.Webhook{}, service.ErrWebhooksUnavailable)
+			},
+			expectedErr:     status.Error(codes.Unimplemented, grpchandler.ErrHooksOff.Error()),
+			expectedErrCode: codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockCreateWebhook != nil {
+				tt.mockCreateWebhook()
+			}
+			resp, err := handler.CreateWebhook(context.Background(), tt.req)
+
+			if tt.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, tt.expectedErrCode, status.Code(err))
+				assert.Contains(t, err.Error(), tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResp.Webhook.Id, resp.Webhook.Id)
+				assert.Equal(t, tt.expectedResp.Webhook.Secret, resp.Webhook.Secret)
+				assert.Equal(t, tt.expectedResp.Webhook.Events, resp.Webhook.Events)
+			}
+		})
+	}
+}
+
+func TestGrpcHandler_DeleteWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	_, err := handler.DeleteWebhook(context.Background(), &genv1.DeleteWebhookRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockServiceProvider.EXPECT().DeleteWebhook(gomock.Any(), "hook-1").Return(service.ErrNotFound)
+	_, err = handler.DeleteWebhook(context.Background(), &genv1.DeleteWebhookRequest{Id: "hook-1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	mockServiceProvider.EXPECT().DeleteWebhook(gomock.Any(), "hook-2").Return(nil)
+	resp, err := handler.DeleteWebhook(context.Background(), &genv1.DeleteWebhookRequest{Id: "hook-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", resp.Status)
+}
+
+// fakeWatchStream собирает отправленные изменения.
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*genv1.UrlChange
+}
+
+func (f *fakeWatchStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeWatchStream) Send(change *genv1.UrlChange) error {
+	f.sent = append(f.sent, change)
+	return nil
+}
+
+func TestGrpcHandler_WatchUrls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := grpchandler.New(mockServiceProvider)
+
+	t.Run("изменения передаются в поток", func(t *testing.T) {
+		stream := &fakeWatchStream{ctx: context.Background()}
+		mockServiceProvider.EXPECT().
+			WatchUrls(gomock.Any(), "41-7", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, send func(storage.Change) error) error {
+				return send(storage.Change{Offset: "41-8", Op: storage.ChangeInsert, Alias: "QWERTY1234",
+					Status: storage.StatusActive, Url: "https://example.com"})
+			})
+
+		err := handler.WatchUrls(&genv1.WatchUrlsRequest{Offset: "41-7"}, stream)
+		assert.NoError(t, err)
+		if assert.Len(t, stream.sent, 1) {
+			assert.Equal(t, "41-8", stream.sent[0].Offset)
+			assert.Equal(t, "insert", stream.sent[0].Op)
+			assert.Equal(t, "active", stream.sent[0].Status)
+		}
+	})
+
+	t.Run("невалидная позиция", func(t *testing.T) {
+		stream := &fakeWatchStream{ctx: context.Background()}
+		mockServiceProvider.EXPECT().WatchUrls(gomock.Any(), "bad", gomock.Any()).Return(service.ErrBadOffset)
+
+		err := handler.WatchUrls(&genv1.WatchUrlsRequest{Offset: "bad"}, stream)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("клиент отключился", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stream := &fakeWatchStream{ctx: ctx}
+		mockServiceProvider.EXPECT().WatchUrls(gomock.Any(), "", gomock.Any()).Return(context.Canceled)
+
+		err := handler.WatchUrls(&genv1.WatchUrlsRequest{}, stream)
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
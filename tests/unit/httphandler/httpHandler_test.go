@@ -0,0 +1,482 @@
+package httphandler_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	httphandler "github.com/RVodassa/url-shortener/internal/handler/http"
+	"github.com/RVodassa/url-shortener/internal/lib/principal"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	"github.com/RVodassa/url-shortener/internal/service"
+	mockService "github.com/RVodassa/url-shortener/internal/service/mock"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHttpHandler_Redirect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	tests := []struct {
+		name         string
+		host         string
+		mock         func()
+		expectedCode int
+		expectedUrl  string
+	}{
+		{
+			name: "Переход, домен из Host без порта",
+			host: "brand.link:8080",
+			mock: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{Url: "https://example.com"}, nil)
+			},
+			expectedCode: http.StatusFound,
+			expectedUrl:  "https://example.com",
+		},
+		{
+			name: "Неизвестный домен",
+			host: "unknown.link",
+			mock: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "unknown.link", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, service.ErrUnknownDomain)
+			},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "Ссылка отключена",
+			host: "brand.link",
+			mock: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, service.ErrDisabled)
+			},
+			expectedCode: http.StatusGone,
+		},
+		{
+			name: "Внутренняя ошибка",
+			host: "brand.link",
+			mock: func() {
+				mockServiceProvider.EXPECT().
+					GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+					Return(storage.Link{}, errors.New("internal error"))
+			},
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+
+			req := httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Equal(t, tt.expectedUrl, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHttpHandler_RedirectRequestContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	handler := httphandler.New(mockServiceProvider)
+	handler.TrustForwarded = true
+	routes := handler.Routes()
+
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", service.RequestContext{
+			UserAgent:      "Mozilla/5.0 (iPhone)",
+			AcceptLanguage: "ru-RU,ru;q=0.9",
+			ClientIP:       netip.MustParseAddr("203.0.113.7"),
+			Query:          url.Values{"utm_source": {"mail"}},
+			VisitorID:      "visitor-1",
+		}).
+		Return(storage.Link{Url: "https://apps.apple.com/app"}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234?utm_source=mail", nil)
+	req.Host = "brand.link"
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone)")
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	req.AddCookie(&http.Cookie{Name: "vid", Value: "visitor-1"})
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://apps.apple.com/app", rec.Header().Get("Location"))
+	// посетитель уже известен, cookie не перевыдается
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestHttpHandler_RedirectVisitorCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	var visitorID string
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			visitorID = rc.VisitorID
+			return storage.Link{
+				Url:          "https://example.com/b",
+				Destinations: []storage.Destination{{Url: "https://example.com/a", Weight: 1}, {Url: "https://example.com/b", Weight: 1}},
+			}, nil
+		})
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "ASDFGH5678", gomock.Any()).
+		Return(storage.Link{Url: "https://example.com"}, nil)
+
+	// ссылке с вариантами выдается cookie с идентификатором, по которому выбран вариант
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "vid", cookies[0].Name)
+		assert.NotEmpty(t, visitorID)
+		assert.Equal(t, visitorID, cookies[0].Value)
+	}
+
+	// обычной ссылке cookie не нужна
+	req = httptest.NewRequest(http.MethodGet, "/ASDFGH5678", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestHttpHandler_RedirectPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	// без пароля показывается форма
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(storage.Link{}, service.ErrPasswordNeeded)
+
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), `name="password"`)
+
+	// пароль из формы передается сервису, переход после формы - 303
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.Equal(t, "secret", rc.Password)
+			return storage.Link{Url: "https://example.com/doc.pdf"}, nil
+		})
+
+	req = httptest.NewRequest(http.MethodPost, "/QWERTY1234", strings.NewReader("password=secret"))
+	req.Host = "brand.link"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "https://example.com/doc.pdf", rec.Header().Get("Location"))
+
+	// исчерпанная ссылка
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(storage.Link{}, service.ErrExhausted)
+
+	req = httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
+func TestHttpHandler_QrCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	margin := 0
+	mockServiceProvider.EXPECT().
+		GetQrCode(gomock.Any(), "brand.link", "QWERTY1234", qrcode.Options{
+			Format:     qrcode.FormatSVG,
+			Size:       512,
+			Level:      "H",
+			Margin:     &margin,
+			Foreground: color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff},
+		}).
+		Return([]byte("<svg/>"), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234/qr?format=svg&size=512&level=H&margin=0&fg=112233", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.NotEmpty(t, rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "<svg/>", rec.Body.String())
+
+	// неразборчивые параметры отклоняются без обращения к сервису
+	for _, query := range []string{"size=big", "margin=x", "fg=red"} {
+		req = httptest.NewRequest(http.MethodGet, "/QWERTY1234/qr?"+query, nil)
+		req.Host = "brand.link"
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	mockServiceProvider.EXPECT().
+		GetQrCode(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(nil, service.ErrNotFound)
+
+	req = httptest.NewRequest(http.MethodGet, "/QWERTY1234/qr", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHttpHandler_RedirectPreview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	link := storage.Link{
+		Url:  "https://example.com/article",
+		Page: storage.Page{Title: "Статья <b>", SiteName: "Example"},
+	}
+
+	// /{alias}+ запрашивает предпросмотр
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.True(t, rc.Preview)
+			return link, nil
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234+", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "https://example.com/article")
+	assert.Contains(t, body, "Статья &lt;b&gt;")
+	assert.Contains(t, body, `action="/QWERTY1234"`)
+	assert.Contains(t, body, `name="confirm"`)
+
+	// ссылка с флагом предпросмотра без подтверждения
+	link.Preview = true
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(link, nil)
+
+	req = httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "https://example.com/article")
+
+	// подтверждение со страницы предпросмотра
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.True(t, rc.Confirmed)
+			assert.False(t, rc.Preview)
+			return link, nil
+		})
+
+	req = httptest.NewRequest(http.MethodPost, "/QWERTY1234", strings.NewReader("confirm=1"))
+	req.Host = "brand.link"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "https://example.com/article", rec.Header().Get("Location"))
+}
+
+func TestHttpHandler_RedirectPreviewProtected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	// пароль принят, но переход еще не подтвержден; у ссылки с ограничением сервис не отдает Url
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.Equal(t, "secret-password", rc.Password)
+			return storage.Link{Preview: true, PasswordHash: "hash", MaxUses: 1, UsesLeft: 1}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodPost, "/QWERTY1234", strings.NewReader("password=secret-password"))
+	req.Host = "brand.link"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	// введенный пароль не возвращается в страницу, при подтверждении он вводится снова
+	assert.NotContains(t, body, "secret-password")
+	assert.Contains(t, body, `<input type="password" name="password"`)
+	assert.NotContains(t, body, "<code>")
+}
+
+func TestHttpHandler_RedirectPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	// путь после alias передается экранированным
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.Equal(t, "/guide/intro%20page", rc.Path)
+			assert.Equal(t, url.Values{"utm_source": {"mail"}}, rc.Query)
+			return storage.Link{Url: "https://example.com/docs/guide/intro%20page?utm_source=mail"}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/QWERTY1234/guide/intro%20page?utm_source=mail", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/docs/guide/intro%20page?utm_source=mail", rec.Header().Get("Location"))
+
+	// подтверждение предпросмотра уходит на тот же путь и query
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(storage.Link{Url: "https://example.com/docs/guide", Preview: true}, nil)
+
+	req = httptest.NewRequest(http.MethodGet, "/QWERTY1234+/guide?utm_source=mail", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `action="/QWERTY1234/guide?utm_source=mail"`)
+
+	// путь, которого у ссылки нет
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		Return(storage.Link{}, service.ErrNotFound)
+
+	req = httptest.NewRequest(http.MethodGet, "/QWERTY1234/other", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHttpHandler_RedirectTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "docs", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _ string, rc service.RequestContext) (storage.Link, error) {
+			assert.Equal(t, "/v2.1", rc.Path)
+			return storage.Link{Url: "https://example.com/docs/v2.1", Template: true}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/v2.1", nil)
+	req.Host = "brand.link"
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/docs/v2.1", rec.Header().Get("Location"))
+
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "docs", gomock.Any()).
+		Return(storage.Link{}, service.ErrBadTemplateValue)
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/v2.1%3Fx", nil)
+	req.Host = "brand.link"
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHttpHandler_Principal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockServiceProvider := mockService.NewMockServiceProvider(ctrl)
+	routes := httphandler.New(mockServiceProvider).Routes()
+
+	var callers []string
+	mockServiceProvider.EXPECT().
+		GetUrl(gomock.Any(), "brand.link", "QWERTY1234", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, domain, alias string, rc service.RequestContext) (storage.Link, error) {
+			caller, _ := principal.FromContext(ctx)
+			callers = append(callers, caller.ID())
+			return storage.Link{Url: "https://example.com"}, nil
+		}).
+		Times(3)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "admin-client"}, SerialNumber: big.NewInt(10)}
+	for _, state := range []*tls.ConnectionState{
+		nil, // без TLS
+		{},  // сертификат клиента не передан
+		{VerifiedChains: [][]*x509.Certificate{{cert}}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/QWERTY1234", nil)
+		req.Host = "brand.link"
+		req.TLS = state
+		routes.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []string{"", "", "admin-client"}, callers)
+}
@@ -0,0 +1,233 @@
+package janitor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/janitor"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePurger отдает заранее заданные пачки и запоминает фильтры.
+type fakePurger struct {
+	batches  [][]storage.Key
+	filters  []storage.PurgeFilter
+	deleted  int64
+	retained time.Duration
+	err      error
+}
+
+func (f *fakePurger) PurgeStale(ctx context.Context, filter storage.PurgeFilter) ([]storage.Key, error) {
+	f.filters = append(f.filters, filter)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.batches) == 0 {
+		return nil, nil
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	return batch, nil
+}
+
+func (f *fakePurger) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	f.retained = retention
+	return f.deleted, nil
+}
+
+// fakeLocker выдает блокировку, только если она свободна.
+type fakeLocker struct {
+	held     bool
+	unlocked int
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	if l.held {
+		return nil, false, nil
+	}
+	l.held = true
+	return func() {
+		l.held = false
+		l.unlocked++
+	}, true, nil
+}
+
+func TestJanitor_RunOnce(t *testing.T) {
+	purger := &fakePurger{
+		// истекшие: полная пачка и остаток; неиспользуемые: одна неполная пачка
+		batches: [][]storage.Key{{{Alias: "a"}, {Alias: "b"}}, {{Alias: "c"}}, {{Alias: "d"}}},
+		deleted: 4,
+	}
+	j := janitor.New(purger, nil, janitor.Config{
+		BatchSize:        2,
+		StaleAfter:       24 * time.Hour,
+		DeletedRetention: time.Hour,
+	})
+
+	report, err := j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, janitor.Report{Expired: 3, Stale: 1, Deleted: 4}, report)
+	assert.Equal(t, time.Hour, purger.retained)
+
+	assert.Len(t, purger.filters, 3)
+	for _, filter := range purger.filters {
+		assert.Equal(t, 2, filter.Limit)
+		assert.False(t, filter.DryRun)
+	}
+	assert.False(t, purger.filters[0].ExpiredBefore.IsZero())
+	assert.True(t, purger.filters[2].ExpiredBefore.IsZero())
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), purger.filters[2].NotAccessedSince, time.Minute)
+}
+
+func TestJanitor_RunOnce_DryRun(t *testing.T) {
+	purger := &fakePurger{
+		batches: [][]storage.Key{{{Alias: "a"}, {Alias: "b"}}, {{Alias: "c"}, {Alias: "d"}}},
+		deleted: 4,
+	}
+	j := janitor.New(purger, nil, janitor.Config{BatchSize: 2, DryRun: true, DeletedRetention: time.Hour})
+
+	// подсчитываются все пачки, каждая следующая со сдвигом; мягко удаленные не трогаются
+	report, err := j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, janitor.Report{Expired: 4}, report)
+	assert.Len(t, purger.filters, 3)
+	for i, filter := range purger.filters {
+		assert.True(t, filter.DryRun)
+		assert.Equal(t, 2*i, filter.Offset)
+	}
+	assert.Zero(t, purger.retained)
+}
+
+func TestJanitor_RunOnce_Locked(t *testing.T) {
+	purger := &fakePurger{}
+	locker := &fakeLocker{held: true}
+	j := janitor.New(purger, locker, janitor.Config{BatchSize: 2})
+
+	// блокировку держит другая реплика
+	report, err := j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, report.Skipped)
+	assert.Empty(t, purger.filters)
+
+	locker.held = false
+	report, err = j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, report.Skipped)
+	assert.Len(t, purger.filters, 1)
+	assert.Equal(t, 1, locker.unlocked)
+	assert.False(t, locker.held)
+}
+
+func TestJanitor_RunOnce_Error(t *testing.T) {
+	purger := &fakePurger{err: errors.New("internal error")}
+	locker := &fakeLocker{}
+	j := janitor.New(purger, locker, janitor.Config{BatchSize: 2, DeletedRetention: time.Hour})
+
+	_, err := j.RunOnce(context.Background())
+	assert.EqualError(t, err, "internal error")
+	assert.Zero(t, purger.retained)
+	// блокировка снимается и при ошибке
+	assert.False(t, locker.held)
+}
+
+func TestJanitor_Run_StopsOnCancel(t *testing.T) {
+	purger := &fakePurger{}
+	j := janitor.New(purger, nil, janitor.Config{Interval: time.Millisecond, BatchSize: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run не остановился после отмены контекста")
+	}
+}
+
+// fakeChangePurger очищает еще и журнал изменений.
+type fakeChangePurger struct {
+	fakePurger
+	changes         int64
+	changeRetention time.Duration
+}
+
+func (f *fakeChangePurger) PurgeChanges(ctx context.Context, retention time.Duration) (int64, error) {
+	f.changeRetention = retention
+	return f.changes, nil
+}
+
+func TestJanitor_RunOnce_Changes(t *testing.T) {
+	purger := &fakeChangePurger{changes: 7}
+	j := janitor.New(purger, nil, janitor.Config{BatchSize: 2, ChangeRetention: 48 * time.Hour})
+
+	report, err := j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, janitor.Report{Changes: 7}, report)
+	assert.Equal(t, 48*time.Hour, purger.changeRetention)
+
+	// в пробном режиме журнал не очищается
+	purger = &fakeChangePurger{changes: 7}
+	j = janitor.New(purger, nil, janitor.Config{BatchSize: 2, DryRun: true, ChangeRetention: 48 * time.Hour})
+
+	report, err = j.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, report.Changes)
+	assert.Zero(t, purger.changeRetention)
+}
+
+// syncBuffer буфер лога, который безопасно читать во время записи.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestJanitor_Run_LogsChanges(t *testing.T) {
+	out := &syncBuffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	// проход, очистивший только журнал изменений, тоже попадает в лог
+	purger := &fakeChangePurger{changes: 7}
+	j := janitor.New(purger, nil, janitor.Config{Interval: time.Millisecond, BatchSize: 2, ChangeRetention: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "записей журнала: 7")
+	}, time.Second, 5*time.Millisecond)
+}
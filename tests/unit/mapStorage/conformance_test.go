@@ -0,0 +1,14 @@
+package mapStorage_test
+
+import (
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/mapStorage"
+	"github.com/RVodassa/url-shortener/internal/storage/storagetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return mapStorage.New()
+	})
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/RVodassa/url-shortener/internal/storage/inMemory/mapStorage"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,6 +40,12 @@ func TestMapStorage_SaveUrl(t *testing.T) {
 			url:         "",
 			expectedErr: storage.ErrUrlIsEmpty,
 		},
+		{
+			name:        "слишком длинный URL",
+			alias:       "long-alias",
+			url:         "http://google.com/" + strings.Repeat("a", storage.MaxUrlLength),
+			expectedErr: storage.ErrUrlTooLong,
+		},
 		{
 			name:        "алиас уже существует",
 			alias:       "existing-alias",
@@ -52,7 +62,7 @@ func TestMapStorage_SaveUrl(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mapStore.SaveUrl(context.Background(), tt.alias, tt.url)
+			err := mapStore.SaveUrl(context.Background(), storage.Link{Alias: tt.alias, Url: tt.url})
 			assert.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -60,7 +70,7 @@ func TestMapStorage_SaveUrl(t *testing.T) {
 
 func TestMapStorage_GetUrl(t *testing.T) {
 	mapStore := mapStorage.New()
-	err := mapStore.SaveUrl(context.Background(), "example-alias", "http://google.com")
+	err := mapStore.SaveUrl(context.Background(), storage.Link{Alias: "example-alias", Url: "http://google.com"})
 	if err != nil {
 		t.Errorf("error saving url %v", err)
 		return
@@ -92,11 +102,11 @@ func TestMapStorage_GetUrl(t *testing.T) {
 		},
 	}
 
-	var url string
+	var link storage.Link
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			url, err = mapStore.GetUrl(context.Background(), tt.alias)
-			assert.Equal(t, tt.expectedUrl, url)
+			link, err = mapStore.GetUrl(context.Background(), "", tt.alias)
+			assert.Equal(t, tt.expectedUrl, link.Url)
 			assert.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -104,7 +114,7 @@ func TestMapStorage_GetUrl(t *testing.T) {
 
 func TestMapStorage_DeleteUrl(t *testing.T) {
 	mapStore := mapStorage.New()
-	err := mapStore.SaveUrl(context.Background(), "example-alias", "http://google.com")
+	err := mapStore.SaveUrl(context.Background(), storage.Link{Alias: "example-alias", Url: "http://google.com"})
 	if err != nil {
 		t.Errorf("error saving url %v", err)
 		return
@@ -134,8 +144,266 @@ func TestMapStorage_DeleteUrl(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err = mapStore.DeleteUrl(context.Background(), tt.alias)
+			err = mapStore.DeleteUrl(context.Background(), "", tt.alias)
 			assert.Equal(t, tt.expectedErr, err)
 		})
 	}
 }
+
+func TestMapStorage_Status(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	err := mapStore.SaveUrl(ctx, storage.Link{Alias: "example-alias", Url: "http://google.com"})
+	if err != nil {
+		t.Errorf("error saving url %v", err)
+		return
+	}
+
+	// отключение
+	assert.NoError(t, mapStore.DisableUrl(ctx, "", "example-alias"))
+	assert.Equal(t, storage.ErrUnchanged, mapStore.DisableUrl(ctx, "", "example-alias"))
+	_, err = mapStore.GetUrl(ctx, "", "example-alias")
+	assert.Equal(t, storage.ErrDisabled, err)
+
+	// включение
+	assert.NoError(t, mapStore.EnableUrl(ctx, "", "example-alias"))
+	link, err := mapStore.GetUrl(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://google.com", link.Url)
+
+	// восстановить можно только удаленную ссылку
+	assert.Equal(t, storage.ErrNotFound, mapStore.RestoreUrl(ctx, "", "example-alias"))
+
+	// мягкое удаление резервирует alias
+	assert.NoError(t, mapStore.DeleteUrl(ctx, "", "example-alias"))
+	_, err = mapStore.GetUrl(ctx, "", "example-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+	assert.Equal(t, storage.ErrNotFound, mapStore.DeleteUrl(ctx, "", "example-alias"))
+	assert.Equal(t, storage.ErrNotFound, mapStore.DisableUrl(ctx, "", "example-alias"))
+	assert.Equal(t, storage.ErrExistAlias, mapStore.SaveUrl(ctx, storage.Link{Alias: "example-alias", Url: "http://another-url.com"}))
+
+	// восстановление
+	assert.NoError(t, mapStore.RestoreUrl(ctx, "", "example-alias"))
+	link, err = mapStore.GetUrl(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://google.com", link.Url)
+
+	// несуществующий alias
+	assert.Equal(t, storage.ErrNotFound, mapStore.EnableUrl(ctx, "", "nonexistent-alias"))
+	assert.Equal(t, storage.ErrAliasIsEmpty, mapStore.DisableUrl(ctx, "", ""))
+}
+
+func TestMapStorage_PurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "deleted-alias", Url: "http://google.com"}))
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "active-alias", Url: "http://google.com"}))
+	assert.NoError(t, mapStore.DeleteUrl(ctx, "", "deleted-alias"))
+
+	// срок хранения еще не истек
+	purged, err := mapStore.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	purged, err = mapStore.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	// после очистки alias свободен
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "deleted-alias", Url: "http://another-url.com"}))
+	_, err = mapStore.GetUrl(ctx, "", "active-alias")
+	assert.NoError(t, err)
+}
+
+func TestMapStorage_ListUrls(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	links := []storage.Link{
+		{Alias: "a1", Url: "http://a.com", Title: "A", Tags: []string{"docs"}},
+		{Alias: "a2", Url: "http://b.com", Tags: []string{"promo"}},
+		{Alias: "a3", Url: "http://c.com", Tags: []string{"docs", "promo"}},
+		{Alias: "a4", Url: "http://d.com", Tags: []string{"docs"}},
+	}
+	for _, link := range links {
+		assert.NoError(t, mapStore.SaveUrl(ctx, link))
+	}
+	assert.NoError(t, mapStore.DeleteUrl(ctx, "", "a4"))
+
+	tests := []struct {
+		name    string
+		filter  storage.ListFilter
+		aliases []string
+	}{
+		{name: "без фильтра", filter: storage.ListFilter{}, aliases: []string{"a1", "a2", "a3"}},
+		{name: "по тегу", filter: storage.ListFilter{Tag: "docs"}, aliases: []string{"a1", "a3"}},
+		{name: "limit", filter: storage.ListFilter{Limit: 2}, aliases: []string{"a1", "a2"}},
+		{name: "offset", filter: storage.ListFilter{Offset: 1, Limit: 1}, aliases: []string{"a2"}},
+		{name: "offset за пределами", filter: storage.ListFilter{Offset: 10}, aliases: nil},
+		{name: "неизвестный тег", filter: storage.ListFilter{Tag: "none"}, aliases: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mapStore.ListUrls(ctx, tt.filter)
+			assert.NoError(t, err)
+
+			var aliases []string
+			for _, link := range got {
+				aliases = append(aliases, link.Alias)
+			}
+			assert.Equal(t, tt.aliases, aliases)
+		})
+	}
+
+	got, err := mapStore.GetUrl(ctx, "", "a1")
+	assert.NoError(t, err)
+	assert.Equal(t, "A", got.Title)
+	assert.Equal(t, []string{"docs"}, got.Tags)
+}
+
+func TestMapStorage_Timestamps(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	before := time.Now()
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "example-alias", Url: "http://google.com"}))
+
+	info, err := mapStore.GetUrlInfo(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.False(t, info.CreatedAt.Before(before))
+	assert.Equal(t, info.CreatedAt, info.UpdatedAt)
+	assert.True(t, info.LastAccessedAt.IsZero())
+
+	// обновляется только более позднее время обращения
+	accessed := time.Now().Add(time.Minute)
+	assert.NoError(t, mapStore.TouchUrls(ctx, map[storage.Key]storage.Access{{Alias: "example-alias"}: {At: accessed}, {Alias: "nonexistent-alias"}: {At: accessed}}))
+	assert.NoError(t, mapStore.TouchUrls(ctx, map[storage.Key]storage.Access{{Alias: "example-alias"}: {At: accessed.Add(-time.Hour)}}))
+
+	info, err = mapStore.GetUrlInfo(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.True(t, accessed.Equal(info.LastAccessedAt))
+
+	// смена статуса обновляет updated_at, удаленная ссылка доступна через GetUrlInfo
+	assert.NoError(t, mapStore.DeleteUrl(ctx, "", "example-alias"))
+	info, err = mapStore.GetUrlInfo(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, storage.StatusDeleted, info.Status)
+	assert.True(t, info.UpdatedAt.After(info.CreatedAt) || info.UpdatedAt.Equal(info.CreatedAt))
+
+	_, err = mapStore.GetUrlInfo(ctx, "", "nonexistent-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+}
+
+func TestMapStorage_PurgeStale(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	now := time.Now()
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "expired-alias", Url: "http://google.com", ExpiresAt: now.Add(-time.Minute)}))
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "future-alias", Url: "http://google.com", ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "used-alias", Url: "http://google.com"}))
+	assert.NoError(t, mapStore.TouchUrls(ctx, map[storage.Key]storage.Access{{Alias: "used-alias"}: {At: now.Add(time.Minute)}}))
+
+	// истекшая ссылка не отдается и до очистки
+	_, err := mapStore.GetUrl(ctx, "", "expired-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+
+	// пробный режим ничего не удаляет
+	aliases, err := mapStore.PurgeStale(ctx, storage.PurgeFilter{ExpiredBefore: now, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired-alias"}}, aliases)
+
+	aliases, err = mapStore.PurgeStale(ctx, storage.PurgeFilter{ExpiredBefore: now})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "expired-alias"}}, aliases)
+	_, err = mapStore.GetUrlInfo(ctx, "", "expired-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+
+	// без обращений считается от создания; пачка ограничена Limit
+	aliases, err = mapStore.PurgeStale(ctx, storage.PurgeFilter{NotAccessedSince: now.Add(time.Second), Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Key{{Alias: "future-alias"}}, aliases)
+
+	_, err = mapStore.GetUrl(ctx, "", "used-alias")
+	assert.NoError(t, err)
+}
+
+func TestMapStorage_Domains(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+
+	// один alias в разных доменах
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "example-alias", Url: "http://google.com"}))
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Domain: "brand.link", Alias: "example-alias", Url: "http://yandex.ru"}))
+	assert.Equal(t, storage.ErrExistAlias, mapStore.SaveUrl(ctx, storage.Link{Domain: "brand.link", Alias: "example-alias", Url: "http://yandex.ru"}))
+
+	link, err := mapStore.GetUrl(ctx, "brand.link", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://yandex.ru", link.Url)
+	assert.Equal(t, "brand.link", link.Domain)
+
+	assert.NoError(t, mapStore.DeleteUrl(ctx, "brand.link", "example-alias"))
+	_, err = mapStore.GetUrl(ctx, "brand.link", "example-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+
+	link, err = mapStore.GetUrl(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://google.com", link.Url)
+}
+
+func TestMapStorage_DestinationClicks(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{
+		Alias: "example-alias",
+		Url:   "http://google.com",
+		Destinations: []storage.Destination{
+			{Url: "http://google.com/a", Weight: 1},
+			{Url: "http://google.com/b", Weight: 1},
+		},
+	}))
+
+	now := time.Now()
+	assert.NoError(t, mapStore.TouchUrls(ctx, map[storage.Key]storage.Access{
+		{Alias: "example-alias"}: {At: now, Clicks: map[int]int64{0: 2, 1: 1, 5: 1}},
+	}))
+	assert.NoError(t, mapStore.TouchUrls(ctx, map[storage.Key]storage.Access{
+		{Alias: "example-alias"}: {At: now, Clicks: map[int]int64{1: 3}},
+	}))
+
+	// несуществующий вариант пропускается
+	info, err := mapStore.GetUrlInfo(ctx, "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), info.Destinations[0].Clicks)
+	assert.Equal(t, int64(4), info.Destinations[1].Clicks)
+}
+
+func TestMapStorage_UseUrl(t *testing.T) {
+	ctx := context.Background()
+	mapStore := mapStorage.New()
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "limited-alias", Url: "http://google.com", MaxUses: 5, UsesLeft: 5}))
+	assert.NoError(t, mapStore.SaveUrl(ctx, storage.Link{Alias: "unlimited-alias", Url: "http://google.com"}))
+
+	// параллельные переходы не тратят больше использований, чем было
+	var wg sync.WaitGroup
+	var used atomic.Int64
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mapStore.UseUrl(ctx, "", "limited-alias"); err == nil {
+				used.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(5), used.Load())
+
+	_, err := mapStore.UseUrl(ctx, "", "limited-alias")
+	assert.Equal(t, storage.ErrExhausted, err)
+
+	left, err := mapStore.UseUrl(ctx, "", "unlimited-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), left)
+
+	_, err = mapStore.UseUrl(ctx, "", "nonexistent-alias")
+	assert.Equal(t, storage.ErrNotFound, err)
+}
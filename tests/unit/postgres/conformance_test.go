@@ -0,0 +1,32 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
+	"github.com/RVodassa/url-shortener/internal/storage/storagetest"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestConformance прогоняет общие проверки хранилища на базе из testDSN.
+// Перед каждой проверкой таблицы ссылок и подписок очищаются.
+func TestConformance(t *testing.T) {
+	dsn := testDSN(t)
+	if err := newMigrate(t, dsn).Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		require.NoError(t, err)
+	}
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		ctx := context.Background()
+		pool, err := pgxpool.New(ctx, dsn)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		_, err = pool.Exec(ctx, "TRUNCATE urls, outbox, webhooks, webhook_deliveries, webhook_offset")
+		require.NoError(t, err)
+		return postgres.New(pool)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -94,3 +95,57 @@ func TestGetDBConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestDSN(t *testing.T) {
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_PORT", "5433")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "password")
+	t.Setenv("DB_NAME", "appdb")
+	t.Setenv("DB_SSL", "")
+
+	dsn, err := postgres.DSN()
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://user:password@db:5433/appdb?sslmode=disable", dsn)
+
+	t.Setenv("DB_NAME", "")
+	_, err = postgres.DSN()
+	assert.EqualError(t, err, "postgres.DSN: пустой DB_NAME")
+}
+
+func TestConfig_WithTLS(t *testing.T) {
+	cfg := postgres.Config{SSLMode: "verify-full", SSLRootCert: "/etc/ssl/ca.pem"}
+
+	got, err := cfg.WithTLS("postgres://user:password@db:5432/appdb?sslmode=disable")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://user:password@db:5432/appdb?sslmode=verify-full&sslrootcert=%2Fetc%2Fssl%2Fca.pem", got)
+
+	got, err = cfg.WithTLS("host=replica dbname=appdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "host=replica dbname=appdb sslmode='verify-full' sslrootcert='/etc/ssl/ca.pem'", got)
+
+	got, err = postgres.Config{}.WithTLS("postgres://db/appdb?sslmode=require")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://db/appdb?sslmode=require", got)
+}
+
+func TestConfig_PoolConfig(t *testing.T) {
+	cfg := postgres.Config{
+		MaxConns:         20,
+		MinConns:         2,
+		MaxConnLifetime:  time.Hour,
+		MaxConnIdleTime:  time.Minute,
+		StatementTimeout: 1500 * time.Millisecond,
+	}
+
+	poolConfig, err := cfg.PoolConfig("postgres://user:password@db:5432/appdb?sslmode=disable")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), poolConfig.MaxConns)
+	assert.Equal(t, int32(2), poolConfig.MinConns)
+	assert.Equal(t, time.Hour, poolConfig.MaxConnLifetime)
+	assert.Equal(t, time.Minute, poolConfig.MaxConnIdleTime)
+	assert.Equal(t, "1500", poolConfig.ConnConfig.RuntimeParams["statement_timeout"])
+
+	_, err = cfg.PoolConfig("postgres://db:notaport/appdb")
+	assert.Error(t, err)
+}
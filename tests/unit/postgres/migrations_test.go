@@ -0,0 +1,125 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
+	"github.com/RVodassa/url-shortener/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// newMigrate открывает встроенные миграции для dsn.
+func newMigrate(t *testing.T, dsn string) *migrate.Migrate {
+	source, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+	m, err := migrate.NewWithSourceInstance("iofs", source, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = m.Close() })
+	return m
+}
+
+func TestMigrations(t *testing.T) {
+	dsn := testDSN(t)
+	ctx := context.Background()
+
+	// схема с нуля; после Drop нет таблицы версий, поэтому миграции открываются заново
+	require.NoError(t, newMigrate(t, dsn).Drop())
+	m := newMigrate(t, dsn)
+	require.NoError(t, m.Up())
+	require.NoError(t, m.Down())
+	require.NoError(t, m.Up())
+
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	defer pool.Close()
+	store := postgres.New(pool)
+
+	longUrl := "http://example.com/?utm=" + strings.Repeat("a", 1000)
+	require.NoError(t, store.SaveUrl(ctx, storage.Link{Alias: "long", Url: longUrl}))
+
+	link, err := store.GetUrl(ctx, "", "long")
+	require.NoError(t, err)
+	assert.Equal(t, longUrl, link.Url)
+
+	var found string
+	err = pool.QueryRow(ctx, `SELECT alias FROM urls WHERE url_hash = sha256(convert_to($1, 'UTF8')) AND url = $1`,
+		longUrl).Scan(&found)
+	require.NoError(t, err)
+	assert.Equal(t, "long", found)
+
+	err = store.SaveUrl(ctx, storage.Link{Alias: "long", Url: longUrl})
+	assert.ErrorIs(t, err, storage.ErrExistAlias)
+
+	err = store.SaveUrl(ctx, storage.Link{Alias: "huge", Url: "http://example.com/" + strings.Repeat("a", storage.MaxUrlLength)})
+	assert.ErrorIs(t, err, storage.ErrUrlTooLong)
+
+	_, err = pool.Exec(ctx, `UPDATE urls SET status = 'unknown' WHERE alias = 'long'`)
+	assert.Error(t, err)
+
+	// откат до VARCHAR(255) не пройдет с длинными url
+	_, err = pool.Exec(ctx, `DELETE FROM urls`)
+	require.NoError(t, err)
+	if err = m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("Down: %v", err)
+	}
+}
+
+func TestMigrate_Command(t *testing.T) {
+	dsn := testDSN(t)
+	ctx := context.Background()
+
+	run := func(args ...string) string {
+		cmd, err := postgres.ParseMigrateCommand(args)
+		require.NoError(t, err)
+		var out strings.Builder
+		require.NoError(t, postgres.Migrate(ctx, dsn, func(m *migrate.Migrate) error {
+			return cmd.Run(m, &out)
+		}))
+		return out.String()
+	}
+
+	run("up")
+	version := run("version")
+	assert.Contains(t, version, "dirty: false")
+
+	down := run("down", "1")
+	assert.NotEqual(t, version, down)
+	assert.Equal(t, version, run("up"))
+}
+
+func TestParseMigrateCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    postgres.MigrateCommand
+		wantErr error
+	}{
+		{name: "Up", args: []string{"up"}, want: postgres.MigrateCommand{Name: "up"}},
+		{name: "Version", args: []string{"version"}, want: postgres.MigrateCommand{Name: "version"}},
+		{name: "Down", args: []string{"down", "2"}, want: postgres.MigrateCommand{Name: "down", N: 2}},
+		{name: "Force", args: []string{"force", "15"}, want: postgres.MigrateCommand{Name: "force", N: 15}},
+		{name: "Force Nil Version", args: []string{"force", "-1"}, want: postgres.MigrateCommand{Name: "force", N: -1}},
+		{name: "Empty", args: nil, wantErr: postgres.ErrBadMigrateCommand},
+		{name: "Unknown", args: []string{"drop"}, wantErr: postgres.ErrBadMigrateCommand},
+		{name: "Down Without N", args: []string{"down"}, wantErr: postgres.ErrBadMigrateCommand},
+		{name: "Down Zero", args: []string{"down", "0"}, wantErr: postgres.ErrBadMigrateCommand},
+		{name: "Down Not Number", args: []string{"down", "all"}, wantErr: postgres.ErrBadMigrateCommand},
+		{name: "Up Extra Argument", args: []string{"up", "1"}, wantErr: postgres.ErrBadMigrateCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := postgres.ParseMigrateCommand(tt.args)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/RVodassa/url-shortener/internal/storage"
 	"github.com/jackc/pgx/v5"
 	"testing"
+	"time"
 
 	"github.com/RVodassa/url-shortener/internal/storage/sql/postgres"
 	mockPGX "github.com/RVodassa/url-shortener/internal/storage/sql/postgres/mock"
@@ -18,6 +19,28 @@ import (
 
 //go:generate mockgen -source=postgres_test.go -destination=./mock/pgx_mock.go
 
+// scanLink заполняет аргументы Scan в порядке колонок ссылки.
+func scanLink(link storage.Link) func(dest ...any) error {
+	return func(dest ...any) error {
+		*dest[0].(*string) = link.Alias
+		*dest[1].(*string) = link.Url
+		*dest[2].(*string) = link.Title
+		*dest[3].(*string) = link.Description
+		*dest[4].(*[]string) = link.Tags
+		*dest[5].(*string) = link.Notes
+		*dest[6].(*storage.Status) = link.Status
+		return nil
+	}
+}
+
+// scanStatus заполняет аргумент Scan запроса статуса ссылки.
+func scanStatus(status storage.Status) func(dest ...any) error {
+	return func(dest ...any) error {
+		*dest[0].(*storage.Status) = status
+		return nil
+	}
+}
+
 func TestSaveUrl(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -37,9 +60,27 @@ func TestSaveUrl(t *testing.T) {
 			alias: "alias1",
 			url:   "http://example.com",
 			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
 				pgxmock.EXPECT().
-					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(pgconn.NewCommandTag("INSERT 1"), nil)
+				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("INSERT 1"), nil)
+				pgxmock.EXPECT().Commit(gomock.Any()).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name:  "Serialization Failure Retried",
+			alias: "alias1",
+			url:   "http://example.com",
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil).Times(2)
+				pgxmock.EXPECT().
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(pgconn.NewCommandTag("INSERT 1"), nil).Times(2)
+				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("INSERT 1"), nil).Times(2)
+				pgxmock.EXPECT().Commit(gomock.Any()).Return(&pgconn.PgError{Code: "40001"})
+				pgxmock.EXPECT().Commit(gomock.Any()).Return(nil)
 			},
 			wantErr: nil,
 		},
@@ -62,29 +103,55 @@ func TestSaveUrl(t *testing.T) {
 			alias: "alias1",
 			url:   "http://example.com",
 			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
 				pgxmock.EXPECT().
-					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(pgconn.CommandTag{}, &pgconn.PgError{Code: "23505"})
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
 			},
 			wantErr: storage.ErrExistAlias,
 		},
+		{
+			name:  "Url Too Long",
+			alias: "alias1",
+			url:   "http://example.com",
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(pgconn.CommandTag{}, &pgconn.PgError{Code: "23514", ConstraintName: "urls_url_check"})
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
+			},
+			wantErr: storage.ErrUrlTooLong,
+		},
 		{
 			name:  "Internal Error",
 			alias: "alias1",
 			url:   "http://example.com",
 			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
 				pgxmock.EXPECT().
-					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(pgconn.CommandTag{}, errors.New("internal error"))
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
 			},
-			wantErr: fmt.Errorf("storage.Postgres.SaveUrl: url='http://example.com', alias='alias1'. internal error"),
+			wantErr: fmt.Errorf("storage.Postgres.SaveUrl: url='http://example.com', domain='', alias='alias1'. internal error"),
+		},
+		{
+			name:  "Begin Error",
+			alias: "alias1",
+			url:   "http://example.com",
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(nil, errors.New("internal error"))
+			},
+			wantErr: fmt.Errorf("storage.Postgres.SaveUrl: url='http://example.com', domain='', alias='alias1'. начало транзакции. internal error"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			err := store.SaveUrl(context.Background(), tt.alias, tt.url)
+			err := store.SaveUrl(context.Background(), storage.Link{Alias: tt.alias, Url: tt.url})
 
 			if tt.wantErr == nil {
 				assert.NoError(t, err)
@@ -105,7 +172,7 @@ func TestGetUrl(t *testing.T) {
 		name    string
 		alias   string
 		mock    func()
-		want    string
+		want    storage.Link
 		wantErr error
 	}{
 		{
@@ -113,16 +180,27 @@ func TestGetUrl(t *testing.T) {
 			alias: "alias1",
 			mock: func() {
 				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
-				pgxmock.EXPECT().Scan(gomock.Any()).SetArg(0, "http://example.com").Return(nil)
+				pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(storage.Link{
+					Alias:  "alias1",
+					Url:    "http://example.com",
+					Title:  "Example",
+					Tags:   []string{"docs"},
+					Status: storage.StatusActive,
+				}))
+			},
+			want: storage.Link{
+				Alias:  "alias1",
+				Url:    "http://example.com",
+				Title:  "Example",
+				Tags:   []string{"docs"},
+				Status: storage.StatusActive,
 			},
-			want:    "http://example.com",
 			wantErr: nil,
 		},
 		{
 			name:    "Empty Alias",
 			alias:   "",
 			mock:    func() {},
-			want:    "",
 			wantErr: storage.ErrAliasIsEmpty,
 		},
 		{
@@ -132,7 +210,32 @@ func TestGetUrl(t *testing.T) {
 				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
 				pgxmock.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
 			},
-			want:    "",
+			wantErr: storage.ErrNotFound,
+		},
+		{
+			name:  "Disabled",
+			alias: "alias1",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(storage.Link{
+					Alias:  "alias1",
+					Url:    "http://example.com",
+					Status: storage.StatusDisabled,
+				}))
+			},
+			wantErr: storage.ErrDisabled,
+		},
+		{
+			name:  "Soft Deleted",
+			alias: "alias1",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(storage.Link{
+					Alias:  "alias1",
+					Url:    "http://example.com",
+					Status: storage.StatusDeleted,
+				}))
+			},
 			wantErr: storage.ErrNotFound,
 		},
 		{
@@ -142,15 +245,14 @@ func TestGetUrl(t *testing.T) {
 				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
 				pgxmock.EXPECT().Scan(gomock.Any()).Return(errors.New("internal error"))
 			},
-			want:    "",
-			wantErr: fmt.Errorf("storage.Postgres.GetUrl: alias='alias1'. internal error"),
+			wantErr: fmt.Errorf("storage.Postgres.GetUrl: domain='', alias='alias1'. internal error"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			got, err := store.GetUrl(context.Background(), tt.alias)
+			got, err := store.GetUrl(context.Background(), "", tt.alias)
 
 			if tt.wantErr == nil {
 				assert.NoError(t, err)
@@ -161,6 +263,78 @@ func TestGetUrl(t *testing.T) {
 		})
 	}
 }
+func TestUseUrl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	// scanUses отдает max_uses и uses_left после списания, nil - NULL
+	scanUses := func(maxUses, left *int64) func(dest ...any) error {
+		return func(dest ...any) error {
+			*dest[0].(**int64) = maxUses
+			*dest[1].(**int64) = left
+			return nil
+		}
+	}
+	ptr := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name    string
+		mock    func()
+		want    int64
+		wantErr error
+	}{
+		{
+			name: "Success",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "", "alias1").Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanUses(ptr(3), ptr(2)))
+			},
+			want: 2,
+		},
+		{
+			name: "Unlimited",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "", "alias1").Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanUses(ptr(0), nil))
+			},
+			want: -1,
+		},
+		{
+			name: "Exhausted",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "", "alias1").Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanUses(ptr(3), nil))
+			},
+			wantErr: storage.ErrExhausted,
+		},
+		{
+			name: "Not Found",
+			mock: func() {
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "", "alias1").Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanUses(nil, nil))
+			},
+			wantErr: storage.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			got, err := store.UseUrl(context.Background(), "", "alias1")
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDeleteUrl(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -178,7 +352,12 @@ func TestDeleteUrl(t *testing.T) {
 			name:  "Success",
 			alias: "alias1",
 			mock: func() {
-				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("DELETE 1"), nil)
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanStatus(storage.StatusActive))
+				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("UPDATE 1"), nil)
+				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("INSERT 1"), nil)
+				pgxmock.EXPECT().Commit(gomock.Any()).Return(nil)
 			},
 			wantErr: nil,
 		},
@@ -192,7 +371,10 @@ func TestDeleteUrl(t *testing.T) {
 			name:  "Not Found",
 			alias: "alias1",
 			mock: func() {
-				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("DELETE 0"), nil)
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
 			},
 			wantErr: storage.ErrNotFound,
 		},
@@ -200,16 +382,20 @@ func TestDeleteUrl(t *testing.T) {
 			name:  "Internal Error",
 			alias: "alias1",
 			mock: func() {
-				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.CommandTag{}, errors.New("internal error"))
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+				pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanStatus(storage.StatusActive))
+				pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.CommandTag{}, errors.New("internal error"))
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
 			},
-			wantErr: fmt.Errorf("storage.Postgres.DeleteUrl: alias='alias1'. internal error"),
+			wantErr: fmt.Errorf("storage.Postgres.DeleteUrl: domain='', alias='alias1'. internal error"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mock()
-			err := store.DeleteUrl(context.Background(), tt.alias)
+			err := store.DeleteUrl(context.Background(), "", tt.alias)
 
 			if tt.wantErr == nil {
 				assert.NoError(t, err)
@@ -220,6 +406,148 @@ func TestDeleteUrl(t *testing.T) {
 	}
 }
 
+func TestSwitchStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	methods := map[string]struct {
+		call     func(ctx context.Context, domain, alias string) error
+		from, to storage.Status
+	}{
+		"DisableUrl": {store.DisableUrl, storage.StatusActive, storage.StatusDisabled},
+		"EnableUrl":  {store.EnableUrl, storage.StatusDisabled, storage.StatusActive},
+		"RestoreUrl": {store.RestoreUrl, storage.StatusDeleted, storage.StatusActive},
+	}
+
+	for name, method := range methods {
+		tests := []struct {
+			name    string
+			alias   string
+			mock    func()
+			wantErr error
+		}{
+			{
+				name:  "Success",
+				alias: "alias1",
+				mock: func() {
+					pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+					pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+					pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanStatus(method.from))
+					pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), method.to).Return(pgconn.NewCommandTag("UPDATE 1"), nil)
+					pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("INSERT 1"), nil)
+					pgxmock.EXPECT().Commit(gomock.Any()).Return(nil)
+				},
+				wantErr: nil,
+			},
+			{
+				name:  "Already In Status",
+				alias: "alias1",
+				mock: func() {
+					pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+					pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+					pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanStatus(method.to))
+					pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
+				},
+				wantErr: storage.ErrUnchanged,
+			},
+			{
+				name:    "Empty Alias",
+				alias:   "",
+				mock:    func() {},
+				wantErr: storage.ErrAliasIsEmpty,
+			},
+			{
+				name:  "Not Found",
+				alias: "alias1",
+				mock: func() {
+					pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+					pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+					pgxmock.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
+					pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
+				},
+				wantErr: storage.ErrNotFound,
+			},
+			{
+				name:  "Internal Error",
+				alias: "alias1",
+				mock: func() {
+					pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+					pgxmock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(pgxmock)
+					pgxmock.EXPECT().Scan(gomock.Any()).DoAndReturn(scanStatus(method.from))
+					pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), method.to).Return(pgconn.CommandTag{}, errors.New("internal error"))
+					pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
+				},
+				wantErr: fmt.Errorf("storage.Postgres.%s: domain='', alias='alias1'. internal error", name),
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				tt.mock()
+				err := method.call(context.Background(), "", tt.alias)
+
+				if tt.wantErr == nil {
+					assert.NoError(t, err)
+				} else {
+					assert.EqualError(t, err, tt.wantErr.Error())
+				}
+			})
+		}
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("DELETE 3"), nil)
+
+	purged, err := store.PurgeDeleted(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+}
+
+func TestListUrls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	pgxmock.EXPECT().
+		Query(gomock.Any(), gomock.Any(), "docs", gomock.Any(), 0).
+		Return(nil, errors.New("internal error"))
+
+	_, err := store.ListUrls(context.Background(), storage.ListFilter{Tag: "docs", Limit: 10})
+	assert.EqualError(t, err, "storage.Postgres.ListUrls: tag='docs'. internal error")
+}
+
+func TestTouchUrls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	accessed := time.Now()
+	pgxmock.EXPECT().
+		Exec(gomock.Any(), gomock.Any(), []string{""}, []string{"alias1"}, []time.Time{accessed},
+			[]map[string]int64{{"1": 2}}).
+		Return(pgconn.NewCommandTag("UPDATE 1"), nil)
+
+	// пустая пачка не идет в базу
+	assert.NoError(t, store.TouchUrls(context.Background(), nil))
+	assert.NoError(t, store.TouchUrls(context.Background(), map[storage.Key]storage.Access{
+		{Alias: "alias1"}: {At: accessed, Clicks: map[int]int64{1: 2}},
+	}))
+}
+
 func TestDisconnect(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -254,3 +582,210 @@ func TestDisconnect(t *testing.T) {
 		})
 	}
 }
+
+func TestPurgeStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	// нулевое время передается как NULL и выключает критерий
+	pgxmock.EXPECT().
+		Query(gomock.Any(), gomock.Any(), gomock.Any(), (*time.Time)(nil), gomock.Any()).
+		Return(nil, errors.New("internal error"))
+
+	_, err := store.PurgeStale(context.Background(), storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 100})
+	assert.EqualError(t, err, "storage.Postgres.PurgeStale: internal error")
+}
+
+func TestReadChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	// позиция разбирается на номер транзакции и id строки
+	pgxmock.EXPECT().
+		Query(gomock.Any(), gomock.Any(), "981", int64(17), 100).
+		Return(nil, errors.New("internal error"))
+
+	_, err := store.ReadChanges(context.Background(), "981-17", 100)
+	assert.EqualError(t, err, "storage.Postgres.ReadChanges: offset='981-17'. internal error")
+
+	pgxmock.EXPECT().
+		Query(gomock.Any(), gomock.Any(), "0", int64(0), 10).
+		Return(nil, errors.New("internal error"))
+
+	_, err = store.ReadChanges(context.Background(), "", 10)
+	assert.Error(t, err)
+
+	for _, offset := range []string{"abc", "1-", "-5", "1-2-3", "1700000000000"} {
+		_, err = store.ReadChanges(context.Background(), offset, 10)
+		assert.ErrorIs(t, err, storage.ErrBadOffset, offset)
+	}
+}
+
+func TestPurgeChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	pgxmock.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(pgconn.NewCommandTag("DELETE 12"), nil)
+
+	purged, err := store.PurgeChanges(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), purged)
+}
+
+func TestWithTx(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pgxmock := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(pgxmock)
+
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	tests := []struct {
+		name      string
+		fn        func(tx pgx.Tx) error
+		mock      func()
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name: "Commit",
+			fn:   func(tx pgx.Tx) error { return nil },
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().Commit(gomock.Any()).Return(nil)
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "Rollback On Error",
+			fn:   func(tx pgx.Tx) error { return storage.ErrNotFound },
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil)
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil)
+			},
+			wantCalls: 1,
+			wantErr:   storage.ErrNotFound,
+		},
+		{
+			name: "Gives Up After Retries",
+			fn:   func(tx pgx.Tx) error { return deadlock },
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(pgxmock, nil).Times(3)
+				pgxmock.EXPECT().Rollback(gomock.Any()).Return(nil).Times(3)
+			},
+			wantCalls: 3,
+			wantErr:   deadlock,
+		},
+		{
+			name: "Begin Error",
+			fn:   func(tx pgx.Tx) error { return nil },
+			mock: func() {
+				pgxmock.EXPECT().BeginTx(gomock.Any(), gomock.Any()).Return(nil, errors.New("internal error"))
+			},
+			wantErr: errors.New("начало транзакции. internal error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			calls := 0
+			err := store.WithTx(context.Background(), func(tx pgx.Tx) error {
+				calls++
+				return tt.fn(tx)
+			})
+
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+		})
+	}
+}
+
+func TestGetUrl_Replicas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockPGX.NewMockIPGX(ctrl)
+	replica := mockPGX.NewMockIPGX(ctrl)
+	store := postgres.New(primary, replica)
+
+	link := storage.Link{Alias: "alias1", Url: "http://example.com", Status: storage.StatusActive}
+
+	tests := []struct {
+		name    string
+		mock    func()
+		wantErr error
+	}{
+		{
+			name: "Read From Replica",
+			mock: func() {
+				replica.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(replica)
+				replica.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(link))
+			},
+		},
+		{
+			name: "Replica Lag Falls Back To Primary",
+			mock: func() {
+				replica.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(replica)
+				replica.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
+				primary.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(primary)
+				primary.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(link))
+			},
+		},
+		{
+			name: "Replica Down Falls Back To Primary",
+			mock: func() {
+				replica.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(replica)
+				replica.EXPECT().Scan(gomock.Any()).Return(errors.New("connection refused"))
+				primary.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(primary)
+				primary.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(link))
+			},
+		},
+		{
+			name: "Not Found Anywhere",
+			mock: func() {
+				replica.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(replica)
+				replica.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
+				primary.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(primary)
+				primary.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows)
+			},
+			wantErr: storage.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			got, err := store.GetUrl(context.Background(), "", "alias1")
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, link.Url, got.Url)
+			} else {
+				assert.Equal(t, tt.wantErr, err)
+			}
+		})
+	}
+
+	// записи и чтение сведений не уходят на реплику
+	t.Run("Writes Use Primary", func(t *testing.T) {
+		primary.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(primary)
+		primary.EXPECT().Scan(gomock.Any()).DoAndReturn(scanLink(link))
+		_, err := store.GetUrlInfo(context.Background(), "", "alias1")
+		assert.NoError(t, err)
+	})
+}
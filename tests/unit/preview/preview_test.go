@@ -0,0 +1,90 @@
+package preview_test
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/lib/preview"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func stubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><head>
+<title>Обычный заголовок</title>
+<meta name="description" content="Обычное описание">
+<meta property="og:title" content="Заголовок &amp; OpenGraph">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:description" content="из body не читается"></body></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><title> Страница </title>
+<meta name="Description" content="Описание"><meta property="og:image" content="javascript:alert(1)"></head></html>`))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/og", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	server := stubServer(t)
+	fetcher := preview.NewFetcher(server.Client())
+
+	t.Run("OpenGraph важнее обычных тегов", func(t *testing.T) {
+		page, err := fetcher.Fetch(context.Background(), server.URL+"/og")
+		require.NoError(t, err)
+		assert.Equal(t, storage.Page{
+			Title:       "Заголовок & OpenGraph",
+			Description: "Обычное описание",
+			Image:       server.URL + "/img/cover.png",
+			SiteName:    "Example",
+		}, page)
+	})
+
+	t.Run("без OpenGraph", func(t *testing.T) {
+		page, err := fetcher.Fetch(context.Background(), server.URL+"/plain")
+		require.NoError(t, err)
+		// картинка не http(s) отбрасывается
+		assert.Equal(t, storage.Page{Title: "Страница", Description: "Описание"}, page)
+	})
+
+	t.Run("после переадресации", func(t *testing.T) {
+		page, err := fetcher.Fetch(context.Background(), server.URL+"/moved")
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/img/cover.png", page.Image)
+	})
+
+	t.Run("не HTML", func(t *testing.T) {
+		_, err := fetcher.Fetch(context.Background(), server.URL+"/json")
+		assert.ErrorIs(t, err, preview.ErrNotHTML)
+	})
+
+	t.Run("страница не найдена", func(t *testing.T) {
+		_, err := fetcher.Fetch(context.Background(), server.URL+"/missing")
+		assert.ErrorIs(t, err, preview.ErrBadResponse)
+	})
+}
+
+func TestSafeClient(t *testing.T) {
+	server := stubServer(t)
+
+	// адрес тестового сервера - loopback
+	_, err := preview.NewFetcher(preview.SafeClient(time.Second)).Fetch(context.Background(), server.URL+"/og")
+	assert.ErrorIs(t, err, preview.ErrPrivateAddr)
+}
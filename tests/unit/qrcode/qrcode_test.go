@@ -0,0 +1,137 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const content = "https://sho.rt/QWERTY1234"
+
+func TestEncoder_RenderPNG(t *testing.T) {
+	data, err := qrcode.NewEncoder().Render(content, qrcode.Options{Size: 300})
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	// угол - поле, цвет фона по умолчанию
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b})
+}
+
+func TestEncoder_RenderSVG(t *testing.T) {
+	margin := 0
+	data, err := qrcode.NewEncoder().Render(content, qrcode.Options{
+		Format:     qrcode.FormatSVG,
+		Margin:     &margin,
+		Foreground: color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80},
+	})
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `<path fill="#112233" d="M`)
+	assert.Contains(t, svg, `fill-opacity="0.502"`)
+	// без поля первый модуль - угол поискового узора
+	assert.Contains(t, svg, `d="M0 0h7v1h-7z`)
+}
+
+func TestEncoder_RenderBadOptions(t *testing.T) {
+	margin := -1
+	black := color.RGBA{A: 0xff}
+
+	tests := []struct {
+		name string
+		opts qrcode.Options
+	}{
+		{name: "неизвестный формат", opts: qrcode.Options{Format: "gif"}},
+		{name: "слишком маленький размер", opts: qrcode.Options{Size: 10}},
+		{name: "слишком большой размер", opts: qrcode.Options{Size: 10000}},
+		{name: "неизвестный уровень", opts: qrcode.Options{Level: "X"}},
+		{name: "отрицательное поле", opts: qrcode.Options{Margin: &margin}},
+		{name: "цвета совпадают", opts: qrcode.Options{Foreground: black, Background: black}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := qrcode.NewEncoder().Render(content, tt.opts)
+			assert.ErrorIs(t, err, qrcode.ErrBadOptions)
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := qrcode.ParseColor("#1a2B3c")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}, c)
+
+	c, err = qrcode.ParseColor("1a2b3c80")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0x80}, c)
+
+	for _, s := range []string{"", "fff", "zzzzzz", "#1a2b3c4"} {
+		_, err = qrcode.ParseColor(s)
+		assert.ErrorIs(t, err, qrcode.ErrBadOptions, s)
+	}
+}
+
+type countingRenderer struct {
+	calls int
+	err   error
+}
+
+func (r *countingRenderer) Render(content string, opts qrcode.Options) ([]byte, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []byte(content + "|" + opts.Key()), nil
+}
+
+func TestCache(t *testing.T) {
+	next := &countingRenderer{}
+	cache := qrcode.NewCache(next, 2)
+
+	// параметры по умолчанию и явно заданные совпадают после нормализации
+	first, err := cache.Render(content, qrcode.Options{})
+	require.NoError(t, err)
+	second, err := cache.Render(content, qrcode.Options{Format: qrcode.FormatPNG, Size: qrcode.DefaultSize, Level: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, next.calls)
+
+	// другая ссылка и другой размер - свои записи, самая старая вытесняется
+	_, err = cache.Render("https://sho.rt/other", qrcode.Options{})
+	require.NoError(t, err)
+	_, err = cache.Render(content, qrcode.Options{Size: 512})
+	require.NoError(t, err)
+	assert.Equal(t, 3, next.calls)
+
+	_, err = cache.Render(content, qrcode.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, next.calls)
+
+	// невалидные параметры не доходят до вложенного Renderer
+	_, err = cache.Render(content, qrcode.Options{Size: 1})
+	assert.ErrorIs(t, err, qrcode.ErrBadOptions)
+	assert.Equal(t, 4, next.calls)
+
+	// ошибки не кэшируются
+	next.err = errors.New("render error")
+	_, err = cache.Render("https://sho.rt/failed", qrcode.Options{})
+	assert.Error(t, err)
+	next.err = nil
+	_, err = cache.Render("https://sho.rt/failed", qrcode.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, next.calls)
+}
@@ -0,0 +1,18 @@
+package redisStorage_test
+
+import (
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/redisStorage"
+	"github.com/RVodassa/url-shortener/internal/storage/storagetest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		return redisStorage.New(client, redisStorage.Config{KeyPrefix: "shortener"})
+	})
+}
@@ -0,0 +1,83 @@
+package redisStorage_test
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/redisStorage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestConfig_Options(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     redisStorage.Config
+		wantErr bool
+	}{
+		{name: "Single", cfg: redisStorage.Config{Addrs: []string{"localhost:6379"}, DB: 2}},
+		{name: "Sentinel", cfg: redisStorage.Config{Addrs: []string{"s1:26379", "s2:26379"}, MasterName: "mymaster", DB: 1}},
+		{name: "Cluster", cfg: redisStorage.Config{Addrs: []string{"n1:6379", "n2:6379"}}},
+		{name: "No Addrs", cfg: redisStorage.Config{}, wantErr: true},
+		{name: "Cluster With DB", cfg: redisStorage.Config{Addrs: []string{"n1:6379"}, Cluster: true, DB: 1}, wantErr: true},
+		{name: "TLS Missing CA", cfg: redisStorage.Config{Addrs: []string{"localhost:6379"}, TLS: true, CAFile: "/nonexistent/ca.pem"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.cfg.Options()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.cfg.Addrs, opts.Addrs)
+			assert.Equal(t, tt.cfg.DB, opts.DB)
+		})
+	}
+
+	t.Run("TLS Server Name From Addr", func(t *testing.T) {
+		opts, err := redisStorage.Config{Addrs: []string{"redis.internal:6380"}, TLS: true}.Options()
+		require.NoError(t, err)
+		assert.Equal(t, "redis.internal", opts.TLSConfig.ServerName)
+	})
+}
+
+func TestKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     redisStorage.Config
+		wantKey string
+	}{
+		{name: "No Prefix", cfg: redisStorage.Config{}, wantKey: "link:alias1"},
+		{name: "Prefix", cfg: redisStorage.Config{KeyPrefix: "shortener"}, wantKey: "shortener:link:alias1"},
+		{name: "Cluster Hash Tag", cfg: redisStorage.Config{Cluster: true}, wantKey: "{url-shortener}:link:alias1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			store := redisStorage.New(client, tt.cfg)
+			ctx := context.Background()
+
+			require.NoError(t, store.SaveUrl(ctx, storage.Link{Alias: "alias1", Url: "http://example.com", MaxUses: 2, UsesLeft: 2}))
+			assert.Equal(t, "http://example.com", server.HGet(tt.wantKey, "url"))
+
+			// скрипт и транзакции работают с теми же ключами
+			left, err := store.UseUrl(ctx, "", "alias1")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), left)
+			require.NoError(t, store.DisableUrl(ctx, "", "alias1"))
+			link, err := store.GetUrlInfo(ctx, "", "alias1")
+			require.NoError(t, err)
+			assert.Equal(t, storage.StatusDisabled, link.Status)
+
+			for _, key := range server.Keys() {
+				assert.Contains(t, key, tt.wantKey[:len(tt.wantKey)-len("link:alias1")])
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package redisStorage_test
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/redisStorage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMigrateLayout(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	store := redisStorage.New(client, redisStorage.Config{KeyPrefix: "shortener"})
+	ctx := context.Background()
+
+	// ссылки в раскладке 1
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, server.Set("shortener:alias1", "http://example.com"))
+	require.NoError(t, server.Set("shortener:meta:alias1", `{"title":"Example","tags":["news"],"max_uses":5}`))
+	require.NoError(t, server.Set("shortener:uses:alias1", "3"))
+	server.HSet("shortener:times:alias1", "created", strconv.FormatInt(created.UnixNano(), 10))
+	server.HSet("shortener:clicks:alias1", "0", "7")
+	require.NoError(t, server.Set("shortener:example.org/alias2", "http://example.org"))
+	require.NoError(t, server.Set("shortener:status:example.org/alias2", "disabled"))
+	// строковый служебный ключ текущей раскладки ссылкой не считается
+	require.NoError(t, server.Set("shortener:webhooks:offset", "1700000000000-0"))
+
+	migrated, err := store.MigrateLayout(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+
+	link, err := store.GetUrlInfo(ctx, "", "alias1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", link.Url)
+	assert.Equal(t, storage.StatusActive, link.Status)
+	assert.Equal(t, "Example", link.Title)
+	assert.Equal(t, []string{"news"}, link.Tags)
+	assert.Equal(t, int64(3), link.UsesLeft)
+	assert.True(t, created.Equal(link.CreatedAt))
+
+	link, err = store.GetUrlInfo(ctx, "example.org", "alias2")
+	require.NoError(t, err)
+	assert.Equal(t, storage.StatusDisabled, link.Status)
+
+	// старых ключей не осталось, ссылки попали в индекс
+	for _, key := range []string{"shortener:alias1", "shortener:meta:alias1", "shortener:uses:alias1",
+		"shortener:times:alias1", "shortener:clicks:alias1", "shortener:status:example.org/alias2"} {
+		assert.False(t, server.Exists(key), key)
+	}
+	members, err := server.ZMembers("shortener:urls:index")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"alias1", "example.org/alias2"}, members)
+	offset, err := server.Get("shortener:webhooks:offset")
+	require.NoError(t, err)
+	assert.Equal(t, "1700000000000-0", offset)
+
+	// повторный запуск ничего не переносит
+	migrated, err = store.MigrateLayout(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+}
@@ -0,0 +1,49 @@
+package redisStorage_test
+
+import (
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/redisStorage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestSaveUrl_Concurrent(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	store := redisStorage.New(client, redisStorage.Config{})
+	ctx := context.Background()
+
+	const workers = 20
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.SaveUrl(ctx, storage.Link{Alias: "alias1", Url: "http://example.com"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+		assert.True(t, errors.Is(err, storage.ErrExistAlias), err)
+	}
+	assert.Equal(t, 1, saved)
+
+	// в журнале одно создание
+	changes, err := store.ReadChanges(ctx, "", 100)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
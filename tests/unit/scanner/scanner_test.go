@@ -0,0 +1,175 @@
+package scanner_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/url-shortener/internal/lib/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklist_Scan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	content := "# вредоносные домены\nevil.com\n\nhttps://good.com/phishing\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	blocklist, err := scanner.NewBlocklist(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		url           string
+		wantMalicious bool
+	}{
+		{name: "домен из списка", url: "http://evil.com/page", wantMalicious: true},
+		{name: "поддомен из списка", url: "https://www.EVIL.com", wantMalicious: true},
+		{name: "префикс url из списка", url: "https://good.com/phishing/login", wantMalicious: true},
+		{name: "чистый url", url: "https://good.com/", wantMalicious: false},
+		{name: "похожий домен", url: "https://notevil.com", wantMalicious: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := blocklist.Scan(context.Background(), tt.url)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMalicious, verdict.Malicious)
+		})
+	}
+}
+
+func TestBlocklist_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o644))
+
+	blocklist, err := scanner.NewBlocklist(path)
+	require.NoError(t, err)
+
+	verdict, err := blocklist.Scan(context.Background(), "https://bad.org")
+	require.NoError(t, err)
+	assert.False(t, verdict.Malicious)
+
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\nbad.org\n"), 0o644))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	verdict, err = blocklist.Scan(context.Background(), "https://bad.org")
+	require.NoError(t, err)
+	assert.True(t, verdict.Malicious)
+}
+
+func TestNewBlocklist_NoFile(t *testing.T) {
+	_, err := scanner.NewBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestWebhook_Scan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Url string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Url {
+		case "https://evil.com":
+			_ = json.NewEncoder(w).Encode(scanner.Verdict{Malicious: true, Reason: "phishing"})
+		case "https://broken.com":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_ = json.NewEncoder(w).Encode(scanner.Verdict{})
+		}
+	}))
+	defer srv.Close()
+
+	webhook := scanner.NewWebhook(srv.URL, srv.Client())
+
+	tests := []struct {
+		name    string
+		url     string
+		want    scanner.Verdict
+		wantErr error
+	}{
+		{name: "вредоносный url", url: "https://evil.com", want: scanner.Verdict{Malicious: true, Reason: "phishing"}},
+		{name: "чистый url", url: "https://good.com", want: scanner.Verdict{}},
+		{name: "ошибка сервиса", url: "https://broken.com", wantErr: scanner.ErrBadResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := webhook.Scan(context.Background(), tt.url)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type countingScanner struct {
+	calls   int
+	verdict scanner.Verdict
+	err     error
+}
+
+func (c *countingScanner) Scan(ctx context.Context, urlStr string) (scanner.Verdict, error) {
+	c.calls++
+	return c.verdict, c.err
+}
+
+func TestCache_Scan(t *testing.T) {
+	next := &countingScanner{verdict: scanner.Verdict{Malicious: true}}
+	cache := scanner.NewCache(next, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		verdict, err := cache.Scan(context.Background(), "https://evil.com")
+		assert.NoError(t, err)
+		assert.True(t, verdict.Malicious)
+	}
+	assert.Equal(t, 1, next.calls)
+
+	// ошибки не кэшируются
+	failing := &countingScanner{err: errors.New("timeout")}
+	cache = scanner.NewCache(failing, time.Minute)
+	_, err := cache.Scan(context.Background(), "https://evil.com")
+	assert.Error(t, err)
+	_, err = cache.Scan(context.Background(), "https://evil.com")
+	assert.Error(t, err)
+	assert.Equal(t, 2, failing.calls)
+}
+
+func TestCache_Evict(t *testing.T) {
+	next := &countingScanner{}
+	cache := scanner.NewCache(next, time.Hour)
+	scan := func(urlStr string) {
+		_, err := cache.Scan(context.Background(), urlStr)
+		assert.NoError(t, err)
+	}
+
+	// кэш заполнен: "https://first.com" и 9999 других Url
+	scan("https://first.com")
+	for i := 0; i < 9999; i++ {
+		scan("https://example.com/" + strconv.Itoa(i))
+	}
+	assert.Equal(t, 10000, next.calls)
+
+	// недавно использованный Url не вытесняется, вытесняется самый давний
+	scan("https://first.com")
+	scan("https://new.com")
+	assert.Equal(t, 10001, next.calls)
+	scan("https://first.com")
+	assert.Equal(t, 10001, next.calls)
+	scan("https://example.com/0")
+	assert.Equal(t, 10002, next.calls)
+}
@@ -0,0 +1,120 @@
+package service_test
+
+import (
+	"context"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestService_SaveUrlPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	t.Run("хранится только хеш пароля", func(t *testing.T) {
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, link storage.Link) error {
+				assert.Empty(t, link.Password)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte("secret")))
+				assert.Equal(t, int64(3), link.MaxUses)
+				assert.Equal(t, int64(3), link.UsesLeft)
+				return nil
+			})
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Password: "secret", MaxUses: 3})
+		assert.NoError(t, err)
+	})
+
+	t.Run("слишком длинный пароль", func(t *testing.T) {
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Password: strings.Repeat("a", 73)})
+		assert.ErrorIs(t, err, service.ErrBadPassword)
+	})
+
+	t.Run("отрицательное число использований", func(t *testing.T) {
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", MaxUses: -1})
+		assert.ErrorIs(t, err, service.ErrBadMaxUses)
+	})
+}
+
+func TestService_GetUrlPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	link := storage.Link{Alias: "example-alias", Url: "http://google.com", PasswordHash: string(hash), MaxUses: 2, UsesLeft: 1}
+
+	tests := []struct {
+		name        string
+		password    string
+		mock        func()
+		expectedErr error
+	}{
+		{
+			name:        "пароль не введен",
+			expectedErr: service.ErrPasswordNeeded,
+		},
+		{
+			name:        "неверный пароль не тратит использование",
+			password:    "wrong",
+			expectedErr: service.ErrWrongPassword,
+		},
+		{
+			name:     "верный пароль",
+			password: "secret",
+			mock: func() {
+				mockStorage.EXPECT().UseUrl(gomock.Any(), "", "example-alias").Return(int64(0), nil)
+			},
+		},
+		{
+			name:     "использования закончились параллельно",
+			password: "secret",
+			mock: func() {
+				mockStorage.EXPECT().UseUrl(gomock.Any(), "", "example-alias").Return(int64(0), storage.ErrExhausted)
+			},
+			expectedErr: service.ErrExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(link, nil)
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			got, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{Password: tt.password})
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), got.UsesLeft)
+		})
+	}
+
+	t.Run("исчерпанная ссылка не спрашивает пароль", func(t *testing.T) {
+		exhausted := link
+		exhausted.UsesLeft = 0
+		mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(exhausted, nil)
+
+		_, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{})
+		assert.ErrorIs(t, err, service.ErrExhausted)
+	})
+}
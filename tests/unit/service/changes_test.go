@@ -0,0 +1,188 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFeed журнал в памяти; позиция - номер записи.
+type fakeFeed struct {
+	mu      sync.Mutex
+	changes []storage.Change
+	offsets []string // позиции, с которых читали
+	purged  time.Time
+}
+
+func (f *fakeFeed) add(changes ...storage.Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, change := range changes {
+		change.Offset = strconv.Itoa(len(f.changes) + 1)
+		f.changes = append(f.changes, change)
+	}
+}
+
+func (f *fakeFeed) ReadChanges(_ context.Context, offset string, limit int) ([]storage.Change, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offsets = append(f.offsets, offset)
+
+	start := 0
+	if offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil {
+			return nil, storage.ErrBadOffset
+		}
+		start = n
+	}
+	if start >= len(f.changes) {
+		return nil, nil
+	}
+	return f.changes[start:min(start+limit, len(f.changes))], nil
+}
+
+func (f *fakeFeed) PurgeChanges(_ context.Context, before time.Time) (int64, error) {
+	f.purged = before
+	return 1, nil
+}
+
+func TestService_WatchUrls(t *testing.T) {
+	t.Run("изменения по порядку с продолжением с позиции", func(t *testing.T) {
+		feed := &fakeFeed{}
+		feed.add(
+			storage.Change{Op: storage.ChangeInsert, Alias: "a"},
+			storage.Change{Op: storage.ChangeUpdate, Alias: "a", Domain: "brand.link"},
+			storage.Change{Op: storage.ChangeDelete, Alias: "b"},
+		)
+		s := service.New(nil, nil, service.WithChangeFeed(feed, time.Millisecond),
+			service.WithDomains("sho.rt", map[string]service.DomainRules{"sho.rt": {}, "brand.link": {}}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var got []storage.Change
+		err := s.WatchUrls(ctx, "1", func(change storage.Change) error {
+			got = append(got, change)
+			if len(got) == 3 {
+				cancel()
+			}
+			if len(got) == 2 {
+				// запись, появившаяся во время наблюдения
+				feed.add(storage.Change{Op: storage.ChangeInsert, Alias: "c"})
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		require.Len(t, got, 3)
+		assert.Equal(t, "2", got[0].Offset)
+		assert.Equal(t, "brand.link", got[0].Domain)
+		assert.Equal(t, "sho.rt", got[1].Domain)
+		assert.Equal(t, "c", got[2].Alias)
+		assert.Equal(t, "1", feed.offsets[0])
+		assert.Contains(t, feed.offsets, "3")
+	})
+
+	t.Run("ошибка отправки останавливает наблюдение", func(t *testing.T) {
+		feed := &fakeFeed{}
+		feed.add(storage.Change{Op: storage.ChangeInsert, Alias: "a"})
+		s := service.New(nil, nil, service.WithChangeFeed(feed, time.Millisecond))
+
+		sendErr := errors.New("клиент отключился")
+		err := s.WatchUrls(context.Background(), "", func(storage.Change) error {
+			return sendErr
+		})
+		assert.ErrorIs(t, err, sendErr)
+	})
+
+	t.Run("невалидная позиция", func(t *testing.T) {
+		s := service.New(nil, nil, service.WithChangeFeed(&fakeFeed{}, time.Millisecond))
+
+		err := s.WatchUrls(context.Background(), "x-1", func(storage.Change) error { return nil })
+		assert.ErrorIs(t, err, service.ErrBadOffset)
+	})
+
+	t.Run("хранилище без журнала", func(t *testing.T) {
+		err := service.New(nil, nil).WatchUrls(context.Background(), "", func(storage.Change) error { return nil })
+		assert.ErrorIs(t, err, service.ErrChangesUnavailable)
+
+		purged, err := service.New(nil, nil).PurgeChanges(context.Background(), time.Hour)
+		assert.NoError(t, err)
+		assert.Zero(t, purged)
+	})
+
+	t.Run("очистка журнала", func(t *testing.T) {
+		feed := &fakeFeed{}
+		s := service.New(nil, nil, service.WithChangeFeed(feed, time.Millisecond))
+
+		purged, err := s.PurgeChanges(context.Background(), time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), feed.purged, time.Minute)
+	})
+}
+
+func TestService_ReadEvents(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	feed := &fakeFeed{}
+	feed.add(
+		storage.Change{Op: storage.ChangeInsert, Alias: "a", Status: storage.StatusActive, Url: "https://example.com", At: at},
+		storage.Change{Op: storage.ChangeUpdate, Alias: "a", Domain: "brand.link", Status: storage.StatusDisabled},
+		storage.Change{Op: storage.ChangeUpdate, Alias: "a", Status: storage.StatusActive, Reason: storage.ReasonExhausted},
+		storage.Change{Op: storage.ChangeUpdate, Alias: "a", Status: storage.StatusDeleted},
+		storage.Change{Op: storage.ChangeDelete, Alias: "a", Reason: storage.ReasonPurged},
+		storage.Change{Op: storage.ChangeDelete, Alias: "b", Reason: storage.ReasonExpired},
+		storage.Change{Op: storage.ChangeDelete, Alias: "c", Reason: storage.ReasonStale},
+	)
+	s := service.New(nil, nil, service.WithChangeFeed(feed, time.Millisecond),
+		service.WithDomains("sho.rt", map[string]service.DomainRules{"sho.rt": {}, "brand.link": {}}))
+	ctx := context.Background()
+
+	events, offset, err := s.ReadEvents(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "7", offset)
+
+	// исчерпание использований и очистка удаленной ссылки событий не дают
+	require.Len(t, events, 5)
+	types := make([]service.EventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []service.EventType{service.EventCreated, service.EventUpdated, service.EventDeleted,
+		service.EventExpired, service.EventDeleted}, types)
+	assert.Equal(t, "https://example.com", events[0].Url)
+	assert.Equal(t, at, events[0].At)
+	assert.Equal(t, "sho.rt", events[0].Domain)
+	assert.Equal(t, "brand.link", events[1].Domain)
+	assert.Equal(t, storage.StatusDisabled, events[1].Status)
+
+	// повторное чтение дает те же id, разные записи - разные
+	again, _, err := s.ReadEvents(ctx, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, events[0].ID, again[0].ID)
+	assert.NotEqual(t, events[0].ID, events[1].ID)
+
+	// пачка только из пропускаемых записей сдвигает позицию
+	events, offset, err = s.ReadEvents(ctx, "4", 1)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, "5", offset)
+
+	events, offset, err = s.ReadEvents(ctx, "7", 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, "7", offset)
+
+	_, _, err = s.ReadEvents(ctx, "x-1", 10)
+	assert.ErrorIs(t, err, service.ErrBadOffset)
+	_, _, err = service.New(nil, nil).ReadEvents(ctx, "", 10)
+	assert.ErrorIs(t, err, service.ErrChangesUnavailable)
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+)
+
+func TestService_GetUrlDestinations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	tracker := &trackRecorder{}
+	s := service.New(mockStorage, mockRandom, service.WithAccessTracker(tracker))
+
+	link := storage.Link{
+		Alias: "example-alias",
+		Url:   "http://example.com/a",
+		Rules: []storage.Rule{{UserAgent: "bot", Url: "http://example.com/bot"}},
+		Destinations: []storage.Destination{
+			{Url: "http://example.com/a", Weight: 3},
+			{Url: "http://example.com/b", Weight: 1},
+		},
+	}
+	mockStorage.EXPECT().
+		GetUrl(gomock.Any(), "", "example-alias").
+		Return(link, nil).
+		AnyTimes()
+
+	t.Run("вариант закреплен за посетителем", func(t *testing.T) {
+		first, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{VisitorID: "visitor-1"})
+		assert.NoError(t, err)
+		for range 10 {
+			again, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{VisitorID: "visitor-1"})
+			assert.NoError(t, err)
+			assert.Equal(t, first.Url, again.Url)
+		}
+
+		// без идентификатора посетитель определяется по IP и User-Agent
+		rc := service.RequestContext{ClientIP: netip.MustParseAddr("203.0.113.7"), UserAgent: "Mozilla/5.0"}
+		first, err = s.GetUrl(context.Background(), "", "example-alias", rc)
+		assert.NoError(t, err)
+		again, err := s.GetUrl(context.Background(), "", "example-alias", rc)
+		assert.NoError(t, err)
+		assert.Equal(t, first.Url, again.Url)
+	})
+
+	t.Run("трафик делится по весам", func(t *testing.T) {
+		tracker.keys, tracker.variants = nil, nil
+
+		counts := map[string]int{}
+		for i := range 1000 {
+			got, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{VisitorID: fmt.Sprint("visitor-", i)})
+			assert.NoError(t, err)
+			counts[got.Url]++
+		}
+		assert.InDelta(t, 750, counts["http://example.com/a"], 75)
+		assert.InDelta(t, 250, counts["http://example.com/b"], 75)
+
+		// переход учитывается на выбранный вариант
+		clicks := map[int]int{}
+		for _, variant := range tracker.variants {
+			clicks[variant]++
+		}
+		assert.Equal(t, counts["http://example.com/a"], clicks[0])
+		assert.Equal(t, counts["http://example.com/b"], clicks[1])
+	})
+
+	t.Run("правило важнее вариантов", func(t *testing.T) {
+		tracker.keys, tracker.variants = nil, nil
+
+		got, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{UserAgent: "Googlebot"})
+		assert.NoError(t, err)
+		assert.Equal(t, "http://example.com/bot", got.Url)
+		assert.Equal(t, []int{-1}, tracker.variants)
+	})
+}
+
+func TestService_SaveUrlDestinations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	t.Run("Url по умолчанию - первый вариант", func(t *testing.T) {
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{
+				Alias: "example-alias",
+				Url:   "http://example.com/a",
+				Destinations: []storage.Destination{
+					{Url: "http://example.com/a", Weight: 1},
+					{Url: "http://example.com/b", Weight: 1},
+				},
+			}).
+			Return(nil)
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{
+			Destinations: []storage.Destination{
+				{Url: "http://example.com/a", Weight: 1},
+				// счетчики переходов не принимаются от клиента
+				{Url: "http://example.com/b", Weight: 1, Clicks: 100},
+			},
+		})
+		assert.NoError(t, err)
+	})
+
+	invalid := map[string][]storage.Destination{
+		"один вариант":        {{Url: "http://example.com/a", Weight: 1}},
+		"нулевой вес":         {{Url: "http://example.com/a", Weight: 1}, {Url: "http://example.com/b"}},
+		"невалидный url":      {{Url: "http://example.com/a", Weight: 1}, {Url: "example.com/b", Weight: 1}},
+		"слишком большой вес": {{Url: "http://example.com/a", Weight: 1}, {Url: "http://example.com/b", Weight: 100000}},
+	}
+	for name, destinations := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://example.com", Destinations: destinations})
+			assert.ErrorIs(t, err, service.ErrBadDestinations)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/mapStorage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventRecorder запоминает опубликованные события.
+type eventRecorder struct {
+	events []service.Event
+}
+
+func (r *eventRecorder) HandleEvent(_ context.Context, event service.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestService_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+
+	newService := func(opts ...service.Option) (*service.Service, *eventRecorder) {
+		s := service.New(mockStorage, mockRandom, opts...)
+		recorder := &eventRecorder{}
+		s.Events.Subscribe(recorder)
+		return s, recorder
+	}
+
+	t.Run("создание ссылки", func(t *testing.T) {
+		s, recorder := newService()
+
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		mockStorage.EXPECT().SaveUrl(gomock.Any(), gomock.Any()).Return(nil)
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com"})
+		require.NoError(t, err)
+
+		require.Len(t, recorder.events, 1)
+		event := recorder.events[0]
+		assert.Equal(t, service.EventCreated, event.Type)
+		assert.Equal(t, "example-alias", event.Alias)
+		assert.Equal(t, "http://google.com", event.Url)
+		assert.Equal(t, storage.StatusActive, event.Status)
+		assert.NotEmpty(t, event.ID)
+	})
+
+	t.Run("событие несет имя домена", func(t *testing.T) {
+		s, recorder := newService(service.WithDomains("sho.rt", map[string]service.DomainRules{
+			"sho.rt":     {},
+			"brand.link": {},
+		}))
+
+		mockStorage.EXPECT().DisableUrl(gomock.Any(), "brand.link", "QWERTY1234").Return(nil)
+		mockStorage.EXPECT().DeleteUrl(gomock.Any(), "", "QWERTY1234").Return(nil)
+
+		require.NoError(t, s.DisableUrl(context.Background(), "brand.link", "QWERTY1234"))
+		require.NoError(t, s.DeleteUrl(context.Background(), "", "QWERTY1234"))
+
+		require.Len(t, recorder.events, 2)
+		assert.Equal(t, service.EventUpdated, recorder.events[0].Type)
+		assert.Equal(t, storage.StatusDisabled, recorder.events[0].Status)
+		assert.Equal(t, "brand.link", recorder.events[0].Domain)
+		assert.Equal(t, service.EventDeleted, recorder.events[1].Type)
+		assert.Equal(t, "sho.rt", recorder.events[1].Domain)
+	})
+
+	t.Run("неудачная операция не публикуется", func(t *testing.T) {
+		s, recorder := newService()
+
+		mockStorage.EXPECT().EnableUrl(gomock.Any(), "", "QWERTY1234").Return(storage.ErrNotFound)
+		mockStorage.EXPECT().RestoreUrl(gomock.Any(), "", "QWERTY1234").Return(errors.New("db down"))
+
+		assert.ErrorIs(t, s.EnableUrl(context.Background(), "", "QWERTY1234"), service.ErrNotFound)
+		assert.Error(t, s.RestoreUrl(context.Background(), "", "QWERTY1234"))
+		assert.Empty(t, recorder.events)
+	})
+
+	t.Run("статус без перехода не публикуется", func(t *testing.T) {
+		s, recorder := newService()
+
+		mockStorage.EXPECT().DisableUrl(gomock.Any(), "", "QWERTY1234").Return(storage.ErrUnchanged)
+		mockStorage.EXPECT().EnableUrl(gomock.Any(), "", "QWERTY1234").Return(storage.ErrUnchanged)
+
+		assert.NoError(t, s.DisableUrl(context.Background(), "", "QWERTY1234"))
+		assert.NoError(t, s.EnableUrl(context.Background(), "", "QWERTY1234"))
+		assert.Empty(t, recorder.events)
+	})
+
+	t.Run("очистка истекших", func(t *testing.T) {
+		s, recorder := newService()
+
+		keys := []storage.Key{{Alias: "a"}, {Alias: "b"}}
+		filter := storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 10}
+		mockStorage.EXPECT().PurgeStale(gomock.Any(), filter).Return(keys, nil)
+
+		_, err := s.PurgeStale(context.Background(), filter)
+		require.NoError(t, err)
+
+		require.Len(t, recorder.events, 2)
+		assert.Equal(t, service.EventExpired, recorder.events[0].Type)
+		assert.Equal(t, "b", recorder.events[1].Alias)
+	})
+
+	t.Run("очистка неиспользуемых и пробный режим", func(t *testing.T) {
+		s, recorder := newService()
+
+		stale := storage.PurgeFilter{NotAccessedSince: time.Now(), Limit: 10}
+		dryRun := storage.PurgeFilter{ExpiredBefore: time.Now(), Limit: 10, DryRun: true}
+		mockStorage.EXPECT().PurgeStale(gomock.Any(), stale).Return([]storage.Key{{Alias: "a"}}, nil)
+		mockStorage.EXPECT().PurgeStale(gomock.Any(), dryRun).Return([]storage.Key{{Alias: "b"}}, nil)
+
+		_, err := s.PurgeStale(context.Background(), stale)
+		require.NoError(t, err)
+		_, err = s.PurgeStale(context.Background(), dryRun)
+		require.NoError(t, err)
+
+		require.Len(t, recorder.events, 1)
+		assert.Equal(t, service.EventDeleted, recorder.events[0].Type)
+		assert.Equal(t, "a", recorder.events[0].Alias)
+	})
+}
+
+func TestService_Webhooks(t *testing.T) {
+	store, ok := mapStorage.New().(storage.WebhookStore)
+	require.True(t, ok)
+
+	s := service.New(nil, nil, service.WithWebhooks(store), service.WithDomains("sho.rt", map[string]service.DomainRules{
+		"sho.rt":     {},
+		"brand.link": {},
+	}))
+
+	t.Run("создание со сгенерированным ключом", func(t *testing.T) {
+		webhook, err := s.CreateWebhook(context.Background(), storage.Webhook{
+			Url:     "https://cms.example.com/hook",
+			Events:  []string{"link.created", "link.created", "link.expired"},
+			Domains: []string{"", "Brand.Link"},
+		})
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, webhook.ID)
+		assert.Len(t, webhook.Secret, 64)
+		assert.Equal(t, []string{"link.created", "link.expired"}, webhook.Events)
+		assert.Equal(t, []string{"sho.rt", "brand.link"}, webhook.Domains)
+
+		webhooks, err := s.ListWebhooks(context.Background())
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		assert.Equal(t, webhook.ID, webhooks[0].ID)
+		assert.Empty(t, webhooks[0].Secret)
+
+		require.NoError(t, s.DeleteWebhook(context.Background(), webhook.ID))
+		assert.ErrorIs(t, s.DeleteWebhook(context.Background(), webhook.ID), service.ErrNotFound)
+	})
+
+	tests := []struct {
+		name        string
+		webhook     storage.Webhook
+		expectedErr error
+	}{
+		{
+			name:        "невалидный url",
+			webhook:     storage.Webhook{Url: "cms.example.com"},
+			expectedErr: service.ErrBadWebhook,
+		},
+		{
+			name:        "короткий ключ",
+			webhook:     storage.Webhook{Url: "https://cms.example.com/hook", Secret: "short"},
+			expectedErr: service.ErrBadWebhook,
+		},
+		{
+			name:        "неизвестное событие",
+			webhook:     storage.Webhook{Url: "https://cms.example.com/hook", Events: []string{"link.clicked"}},
+			expectedErr: service.ErrBadWebhook,
+		},
+		{
+			name:        "неизвестный домен",
+			webhook:     storage.Webhook{Url: "https://cms.example.com/hook", Domains: []string{"other.io"}},
+			expectedErr: service.ErrUnknownDomain,
+		},
+		{
+			name:        "слишком много фильтров",
+			webhook:     storage.Webhook{Url: "https://cms.example.com/hook", Domains: strings.Split(strings.Repeat("sho.rt,", 21), ",")},
+			expectedErr: service.ErrBadWebhook,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateWebhook(context.Background(), tt.webhook)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+
+	t.Run("хранилище без подписок", func(t *testing.T) {
+		_, err := service.New(nil, nil).ListWebhooks(context.Background())
+		assert.ErrorIs(t, err, service.ErrWebhooksUnavailable)
+	})
+}
@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"context"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestService_GetUrlForward(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	tests := []struct {
+		name    string
+		link    storage.Link
+		rc      service.RequestContext
+		want    string
+		wantErr error
+	}{
+		{
+			name: "параметры не переносятся по умолчанию",
+			link: storage.Link{Url: "https://example.com/landing?a=1"},
+			rc:   service.RequestContext{Query: url.Values{"utm_source": {"mail"}}},
+			want: "https://example.com/landing?a=1",
+		},
+		{
+			name: "merge: побеждает адрес назначения",
+			link: storage.Link{Url: "https://example.com/landing?utm_source=site&b=2#top", ForwardQuery: storage.QueryForwardMerge},
+			rc:   service.RequestContext{Query: url.Values{"utm_source": {"mail"}, "utm_medium": {"email"}, "a": {"1"}}},
+			want: "https://example.com/landing?utm_source=site&b=2&a=1&utm_medium=email#top",
+		},
+		{
+			name: "override: побеждает переход",
+			link: storage.Link{Url: "https://example.com/landing?utm_source=site&b=2", ForwardQuery: storage.QueryForwardOverride},
+			rc:   service.RequestContext{Query: url.Values{"utm_source": {"mail", "sms"}}},
+			want: "https://example.com/landing?b=2&utm_source=mail&utm_source=sms",
+		},
+		{
+			name: "путь дописывается к пути адреса",
+			link: storage.Link{Url: "https://example.com/docs/?v=2", ForwardPath: true},
+			rc:   service.RequestContext{Path: "/guide/intro%20page"},
+			want: "https://example.com/docs/guide/intro%20page?v=2",
+		},
+		{
+			name:    "путь у ссылки без переноса пути",
+			link:    storage.Link{Url: "https://example.com/docs"},
+			rc:      service.RequestContext{Path: "/guide"},
+			wantErr: service.ErrNotFound,
+		},
+		{
+			name:    "выход за пределы адреса",
+			link:    storage.Link{Url: "https://example.com/docs", ForwardPath: true},
+			rc:      service.RequestContext{Path: "/%2e%2e/admin"},
+			wantErr: service.ErrBadPath,
+		},
+		{
+			name: "перенос в адрес правила",
+			link: storage.Link{
+				Url:          "https://example.com",
+				Rules:        []storage.Rule{{Query: map[string]string{"app": "1"}, Url: "https://app.example.com/open"}},
+				ForwardPath:  true,
+				ForwardQuery: storage.QueryForwardMerge,
+			},
+			rc:   service.RequestContext{Path: "/item/7", Query: url.Values{"app": {"1"}}},
+			want: "https://app.example.com/open/item/7?app=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(tt.link, nil)
+
+			got, err := s.GetUrl(context.Background(), "", "example-alias", tt.rc)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Url)
+		})
+	}
+}
+
+func TestService_SaveUrlBadForward(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s := service.New(mockStore.NewMockStorage(ctrl), mockRand.NewMockRandomProvider(ctrl))
+
+	_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", ForwardQuery: "append"})
+	assert.ErrorIs(t, err, service.ErrBadForward)
+}
@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePages возвращает заданные сведения о странице или ошибку.
+type fakePages struct {
+	page storage.Page
+	err  error
+}
+
+func (f fakePages) Fetch(_ context.Context, _ string) (storage.Page, error) {
+	return f.page, f.err
+}
+
+func TestService_SaveUrlPage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+
+	t.Run("сведения о странице сохраняются с обрезкой", func(t *testing.T) {
+		s := service.New(mockStorage, mockRandom, service.WithPageFetcher(fakePages{page: storage.Page{
+			Title: strings.Repeat("т", 300),
+			Image: "https://example.com/cover.png",
+		}}, time.Second))
+
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, link storage.Link) error {
+				assert.True(t, link.Preview)
+				assert.Equal(t, strings.Repeat("т", 255), link.Page.Title)
+				assert.Equal(t, "https://example.com/cover.png", link.Page.Image)
+				return nil
+			})
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Preview: true})
+		assert.NoError(t, err)
+	})
+
+	t.Run("недоступная страница не мешает сохранению", func(t *testing.T) {
+		s := service.New(mockStorage, mockRandom, service.WithPageFetcher(fakePages{err: errors.New("timeout")}, time.Second))
+
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		// сведения, переданные клиентом, не сохраняются
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{Alias: "example-alias", Url: "http://google.com"}).
+			Return(nil)
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Page: storage.Page{Title: "подмена"}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestService_GetUrlPreview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	tracker := &trackRecorder{}
+	s := service.New(mockStorage, mockRandom, service.WithAccessTracker(tracker))
+
+	link := storage.Link{Alias: "example-alias", Url: "http://google.com", Preview: true, MaxUses: 5, UsesLeft: 5}
+	mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(link, nil).Times(3)
+
+	// предпросмотр не тратит использование, не считается обращением и не раскрывает адрес
+	got, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{})
+	assert.NoError(t, err)
+	assert.Empty(t, got.Url)
+	assert.Empty(t, tracker.keys)
+
+	got, err = s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{Preview: true, Confirmed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), got.UsesLeft)
+	assert.Empty(t, tracker.keys)
+
+	// подтвержденный переход учитывается
+	mockStorage.EXPECT().UseUrl(gomock.Any(), "", "example-alias").Return(int64(4), nil)
+	got, err = s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{Confirmed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), got.UsesLeft)
+	assert.Equal(t, []storage.Key{{Alias: "example-alias"}}, tracker.keys)
+}
+
+func TestService_GetUrlPreview_LimitedUses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	page := storage.Page{Title: "Секретный документ"}
+	oneTime := storage.Link{Alias: "one-time", Url: "http://google.com/secret", MaxUses: 1, UsesLeft: 1, Page: page}
+	mockStorage.EXPECT().GetUrl(gomock.Any(), "", "one-time").Return(oneTime, nil).Times(3)
+
+	// одноразовую ссылку нельзя прочитать через предпросмотр, не потратив использование
+	for i := 0; i < 2; i++ {
+		got, err := s.GetUrl(context.Background(), "", "one-time", service.RequestContext{Preview: true})
+		assert.NoError(t, err)
+		assert.Empty(t, got.Url)
+		assert.Empty(t, got.Page)
+	}
+
+	// адрес отдается только вместе с использованием
+	mockStorage.EXPECT().UseUrl(gomock.Any(), "", "one-time").Return(int64(0), nil)
+	got, err := s.GetUrl(context.Background(), "", "one-time", service.RequestContext{Confirmed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://google.com/secret", got.Url)
+
+	// у ссылки без ограничения предпросмотр показывает адрес
+	unlimited := storage.Link{Alias: "unlimited", Url: "http://google.com", Page: page}
+	mockStorage.EXPECT().GetUrl(gomock.Any(), "", "unlimited").Return(unlimited, nil)
+	got, err = s.GetUrl(context.Background(), "", "unlimited", service.RequestContext{Preview: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://google.com", got.Url)
+	assert.Equal(t, page, got.Page)
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"github.com/RVodassa/url-shortener/internal/lib/qrcode"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+// fakeQr возвращает содержимое кода вместо изображения.
+type fakeQr struct{}
+
+func (fakeQr) Render(content string, opts qrcode.Options) ([]byte, error) {
+	if _, err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+func TestService_GetQrCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	publicUrl, _ := url.Parse("https://sho.rt/s/?ref=1")
+	s := service.New(mockStorage, mockRandom,
+		service.WithQrCodes(fakeQr{}, publicUrl),
+		service.WithDomains("sho.rt", map[string]service.DomainRules{"sho.rt": {}, "brand.link": {}}),
+	)
+
+	t.Run("домен по умолчанию", func(t *testing.T) {
+		mockStorage.EXPECT().GetUrl(gomock.Any(), "", "QWERTY1234").Return(storage.Link{Url: "http://google.com"}, nil)
+
+		data, err := s.GetQrCode(context.Background(), "", "QWERTY1234", qrcode.Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, "https://sho.rt/s/QWERTY1234", string(data))
+	})
+
+	t.Run("свой домен", func(t *testing.T) {
+		mockStorage.EXPECT().GetUrl(gomock.Any(), "brand.link", "abc123").Return(storage.Link{Url: "http://google.com"}, nil)
+
+		data, err := s.GetQrCode(context.Background(), "brand.link", "abc123", qrcode.Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, "https://brand.link/s/abc123", string(data))
+	})
+
+	t.Run("ссылка не найдена", func(t *testing.T) {
+		mockStorage.EXPECT().GetUrl(gomock.Any(), "", "missing").Return(storage.Link{}, storage.ErrNotFound)
+
+		_, err := s.GetQrCode(context.Background(), "", "missing", qrcode.Options{})
+		assert.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("невалидные параметры", func(t *testing.T) {
+		mockStorage.EXPECT().GetUrl(gomock.Any(), "", "QWERTY1234").Return(storage.Link{Url: "http://google.com"}, nil)
+
+		_, err := s.GetQrCode(context.Background(), "", "QWERTY1234", qrcode.Options{Format: "gif"})
+		assert.ErrorIs(t, err, service.ErrBadQrOptions)
+	})
+
+	t.Run("QR коды не настроены", func(t *testing.T) {
+		_, err := service.New(mockStorage, mockRandom).GetQrCode(context.Background(), "", "QWERTY1234", qrcode.Options{})
+		assert.ErrorIs(t, err, service.ErrQrUnavailable)
+	})
+}
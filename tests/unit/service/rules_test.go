@@ -0,0 +1,165 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+type fakeGeo map[netip.Addr]string
+
+func (f fakeGeo) Country(ip netip.Addr) (string, error) {
+	return f[ip], nil
+}
+
+func TestService_GetUrlRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	geo := fakeGeo{netip.MustParseAddr("5.255.255.5"): "RU"}
+	s := service.New(mockStorage, mockRandom, service.WithGeoLocator(geo))
+
+	link := storage.Link{
+		Alias: "example-alias",
+		Url:   "http://example.com",
+		Rules: []storage.Rule{
+			{Query: map[string]string{"utm_source": "mail"}, Url: "http://example.com/mail"},
+			{UserAgent: "iphone|ipad", Url: "http://apps.apple.com/app"},
+			{Language: "de", Url: "http://example.de"},
+			{Country: "RU", Url: "http://example.ru"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		rc          service.RequestContext
+		expectedUrl string
+	}{
+		{
+			name:        "ни одно правило не совпало",
+			rc:          service.RequestContext{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)"},
+			expectedUrl: "http://example.com",
+		},
+		{
+			name:        "User-Agent без учета регистра",
+			rc:          service.RequestContext{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0)"},
+			expectedUrl: "http://apps.apple.com/app",
+		},
+		{
+			name:        "язык с наибольшим весом и регионом",
+			rc:          service.RequestContext{AcceptLanguage: "en;q=0.5, de-AT;q=0.9"},
+			expectedUrl: "http://example.de",
+		},
+		{
+			name:        "страна по IP",
+			rc:          service.RequestContext{ClientIP: netip.MustParseAddr("5.255.255.5")},
+			expectedUrl: "http://example.ru",
+		},
+		{
+			name: "первое совпавшее правило",
+			rc: service.RequestContext{
+				UserAgent: "iPad",
+				Query:     url.Values{"utm_source": {"mail"}},
+			},
+			expectedUrl: "http://example.com/mail",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().
+				GetUrl(gomock.Any(), "", "example-alias").
+				Return(link, nil)
+
+			result, err := s.GetUrl(context.Background(), "", "example-alias", tt.rc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedUrl, result.Url)
+		})
+	}
+}
+
+func TestService_GetUrlRules_ManyPatterns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	linkFor := func(i int) storage.Link {
+		return storage.Link{
+			Alias: "example-alias",
+			Url:   "http://example.com",
+			Rules: []storage.Rule{{UserAgent: fmt.Sprintf("^bot-%d$", i), Url: fmt.Sprintf("http://example.com/%d", i)}},
+		}
+	}
+
+	// шаблонов больше, чем помещается в кэш: после вытеснения они компилируются заново
+	const patterns = 1500
+	for round := 0; round < 2; round++ {
+		for i := 0; i < patterns; i++ {
+			mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(linkFor(i), nil)
+			result, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{UserAgent: fmt.Sprintf("bot-%d", i)})
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("http://example.com/%d", i), result.Url)
+
+			// чужой User-Agent не совпадает с закэшированным шаблоном
+			mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(linkFor(i), nil)
+			result, err = s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{UserAgent: fmt.Sprintf("bot-%d", i+1)})
+			assert.NoError(t, err)
+			assert.Equal(t, "http://example.com", result.Url)
+		}
+	}
+}
+
+func TestService_SaveUrlRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	t.Run("язык и страна приводятся к одному регистру", func(t *testing.T) {
+		mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{
+				Alias: "example-alias",
+				Url:   "http://google.com",
+				Rules: []storage.Rule{{Language: "en-us", Country: "US", Url: "http://google.us"}},
+			}).
+			Return(nil)
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{
+			Url:   "http://google.com",
+			Rules: []storage.Rule{{Language: "en-US", Country: "us", Url: "http://google.us"}},
+		})
+		assert.NoError(t, err)
+	})
+
+	invalid := map[string]storage.Rule{
+		"правило без условий":    {Url: "http://google.us"},
+		"невалидный url правила": {Country: "US", Url: "google.us"},
+		"невалидный User-Agent":  {UserAgent: "iphone(", Url: "http://google.us"},
+		"невалидный код страны":  {Country: "USA", Url: "http://google.us"},
+	}
+	for name, rule := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.SaveUrl(context.Background(), storage.Link{
+				Url:   "http://google.com",
+				Rules: []storage.Rule{rule},
+			})
+			assert.ErrorIs(t, err, service.ErrBadRules)
+		})
+	}
+}
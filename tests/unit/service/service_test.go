@@ -4,13 +4,17 @@ import (
 	"context"
 	"fmt"
 	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/lib/scanner"
 	"github.com/RVodassa/url-shortener/internal/service"
 	"github.com/RVodassa/url-shortener/internal/storage"
 	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO: в конфиг
@@ -42,7 +46,7 @@ func TestService_SaveUrl(t *testing.T) {
 			},
 			mockSaveUrl: func() {
 				mockStorage.EXPECT().
-					SaveUrl(gomock.Any(), "example-alias", "http://google.com").
+					SaveUrl(gomock.Any(), storage.Link{Alias: "example-alias", Url: "http://google.com"}).
 					Return(nil)
 			},
 			expectedResult: "example-alias",
@@ -76,11 +80,11 @@ func TestService_SaveUrl(t *testing.T) {
 			mockSaveUrl: func() {
 				// Первая попытка сохранения (алиас уже существует)
 				mockStorage.EXPECT().
-					SaveUrl(gomock.Any(), "existing-alias", "http://google.com").
+					SaveUrl(gomock.Any(), storage.Link{Alias: "existing-alias", Url: "http://google.com"}).
 					Return(storage.ErrExistAlias)
 				// Вторая попытка сохранения (успешно)
 				mockStorage.EXPECT().
-					SaveUrl(gomock.Any(), "new-alias", "http://google.com").
+					SaveUrl(gomock.Any(), storage.Link{Alias: "new-alias", Url: "http://google.com"}).
 					Return(nil)
 			},
 			expectedResult: "new-alias",
@@ -99,7 +103,7 @@ func TestService_SaveUrl(t *testing.T) {
 			}
 
 			// Вызываем метод SaveUrl
-			result, err := s.SaveUrl(context.Background(), tt.url)
+			result, err := s.SaveUrl(context.Background(), storage.Link{Url: tt.url})
 
 			// Проверяем результат
 			if tt.expectedErr != nil {
@@ -133,8 +137,8 @@ func TestService_GetUrl(t *testing.T) {
 			alias: "example-alias",
 			mockGetUrl: func() {
 				mockStorage.EXPECT().
-					GetUrl(gomock.Any(), "example-alias").
-					Return("http://google.com", nil)
+					GetUrl(gomock.Any(), "", "example-alias").
+					Return(storage.Link{Alias: "example-alias", Url: "http://google.com"}, nil)
 			},
 			expectedUrl: "http://google.com",
 			expectedErr: nil,
@@ -144,8 +148,8 @@ func TestService_GetUrl(t *testing.T) {
 			alias: "not-exist-alias",
 			mockGetUrl: func() {
 				mockStorage.EXPECT().
-					GetUrl(gomock.Any(), "not-exist-alias").
-					Return("", storage.ErrNotFound)
+					GetUrl(gomock.Any(), "", "not-exist-alias").
+					Return(storage.Link{}, storage.ErrNotFound)
 			},
 			expectedUrl: "",
 			expectedErr: service.ErrNotFound,
@@ -155,8 +159,8 @@ func TestService_GetUrl(t *testing.T) {
 			alias: "error-get-url",
 			mockGetUrl: func() {
 				mockStorage.EXPECT().
-					GetUrl(gomock.Any(), "error-get-url").
-					Return("", fmt.Errorf("internal errror"))
+					GetUrl(gomock.Any(), "", "error-get-url").
+					Return(storage.Link{}, fmt.Errorf("internal errror"))
 			},
 			expectedUrl: "",
 			expectedErr: fmt.Errorf("service.GetUrl: %w", fmt.Errorf("internal errror")),
@@ -169,7 +173,7 @@ func TestService_GetUrl(t *testing.T) {
 				tt.mockGetUrl()
 			}
 
-			result, err := s.GetUrl(context.Background(), tt.alias)
+			result, err := s.GetUrl(context.Background(), "", tt.alias, service.RequestContext{})
 
 			if tt.expectedErr != nil {
 				assert.Error(t, err)
@@ -177,7 +181,7 @@ func TestService_GetUrl(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
-			assert.Equal(t, tt.expectedUrl, result)
+			assert.Equal(t, tt.expectedUrl, result.Url)
 		})
 	}
 }
@@ -201,7 +205,7 @@ func TestService_DeleteUrl(t *testing.T) {
 			alias: "QWERTY1234",
 			mockDelete: func() {
 				mockStorage.EXPECT().
-					DeleteUrl(gomock.Any(), "QWERTY1234").
+					DeleteUrl(gomock.Any(), "", "QWERTY1234").
 					Return(nil)
 			},
 			expectedErr: nil,
@@ -211,7 +215,7 @@ func TestService_DeleteUrl(t *testing.T) {
 			alias: "not-exist-alias",
 			mockDelete: func() {
 				mockStorage.EXPECT().
-					DeleteUrl(gomock.Any(), "not-exist-alias").
+					DeleteUrl(gomock.Any(), "", "not-exist-alias").
 					Return(storage.ErrNotFound)
 			},
 			expectedErr: service.ErrNotFound,
@@ -221,7 +225,7 @@ func TestService_DeleteUrl(t *testing.T) {
 			alias: "error-alias",
 			mockDelete: func() {
 				mockStorage.EXPECT().
-					DeleteUrl(gomock.Any(), "error-alias").
+					DeleteUrl(gomock.Any(), "", "error-alias").
 					Return(fmt.Errorf("internal errror"))
 			},
 			expectedErr: fmt.Errorf("service.DeleteUrl: %w", fmt.Errorf("internal errror")),
@@ -234,7 +238,7 @@ func TestService_DeleteUrl(t *testing.T) {
 				tt.mockDelete()
 			}
 
-			err := s.DeleteUrl(context.Background(), tt.alias)
+			err := s.DeleteUrl(context.Background(), "", tt.alias)
 
 			if tt.expectedErr != nil {
 				assert.Error(t, err)
@@ -245,3 +249,466 @@ func TestService_DeleteUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestService_SaveUrl_Canceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// alias занят, а запрос тем временем отменен: новых попыток нет
+	mockRandom.EXPECT().
+		RandomString(aliasLength).
+		Return("existing-alias", nil)
+	mockStorage.EXPECT().
+		SaveUrl(gomock.Any(), storage.Link{Alias: "existing-alias", Url: "http://google.com"}).
+		DoAndReturn(func(context.Context, storage.Link) error {
+			cancel()
+			return storage.ErrExistAlias
+		})
+
+	result, err := s.SaveUrl(ctx, storage.Link{Url: "http://google.com"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, result)
+}
+
+func TestService_SaveUrl_Scanner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	mockScanner := mockRand.NewMockURLScanner(ctrl)
+
+	tests := []struct {
+		name           string
+		failClosed     bool
+		ctx            func() context.Context // nil - context.Background()
+		mock           func()
+		expectedResult string
+		expectedErr    error
+	}{
+		{
+			name: "url прошел проверку",
+			mock: func() {
+				mockScanner.EXPECT().
+					Scan(gomock.Any(), "http://google.com").
+					Return(scanner.Verdict{}, nil)
+				mockRandom.EXPECT().
+					RandomString(aliasLength).
+					Return("example-alias", nil)
+				mockStorage.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Alias: "example-alias", Url: "http://google.com"}).
+					Return(nil)
+			},
+			expectedResult: "example-alias",
+		},
+		{
+			name: "вредоносный url",
+			mock: func() {
+				mockScanner.EXPECT().
+					Scan(gomock.Any(), "http://google.com").
+					Return(scanner.Verdict{Malicious: true, Reason: "phishing"}, nil)
+			},
+			expectedErr: service.ErrMaliciousUrl,
+		},
+		{
+			name: "проверка недоступна, fail-open",
+			mock: func() {
+				mockScanner.EXPECT().
+					Scan(gomock.Any(), "http://google.com").
+					Return(scanner.Verdict{}, context.DeadlineExceeded)
+				mockRandom.EXPECT().
+					RandomString(aliasLength).
+					Return("example-alias", nil)
+				mockStorage.EXPECT().
+					SaveUrl(gomock.Any(), storage.Link{Alias: "example-alias", Url: "http://google.com"}).
+					Return(nil)
+			},
+			expectedResult: "example-alias",
+		},
+		{
+			name:       "запрос отменен во время проверки",
+			failClosed: true,
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			mock: func() {
+				mockScanner.EXPECT().
+					Scan(gomock.Any(), "http://google.com").
+					Return(scanner.Verdict{}, context.Canceled)
+			},
+			expectedErr: context.Canceled,
+		},
+		{
+			name:       "проверка недоступна, fail-closed",
+			failClosed: true,
+			mock: func() {
+				mockScanner.EXPECT().
+					Scan(gomock.Any(), "http://google.com").
+					Return(scanner.Verdict{}, context.DeadlineExceeded)
+			},
+			expectedErr: service.ErrScanUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := service.New(mockStorage, mockRandom, service.WithScanner(mockScanner, time.Second, tt.failClosed))
+			tt.mock()
+
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+			result, err := s.SaveUrl(ctx, storage.Link{Url: "http://google.com"})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
+
+func TestService_GetUrl_Scanner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	mockScanner := mockRand.NewMockURLScanner(ctrl)
+	s := service.New(mockStorage, mockRandom, service.WithScanner(mockScanner, time.Second, true))
+
+	tests := []struct {
+		name        string
+		verdict     scanner.Verdict
+		scanErr     error
+		expectedUrl string
+		expectedErr error
+	}{
+		{
+			name:        "url чистый",
+			expectedUrl: "http://google.com",
+		},
+		{
+			name:        "url помечен после сохранения",
+			verdict:     scanner.Verdict{Malicious: true},
+			expectedErr: service.ErrMaliciousUrl,
+		},
+		{
+			name:        "проверка недоступна - переход не блокируется",
+			scanErr:     context.DeadlineExceeded,
+			expectedUrl: "http://google.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().
+				GetUrl(gomock.Any(), "", "example-alias").
+				Return(storage.Link{Alias: "example-alias", Url: "http://google.com"}, nil)
+			mockScanner.EXPECT().
+				Scan(gomock.Any(), "http://google.com").
+				Return(tt.verdict, tt.scanErr)
+
+			result, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedUrl, result.Url)
+		})
+	}
+}
+
+func TestService_GetUrl_ScannerCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	mockScanner := mockRand.NewMockURLScanner(ctrl)
+	cache := scanner.NewCache(mockScanner, time.Minute)
+	s := service.New(mockStorage, mockRandom, service.WithScanner(cache, time.Second, true))
+
+	link := storage.Link{Alias: "example-alias", Url: "https://example.com/landing", ForwardQuery: storage.QueryForwardMerge}
+	mockStorage.EXPECT().GetUrl(gomock.Any(), "", "example-alias").Return(link, nil).Times(2)
+	// проверяется сохраненный адрес, поэтому параметры перехода не обходят кэш
+	mockScanner.EXPECT().Scan(gomock.Any(), "https://example.com/landing").Return(scanner.Verdict{}, nil)
+
+	for _, source := range []string{"mail", "site"} {
+		rc := service.RequestContext{Query: url.Values{"utm_source": {source}}}
+		result, err := s.GetUrl(context.Background(), "", "example-alias", rc)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/landing?utm_source="+source, result.Url)
+	}
+}
+
+func TestService_DisableUrl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	tests := []struct {
+		name        string
+		storageErr  error
+		expectedErr error
+	}{
+		{name: "успешное отключение", storageErr: nil, expectedErr: nil},
+		{name: "alias не найден", storageErr: storage.ErrNotFound, expectedErr: service.ErrNotFound},
+		{
+			name:        "ошибка хранилища",
+			storageErr:  fmt.Errorf("internal errror"),
+			expectedErr: fmt.Errorf("service.DisableUrl: %w", fmt.Errorf("internal errror")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().
+				DisableUrl(gomock.Any(), "", "QWERTY1234").
+				Return(tt.storageErr)
+
+			err := s.DisableUrl(context.Background(), "", "QWERTY1234")
+
+			if tt.expectedErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, tt.expectedErr.Error(), err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestService_GetUrl_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	mockStorage.EXPECT().
+		GetUrl(gomock.Any(), "", "QWERTY1234").
+		Return(storage.Link{}, storage.ErrDisabled)
+
+	_, err := s.GetUrl(context.Background(), "", "QWERTY1234", service.RequestContext{})
+	assert.ErrorIs(t, err, service.ErrDisabled)
+}
+
+func TestService_PurgeDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	mockStorage.EXPECT().
+		PurgeDeleted(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, before time.Time) (int64, error) {
+			assert.WithinDuration(t, time.Now().Add(-time.Hour), before, time.Second)
+			return 2, nil
+		})
+
+	purged, err := s.PurgeDeleted(context.Background(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
+
+func TestService_SaveUrl_Metadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	t.Run("теги нормализуются", func(t *testing.T) {
+		mockRandom.EXPECT().
+			RandomString(aliasLength).
+			Return("example-alias", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{
+				Alias: "example-alias",
+				Url:   "http://google.com",
+				Title: "Google",
+				Tags:  []string{"search", "docs"},
+			}).
+			Return(nil)
+
+		alias, err := s.SaveUrl(context.Background(), storage.Link{
+			Url:   "http://google.com",
+			Title: "Google",
+			Tags:  []string{" Search ", "docs", "", "SEARCH"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "example-alias", alias)
+	})
+
+	t.Run("слишком длинный заголовок", func(t *testing.T) {
+		_, err := s.SaveUrl(context.Background(), storage.Link{
+			Url:   "http://google.com",
+			Title: strings.Repeat("a", 256),
+		})
+		assert.ErrorIs(t, err, service.ErrBadMetadata)
+	})
+
+	t.Run("срок действия в прошлом", func(t *testing.T) {
+		_, err := s.SaveUrl(context.Background(), storage.Link{
+			Url:       "http://google.com",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		assert.ErrorIs(t, err, service.ErrBadExpiry)
+	})
+}
+
+func TestService_ListUrls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	links := []storage.Link{{Alias: "a1", Url: "http://google.com", Tags: []string{"docs"}}}
+	mockStorage.EXPECT().
+		ListUrls(gomock.Any(), storage.ListFilter{Tag: "docs", Limit: 1000}).
+		Return(links, nil)
+
+	got, err := s.ListUrls(context.Background(), storage.ListFilter{Tag: " Docs "})
+	assert.NoError(t, err)
+	assert.Equal(t, links, got)
+}
+
+type trackRecorder struct {
+	keys     []storage.Key
+	variants []int
+}
+
+func (r *trackRecorder) Track(key storage.Key, variant int) {
+	r.keys = append(r.keys, key)
+	r.variants = append(r.variants, variant)
+}
+
+func TestService_GetUrl_TracksAccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	tracker := &trackRecorder{}
+	s := service.New(mockStorage, mockRandom, service.WithAccessTracker(tracker))
+
+	mockStorage.EXPECT().
+		GetUrl(gomock.Any(), "", "example-alias").
+		Return(storage.Link{Alias: "example-alias", Url: "http://google.com"}, nil)
+	mockStorage.EXPECT().
+		GetUrl(gomock.Any(), "", "not-exist-alias").
+		Return(storage.Link{}, storage.ErrNotFound)
+
+	_, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{})
+	assert.NoError(t, err)
+	_, err = s.GetUrl(context.Background(), "", "not-exist-alias", service.RequestContext{})
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	// учитываются только успешные обращения
+	assert.Equal(t, []storage.Key{{Alias: "example-alias"}}, tracker.keys)
+	assert.Equal(t, []int{-1}, tracker.variants)
+}
+
+func TestService_GetUrlInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	link := storage.Link{Alias: "example-alias", Url: "http://google.com", Status: storage.StatusDisabled, CreatedAt: time.Now()}
+	mockStorage.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "example-alias").
+		Return(link, nil)
+	mockStorage.EXPECT().
+		GetUrlInfo(gomock.Any(), "", "not-exist-alias").
+		Return(storage.Link{}, storage.ErrNotFound)
+
+	got, err := s.GetUrlInfo(context.Background(), "", "example-alias")
+	assert.NoError(t, err)
+	assert.Equal(t, link, got)
+
+	_, err = s.GetUrlInfo(context.Background(), "", "not-exist-alias")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestService_Domains(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom, service.WithDomains("sho.rt", map[string]service.DomainRules{
+		"sho.rt":     {Reserved: []string{"api"}},
+		"brand.link": {AliasLength: 6},
+	}))
+
+	t.Run("домен по умолчанию хранится без имени", func(t *testing.T) {
+		gomock.InOrder(
+			mockRandom.EXPECT().RandomString(aliasLength).Return("api", nil),
+			mockRandom.EXPECT().RandomString(aliasLength).Return("example-alias", nil),
+		)
+		// зарезервированный alias не выдается
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{Alias: "example-alias", Url: "http://google.com"}).
+			Return(nil)
+
+		alias, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Domain: "Sho.rt"})
+		assert.NoError(t, err)
+		assert.Equal(t, "example-alias", alias)
+	})
+
+	t.Run("свои правила alias домена", func(t *testing.T) {
+		mockRandom.EXPECT().RandomString(6).Return("abc123", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{Domain: "brand.link", Alias: "abc123", Url: "http://google.com"}).
+			Return(nil)
+
+		alias, err := s.SaveUrl(context.Background(), storage.Link{Url: "http://google.com", Domain: "brand.link"})
+		assert.NoError(t, err)
+		assert.Equal(t, "abc123", alias)
+	})
+
+	t.Run("имя домена возвращается в ссылке", func(t *testing.T) {
+		mockStorage.EXPECT().
+			GetUrl(gomock.Any(), "", "example-alias").
+			Return(storage.Link{Alias: "example-alias", Url: "http://google.com"}, nil)
+
+		link, err := s.GetUrl(context.Background(), "", "example-alias", service.RequestContext{})
+		assert.NoError(t, err)
+		assert.Equal(t, "sho.rt", link.Domain)
+	})
+
+	t.Run("неизвестный домен", func(t *testing.T) {
+		_, err := s.GetUrl(context.Background(), "unknown.link", "example-alias", service.RequestContext{})
+		assert.ErrorIs(t, err, service.ErrUnknownDomain)
+
+		err = s.DeleteUrl(context.Background(), "unknown.link", "example-alias")
+		assert.ErrorIs(t, err, service.ErrUnknownDomain)
+	})
+}
@@ -0,0 +1,118 @@
+package service_test
+
+import (
+	"context"
+	mockRand "github.com/RVodassa/url-shortener/internal/lib/random/mock"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	mockStore "github.com/RVodassa/url-shortener/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestService_SaveUrlTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	t.Run("шаблон сохраняется как есть", func(t *testing.T) {
+		mockRandom.EXPECT().RandomString(aliasLength).Return("docs", nil)
+		mockStorage.EXPECT().
+			SaveUrl(gomock.Any(), storage.Link{Alias: "docs", Url: "https://example.com/docs/{version}/{page}", Template: true}).
+			Return(nil)
+
+		_, err := s.SaveUrl(context.Background(), storage.Link{Url: "https://example.com/docs/{version}/{page}", Template: true})
+		assert.NoError(t, err)
+	})
+
+	tests := []struct {
+		name string
+		link storage.Link
+		err  error
+	}{
+		{name: "без подстановок", link: storage.Link{Url: "https://example.com/docs", Template: true}, err: service.ErrBadTemplate},
+		{name: "невалидное имя", link: storage.Link{Url: "https://example.com/{Version}", Template: true}, err: service.ErrBadTemplate},
+		{name: "вместе с переносом пути", link: storage.Link{Url: "https://example.com/{v}", Template: true, ForwardPath: true}, err: service.ErrBadTemplate},
+		{name: "подстановка в хосте", link: storage.Link{Url: "https://{host}/docs", Template: true}, err: service.ErrBadUrl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.SaveUrl(context.Background(), tt.link)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestService_GetUrlTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mockStore.NewMockStorage(ctrl)
+	mockRandom := mockRand.NewMockRandomProvider(ctrl)
+	s := service.New(mockStorage, mockRandom)
+
+	template := storage.Link{
+		Alias:        "docs",
+		Url:          "https://example.com/docs/{version}/{page}?lang={lang}",
+		Template:     true,
+		ForwardQuery: storage.QueryForwardMerge,
+	}
+
+	tests := []struct {
+		name    string
+		rc      service.RequestContext
+		want    string
+		wantErr error
+	}{
+		{
+			name: "значения из пути и query",
+			rc:   service.RequestContext{Path: "/v2.1/install", Query: url.Values{"lang": {"ru"}, "utm_source": {"mail"}}},
+			// параметр, ушедший в подстановку, не переносится повторно
+			want: "https://example.com/docs/v2.1/install?lang=ru&utm_source=mail",
+		},
+		{
+			name: "все значения из query",
+			rc:   service.RequestContext{Query: url.Values{"version": {"latest"}, "page": {"faq"}, "lang": {"en"}}},
+			want: "https://example.com/docs/latest/faq?lang=en",
+		},
+		{
+			name:    "нет значения",
+			rc:      service.RequestContext{Path: "/v2.1"},
+			wantErr: service.ErrBadTemplateValue,
+		},
+		{
+			name:    "значение меняет структуру адреса",
+			rc:      service.RequestContext{Path: "/v2.1/install", Query: url.Values{"lang": {"ru&admin=1"}}},
+			wantErr: service.ErrBadTemplateValue,
+		},
+		{
+			name:    "выход за пределы пути",
+			rc:      service.RequestContext{Path: "/../install", Query: url.Values{"lang": {"ru"}}},
+			wantErr: service.ErrBadTemplateValue,
+		},
+		{
+			name:    "лишние сегменты пути",
+			rc:      service.RequestContext{Path: "/v2.1/install/ru/more"},
+			wantErr: service.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.EXPECT().GetUrl(gomock.Any(), "", "docs").Return(template, nil)
+
+			got, err := s.GetUrl(context.Background(), "", "docs", tt.rc)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Url)
+		})
+	}
+}
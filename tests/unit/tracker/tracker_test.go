@@ -0,0 +1,121 @@
+package tracker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/url-shortener/internal/lib/tracker"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type flushRecorder struct {
+	mu      sync.Mutex
+	batches []map[storage.Key]storage.Access
+	err     error
+}
+
+func (f *flushRecorder) flush(ctx context.Context, accessed map[storage.Key]storage.Access) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, accessed)
+	return f.err
+}
+
+func TestTracker_Flush(t *testing.T) {
+	rec := &flushRecorder{}
+	tr := tracker.New(rec.flush, time.Hour)
+
+	// пустой трекер не пишет в хранилище
+	tr.Flush(context.Background())
+	assert.Empty(t, rec.batches)
+
+	tr.Track(storage.Key{Alias: "a1"}, -1)
+	tr.Track(storage.Key{Alias: "a1"}, -1)
+	tr.Track(storage.Key{Alias: "a2"}, -1)
+	tr.Flush(context.Background())
+
+	assert.Len(t, rec.batches, 1)
+	assert.Len(t, rec.batches[0], 2)
+
+	tr.Flush(context.Background())
+	assert.Len(t, rec.batches, 1)
+}
+
+func TestTracker_Clicks(t *testing.T) {
+	rec := &flushRecorder{err: errors.New("storage down")}
+	tr := tracker.New(rec.flush, time.Hour)
+
+	tr.Track(storage.Key{Alias: "a1"}, 0)
+	tr.Track(storage.Key{Alias: "a1"}, 1)
+	tr.Track(storage.Key{Alias: "a1"}, 1)
+	tr.Flush(context.Background())
+
+	// переходы из неудачного сброса суммируются с новыми
+	rec.err = nil
+	tr.Track(storage.Key{Alias: "a1"}, 1)
+	tr.Flush(context.Background())
+
+	assert.Len(t, rec.batches, 2)
+	assert.Equal(t, map[int]int64{0: 1, 1: 3}, rec.batches[1][storage.Key{Alias: "a1"}].Clicks)
+}
+
+func TestTracker_FlushRetry(t *testing.T) {
+	rec := &flushRecorder{err: errors.New("storage down")}
+	tr := tracker.New(rec.flush, time.Hour)
+
+	tr.Track(storage.Key{Alias: "a1"}, -1)
+	tr.Flush(context.Background())
+
+	// после ошибки обращения не теряются
+	rec.err = nil
+	tr.Flush(context.Background())
+
+	assert.Len(t, rec.batches, 2)
+	assert.Contains(t, rec.batches[1], storage.Key{Alias: "a1"})
+}
+
+func TestTracker_RunFlushesOnStop(t *testing.T) {
+	rec := &flushRecorder{}
+	tr := tracker.New(rec.flush, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx)
+		close(done)
+	}()
+
+	tr.Track(storage.Key{Alias: "a1"}, -1)
+	cancel()
+	<-done
+
+	assert.Len(t, rec.batches, 1)
+	assert.Contains(t, rec.batches[0], storage.Key{Alias: "a1"})
+}
+
+func TestTracker_NoInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		rec := &flushRecorder{}
+		tr := tracker.New(rec.flush, interval)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			tr.Run(ctx)
+			close(done)
+		}()
+
+		// без интервала каждое обращение сохраняется сразу
+		tr.Track(storage.Key{Alias: "a1"}, -1)
+		tr.Track(storage.Key{Alias: "a2"}, 0)
+		assert.Len(t, rec.batches, 2)
+
+		cancel()
+		<-done
+		assert.Len(t, rec.batches, 2)
+	}
+}
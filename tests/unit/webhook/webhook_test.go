@@ -0,0 +1,342 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/RVodassa/url-shortener/internal/service"
+	"github.com/RVodassa/url-shortener/internal/storage"
+	"github.com/RVodassa/url-shortener/internal/storage/inMemory/mapStorage"
+	"github.com/RVodassa/url-shortener/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver принимает доставки и отвечает кодами из statuses по очереди, затем 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	code := http.StatusOK
+	if len(r.statuses) > 0 {
+		code, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newEvent(eventType service.EventType, domain string) service.Event {
+	return service.Event{
+		ID:     "event-1",
+		Type:   eventType,
+		At:     time.Now().Add(-time.Second),
+		Domain: domain,
+		Alias:  "example-alias",
+		Url:    "https://example.com",
+	}
+}
+
+// source отдает события по очереди, позиция - число отданных событий.
+// moved вызывается при чтении, чтобы изобразить другую реплику.
+type source struct {
+	events []service.Event
+	moved  func()
+}
+
+func (s *source) ReadEvents(_ context.Context, offset string, limit int) ([]service.Event, string, error) {
+	start := 0
+	if offset != "" {
+		start, _ = strconv.Atoi(offset)
+	}
+	if s.moved != nil {
+		s.moved()
+	}
+	end := min(start+limit, len(s.events))
+	if start >= end {
+		return nil, offset, nil
+	}
+	return s.events[start:end], strconv.Itoa(end), nil
+}
+
+func newStore(t *testing.T) storage.WebhookStore {
+	store, ok := mapStorage.New().(storage.WebhookStore)
+	require.True(t, ok)
+	return store
+}
+
+// saveWebhook сохраняет подписку, созданную раньше событий newEvent.
+func saveWebhook(t *testing.T, store storage.WebhookStore, id, url string) {
+	t.Helper()
+	require.NoError(t, store.SaveWebhook(context.Background(), storage.Webhook{
+		ID: id, Url: url, Secret: "0123456789abcdef", CreatedAt: time.Now().Add(-time.Minute),
+	}))
+}
+
+// relay ставит события в outbox через Relay и проверяет число доставок.
+func relay(t *testing.T, d *webhook.Dispatcher, want int) {
+	t.Helper()
+	enqueued, err := d.Relay(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, want, enqueued)
+}
+
+func fastConfig() webhook.Config {
+	return webhook.Config{
+		Interval:    time.Millisecond,
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		Timeout:     time.Second,
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	ctx := context.Background()
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	store := newStore(t)
+	saveWebhook(t, store, "hook-1", server.URL)
+
+	event := newEvent(service.EventCreated, "")
+	d := webhook.New(store, &source{events: []service.Event{event}}, server.Client(), fastConfig())
+	relay(t, d, 1)
+
+	report, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Delivered)
+	require.Equal(t, 1, recv.count())
+
+	req, body := recv.requests[0], recv.bodies[0]
+	assert.Equal(t, "link.created", req.Header.Get(webhook.HeaderEvent))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Sign("0123456789abcdef", timestamp, body), req.Header.Get(webhook.HeaderSignature))
+	assert.NotEqual(t, webhook.Sign("другой ключ", timestamp, body), req.Header.Get(webhook.HeaderSignature))
+
+	var got service.Event
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, event.ID, got.ID)
+	assert.Equal(t, event.Alias, got.Alias)
+
+	// доставленное событие не отправляется повторно
+	report, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Report{}, report)
+	assert.Equal(t, 1, recv.count())
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("повтор после ошибки получателя", func(t *testing.T) {
+		recv := &receiver{statuses: []int{http.StatusInternalServerError}}
+		server := httptest.NewServer(recv)
+		defer server.Close()
+
+		store := newStore(t)
+		saveWebhook(t, store, "hook-1", server.URL)
+
+		d := webhook.New(store, &source{events: []service.Event{newEvent(service.EventDeleted, "")}}, server.Client(), fastConfig())
+		relay(t, d, 1)
+
+		report, err := d.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Retried)
+
+		time.Sleep(5 * time.Millisecond)
+		report, err = d.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Delivered)
+
+		// повтор несет тот же id события
+		require.Equal(t, 2, recv.count())
+		assert.Equal(t, recv.requests[0].Header.Get(webhook.HeaderID), recv.requests[1].Header.Get(webhook.HeaderID))
+	})
+
+	t.Run("отбрасывается после MaxAttempts", func(t *testing.T) {
+		recv := &receiver{statuses: []int{500, 500, 500, 500}}
+		server := httptest.NewServer(recv)
+		defer server.Close()
+
+		store := newStore(t)
+		saveWebhook(t, store, "hook-1", server.URL)
+
+		d := webhook.New(store, &source{events: []service.Event{newEvent(service.EventDeleted, "")}}, server.Client(), fastConfig())
+		relay(t, d, 1)
+
+		var total webhook.Report
+		for i := 0; i < 5; i++ {
+			report, err := d.RunOnce(ctx)
+			require.NoError(t, err)
+			total.Retried += report.Retried
+			total.Dropped += report.Dropped
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Equal(t, webhook.Report{Retried: 2, Dropped: 1}, total)
+		assert.Equal(t, 3, recv.count())
+	})
+
+	t.Run("доставки удаленной подписки не отправляются", func(t *testing.T) {
+		recv := &receiver{}
+		server := httptest.NewServer(recv)
+		defer server.Close()
+
+		store := newStore(t)
+		saveWebhook(t, store, "hook-1", server.URL)
+
+		d := webhook.New(store, &source{events: []service.Event{newEvent(service.EventDeleted, "")}}, server.Client(), fastConfig())
+		relay(t, d, 1)
+		require.NoError(t, store.DeleteWebhook(ctx, "hook-1"))
+
+		report, err := d.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.Report{}, report)
+		assert.Equal(t, 0, recv.count())
+	})
+}
+
+func TestDispatcher_Relay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("события журнала изменений", func(t *testing.T) {
+		recv := &receiver{}
+		server := httptest.NewServer(recv)
+		defer server.Close()
+
+		links := mapStorage.New()
+		store := links.(storage.WebhookStore)
+		s := service.New(links, nil, service.WithChangeFeed(links.(storage.ChangeFeed), time.Millisecond))
+		saveWebhook(t, store, "hook-1", server.URL)
+		d := webhook.New(store, s, server.Client(), fastConfig())
+
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, links.SaveUrl(ctx, storage.Link{Alias: "limited", Url: "https://example.com", MaxUses: 1, UsesLeft: 1}))
+		require.NoError(t, links.SaveUrl(ctx, storage.Link{Alias: "expired", Url: "https://example.com", ExpiresAt: past}))
+		require.NoError(t, s.DisableUrl(ctx, "", "limited"))
+		require.NoError(t, s.DisableUrl(ctx, "", "limited"))
+		_, err := links.UseUrl(ctx, "", "limited")
+		require.NoError(t, err)
+		_, err = s.PurgeStale(ctx, storage.PurgeFilter{ExpiredBefore: time.Now()})
+		require.NoError(t, err)
+
+		// повторное отключение и исчерпание использований событий не дают
+		relay(t, d, 4)
+		relay(t, d, 0)
+
+		report, err := d.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Delivered)
+
+		var types []string
+		for _, req := range recv.requests {
+			types = append(types, req.Header.Get(webhook.HeaderEvent))
+		}
+		assert.ElementsMatch(t, []string{"link.created", "link.created", "link.updated", "link.expired"}, types)
+	})
+
+	t.Run("позицию перенесла другая реплика", func(t *testing.T) {
+		store := newStore(t)
+		saveWebhook(t, store, "hook-1", "http://localhost")
+
+		src := &source{events: []service.Event{newEvent(service.EventCreated, "")}}
+		src.moved = func() {
+			src.moved = nil
+			require.NoError(t, store.EnqueueDeliveries(ctx, nil, "", "1"))
+		}
+		d := webhook.New(store, src, nil, fastConfig())
+		relay(t, d, 0)
+
+		deliveries, err := store.ClaimDeliveries(ctx, time.Now(), 10, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("подписка не получает событий до своего создания", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.SaveWebhook(ctx, storage.Webhook{ID: "hook-1", Url: "http://localhost"}))
+
+		d := webhook.New(store, &source{events: []service.Event{newEvent(service.EventCreated, "")}}, nil, fastConfig())
+		relay(t, d, 0)
+
+		offset, err := store.WebhookOffset(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "1", offset)
+	})
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		webhook  storage.Webhook
+		event    service.Event
+		expected bool
+	}{
+		{
+			name:     "без фильтров",
+			event:    newEvent(service.EventExpired, "sho.rt"),
+			expected: true,
+		},
+		{
+			name:     "тип события совпал",
+			webhook:  storage.Webhook{Events: []string{"link.created", "link.expired"}},
+			event:    newEvent(service.EventExpired, "sho.rt"),
+			expected: true,
+		},
+		{
+			name:     "тип события не совпал",
+			webhook:  storage.Webhook{Events: []string{"link.created"}},
+			event:    newEvent(service.EventDeleted, "sho.rt"),
+			expected: false,
+		},
+		{
+			name:     "домен не совпал",
+			webhook:  storage.Webhook{Domains: []string{"brand.link"}},
+			event:    newEvent(service.EventCreated, "sho.rt"),
+			expected: false,
+		},
+		{
+			name:     "событие до создания подписки",
+			webhook:  storage.Webhook{CreatedAt: time.Now()},
+			event:    newEvent(service.EventCreated, "sho.rt"),
+			expected: false,
+		},
+		{
+			name:     "совпали оба фильтра",
+			webhook:  storage.Webhook{Events: []string{"link.created"}, Domains: []string{"sho.rt"}},
+			event:    newEvent(service.EventCreated, "sho.rt"),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, webhook.Matches(tt.webhook, tt.event))
+		})
+	}
+}